@@ -73,3 +73,33 @@ document.getElementById("copyBtn").onclick = function () {
             console.error("Failed to copy: ", err);
         });
 };
+
+// Lấy danh mục giọng đọc từ server; nếu không kết nối được thì giữ các lựa chọn có sẵn
+async function loadVoices() {
+    try {
+        const response = await fetch("http://localhost:8080/voices");
+        const result = await response.json();
+        const voices = result.data && result.data.voices;
+        if (result.status !== "success" || !voices || voices.length === 0) {
+            return;
+        }
+        ["voiceA", "voiceB"].forEach((id) => {
+            const select = document.getElementById(id);
+            const selected = select.value;
+            select.innerHTML = "";
+            voices.forEach((voice) => {
+                const option = document.createElement("option");
+                option.value = voice.name;
+                option.textContent = voice.displayName || voice.name;
+                select.appendChild(option);
+            });
+            if (voices.some((voice) => voice.name === selected)) {
+                select.value = selected;
+            }
+        });
+    } catch (err) {
+        console.error("Failed to load voices: ", err);
+    }
+}
+
+loadVoices();
@@ -103,6 +103,16 @@ func createTablesIfNotExists() error {
 		translate TEXT NOT NULL
 	);`
 
+	// Bản dịch của từ, dùng chung cấu trúc với ứng dụng 03_v2 (03_v2 thêm cột sense_id khi khởi động)
+	wordTranslationTableSQL := `
+	CREATE TABLE IF NOT EXISTS word_translation (
+		word_id BIGINT NOT NULL REFERENCES word(id) ON DELETE CASCADE,
+		lang VARCHAR(35) NOT NULL,
+		text TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
 	// SQL lệnh tạo bảng word_dialog
 	wordDialogTableSQL := `
 	CREATE TABLE IF NOT EXISTS word_dialog (
@@ -123,11 +133,31 @@ func createTablesIfNotExists() error {
 	}
 	log.Println("Word table created or already exists")
 
+	_, err = DB.Exec(wordTranslationTableSQL)
+	if err != nil {
+		return fmt.Errorf("failed to create word_translation table: %w", err)
+	}
+	log.Println("Word_translation table created or already exists")
+
 	_, err = DB.Exec(wordDialogTableSQL)
 	if err != nil {
 		return fmt.Errorf("failed to create word_dialog table: %w", err)
 	}
 	log.Println("Word_dialog table created or already exists")
 
+	// Thông tin thêm cho người học, mọi cột đều có thể trống
+	migrations := []string{
+		`ALTER TABLE word_translation ADD COLUMN IF NOT EXISTS gloss TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS part_of_speech VARCHAR(16) NOT NULL DEFAULT ''`,
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS pronunciation TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS difficulty VARCHAR(2) NOT NULL DEFAULT ''`,
+		`ALTER TABLE word_dialog ADD COLUMN IF NOT EXISTS example TEXT NOT NULL DEFAULT ''`,
+	}
+	for _, migration := range migrations {
+		if _, err := DB.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate schema: %w", err)
+		}
+	}
+
 	return nil
 }
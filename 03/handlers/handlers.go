@@ -7,7 +7,10 @@ import (
 	"io"
 	"log"
 	"net/http"
+	"slices"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
 	"groq-iris-english/config"
 	"groq-iris-english/database"
@@ -38,6 +41,40 @@ type GroqResponse struct {
 	} `json:"choices"`
 }
 
+// partsOfSpeech là các từ loại được chấp nhận
+var partsOfSpeech = []string{"noun", "verb", "adjective", "adverb", "pronoun", "preposition", "conjunction",
+	"interjection", "particle", "classifier", "numeral", "determiner", "phrase"}
+
+// difficultyLevels là các cấp độ CEFR được chấp nhận
+var difficultyLevels = []string{"A1", "A2", "B1", "B2", "C1", "C2"}
+
+// Độ dài tối đa của thông tin thêm; giá trị dài hơn bị bỏ
+const (
+	maxExampleLen       = 300
+	maxGlossLen         = 200
+	maxPronunciationLen = 100
+)
+
+// extractedWord là một từ lọc từ hội thoại cùng thông tin cho người học
+type extractedWord struct {
+	Word          string `json:"word"`
+	PartOfSpeech  string `json:"pos"`
+	Example       string `json:"example"`
+	Pronunciation string `json:"pronunciation"`
+	Difficulty    string `json:"difficulty"`
+}
+
+// UnmarshalJSON nhận cả object lẫn chuỗi (chỉ có từ) như ứng dụng 03_v2
+func (w *extractedWord) UnmarshalJSON(data []byte) error {
+	var word string
+	if err := json.Unmarshal(data, &word); err == nil {
+		*w = extractedWord{Word: word}
+		return nil
+	}
+	type plain extractedWord
+	return json.Unmarshal(data, (*plain)(w))
+}
+
 // IndexHandler displays the homepage
 func IndexHandler(ctx iris.Context) {
 	ctx.View("index.html")
@@ -81,8 +118,9 @@ func ProcessHandler(ctx iris.Context) {
 	// Từ hội thoại trên hãy lọc ra danh sách các từ quan trọng, bỏ qua danh từ tên riêng cần học. Không cần giải thích xuất kết quả ra dạng JSON trong thẻ `words`.
 
 	// Step 2: Extract important words (JSON output)
-	wordsPrompt := fmt.Sprintf(`Từ hội thoại sau, hãy lọc ra danh sách các từ và cụm từ quan trọng, bỏ qua danh từ tên riêng (như James, Lan, Hà Nội, Hoàn Kiếm). Trả về kết quả dưới dạng JSON với cấu trúc {"words": ["word1", "word2", ...]}.
-%s`, dialog)
+	wordsPrompt := fmt.Sprintf(`Từ hội thoại sau, hãy lọc ra danh sách các từ và cụm từ quan trọng, bỏ qua danh từ tên riêng (như James, Lan, Hà Nội, Hoàn Kiếm). Trả về kết quả dưới dạng JSON với cấu trúc {"words": [{"word": "từ", "pos": "từ loại", "example": "câu trong hội thoại có chứa từ", "pronunciation": "phiên âm IPA", "difficulty": "cấp độ CEFR"}, ...]}.
+"pos" là một trong: %s. "example" chép nguyên văn một câu của hội thoại. "difficulty" là A1, A2, B1, B2, C1 hoặc C2. Bỏ trống trường nào không chắc chắn, trừ "word".
+%s`, strings.Join(partsOfSpeech, ", "), dialog)
 	wordsRaw, err := callGroqAPI(cfg.GroqAPIKey, wordsPrompt, map[string]string{"type": "json_object"})
 	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
@@ -91,23 +129,39 @@ func ProcessHandler(ctx iris.Context) {
 	}
 
 	var wordsData struct {
-		Words []string `json:"words"`
+		Words []extractedWord `json:"words"`
 	}
 	if err := json.Unmarshal([]byte(wordsRaw), &wordsData); err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(iris.Map{"error": fmt.Sprintf("Failed to unmarshal words JSON: %v (raw data: %s)", err, wordsRaw)})
 		return
 	}
-	ctx.ViewData("extractedWords", wordsData.Words)
+
+	var extractedWords []string
+	details := make(map[string]models.Word)
+	for _, w := range wordsData.Words {
+		content := strings.TrimSpace(w.Word)
+		if content == "" {
+			continue
+		}
+		extractedWords = append(extractedWords, content)
+		details[strings.ToLower(content)] = cleanWordDetails(models.Word{
+			PartOfSpeech:  w.PartOfSpeech,
+			Example:       w.Example,
+			Pronunciation: w.Pronunciation,
+			Difficulty:    w.Difficulty,
+		}, dialog)
+	}
+	ctx.ViewData("extractedWords", extractedWords)
 
 	// Step 3: Translate words to English (JSON output)
 	var wordsToTranslate []string
-	for _, word := range wordsData.Words {
-		wordsToTranslate = append(wordsToTranslate, fmt.Sprintf(`{"vi": "%s"}`, word))
+	for _, word := range extractedWords {
+		wordsToTranslate = append(wordsToTranslate, fmt.Sprintf(`{"vi": %q}`, word))
 	}
 
 	// Dịch từng từ trong danh sách dưới sang tiếng Anh rồi trả JSON gồm mảng trong đó mỗi phần tử sẽ gồm từ tiếng Việt và từ tiếng Anh tương đương. Không cần giải thích.
-	translatePrompt := fmt.Sprintf(`Dịch từng từ hoặc cụm từ trong danh sách dưới sang tiếng Anh, trả về JSON với cấu trúc {"translated_words": [{"vi": "word", "en": "translation"}, ...]}.
+	translatePrompt := fmt.Sprintf(`Dịch từng từ hoặc cụm từ trong danh sách dưới sang tiếng Anh, trả về JSON với cấu trúc {"translated_words": [{"vi": "word", "en": "translation", "gloss": "short English explanation"}, ...]}. "gloss" không quá một câu, bỏ trống nếu không cần.
 [%s]`, strings.Join(wordsToTranslate, ","))
 	translatedRaw, err := callGroqAPI(cfg.GroqAPIKey, translatePrompt, map[string]string{"type": "json_object"})
 	if err != nil {
@@ -124,6 +178,16 @@ func ProcessHandler(ctx iris.Context) {
 		ctx.JSON(iris.Map{"error": fmt.Sprintf("Failed to unmarshal translated JSON: %v (raw data: %s)", err, translatedRaw)})
 		return
 	}
+
+	// Ghép thông tin từ bước lọc từ vào từng từ đã dịch để hiển thị và lưu
+	for _, translatedWord := range translatedData.TranslatedWords {
+		word := details[strings.ToLower(strings.TrimSpace(translatedWord["vi"]))]
+		translatedWord["gloss"] = cleanMeta(translatedWord["gloss"], maxGlossLen)
+		translatedWord["pos"] = word.PartOfSpeech
+		translatedWord["example"] = word.Example
+		translatedWord["pronunciation"] = word.Pronunciation
+		translatedWord["difficulty"] = word.Difficulty
+	}
 	ctx.ViewData("translatedWords", translatedData.TranslatedWords)
 
 	// Save words and relations to database
@@ -131,14 +195,23 @@ func ProcessHandler(ctx iris.Context) {
 		viWord := translatedWord["vi"]
 		enWord := translatedWord["en"]
 
-		wordModel := models.Word{Lang: "vi", Content: viWord, Translate: enWord}
+		wordModel := models.Word{
+			Lang:          "vi",
+			Content:       viWord,
+			Translate:     enWord,
+			Gloss:         translatedWord["gloss"],
+			PartOfSpeech:  translatedWord["pos"],
+			Pronunciation: translatedWord["pronunciation"],
+			Difficulty:    translatedWord["difficulty"],
+			Example:       translatedWord["example"],
+		}
 		wordID, err := saveWordToDB(wordModel)
 		if err != nil {
 			log.Printf("Failed to save word '%s' to DB: %v", viWord, err)
 			continue
 		}
 
-		if err := createWordDialogRelation(dialogID, wordID); err != nil {
+		if err := createWordDialogRelation(dialogID, wordID, wordModel.Example); err != nil {
 			log.Printf("Failed to create relation between dialog %d and word %d: %v", dialogID, wordID, err)
 		}
 	}
@@ -188,6 +261,64 @@ func callGroqAPI(apiKey, prompt string, responseFormat interface{}) (string, err
 	return respBody.Choices[0].Message.Content, nil
 }
 
+// cleanWordDetails bỏ các thông tin không hợp lệ; câu ví dụ phải có trong hội thoại
+func cleanWordDetails(word models.Word, dialog string) models.Word {
+	word.PartOfSpeech = strings.ToLower(strings.TrimSpace(word.PartOfSpeech))
+	if !slices.Contains(partsOfSpeech, word.PartOfSpeech) {
+		word.PartOfSpeech = ""
+	}
+	word.Difficulty = strings.ToUpper(strings.TrimSpace(word.Difficulty))
+	if !slices.Contains(difficultyLevels, word.Difficulty) {
+		word.Difficulty = ""
+	}
+	// 03_v2 ghi phiên âm vào lexicon PLS dưới dạng IPA nên giá trị không phải IPA bị bỏ
+	word.Pronunciation = cleanIPA(cleanMeta(word.Pronunciation, maxPronunciationLen))
+	word.Example = cleanMeta(word.Example, maxExampleLen)
+	if !strings.Contains(strings.ToLower(collapseSpaces(dialog)), strings.ToLower(word.Example)) {
+		word.Example = ""
+	}
+	return word
+}
+
+// cleanIPA bỏ cặp /.../ hoặc [...] bao ngoài phiên âm; trả về chuỗi rỗng nếu có ký tự
+// không thuộc bảng chữ cái IPA (cùng quy tắc với pls.CleanIPA của 03_v2)
+func cleanIPA(value string) string {
+	value = strings.TrimSpace(value)
+	if len(value) >= 2 && (value[0] == '/' && value[len(value)-1] == '/' || value[0] == '[' && value[len(value)-1] == ']') {
+		value = strings.TrimSpace(value[1 : len(value)-1])
+	}
+	if strings.IndexFunc(value, func(r rune) bool { return !isIPA(r) }) >= 0 || strings.IndexFunc(value, unicode.IsLetter) < 0 {
+		return ""
+	}
+	return value
+}
+
+func isIPA(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return true
+	case r >= 0x0250 && r <= 0x02FF: // IPA Extensions, Spacing Modifier Letters
+		return true
+	case r >= 0x0300 && r <= 0x036F: // dấu phụ kết hợp
+		return true
+	case r >= 0x1D00 && r <= 0x1DBF: // Phonetic Extensions
+		return true
+	}
+	return strings.ContainsRune("æçðøħŋœβθχⁿ .|‖‿", r)
+}
+
+func cleanMeta(value string, maxLen int) string {
+	value = collapseSpaces(value)
+	if utf8.RuneCountInString(value) > maxLen {
+		return ""
+	}
+	return value
+}
+
+func collapseSpaces(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
 func extractDialog(raw string) string {
 	thinkEnd := strings.Index(raw, "</think>")
 	if thinkEnd != -1 {
@@ -206,13 +337,45 @@ func saveWordToDB(word models.Word) (int64, error) {
 	var id int64
 	err := database.DB.QueryRow("SELECT id FROM word WHERE content = $1 AND lang = $2", word.Content, word.Lang).Scan(&id)
 	if err == nil {
-		return id, nil
+		// Từ đã có chỉ được bổ sung thông tin còn trống
+		_, err = database.DB.Exec(`UPDATE word SET
+			part_of_speech = CASE WHEN part_of_speech = '' THEN $2 ELSE part_of_speech END,
+			pronunciation = CASE WHEN pronunciation = '' THEN $3 ELSE pronunciation END,
+			difficulty = CASE WHEN difficulty = '' THEN $4 ELSE difficulty END
+			WHERE id = $1`, id, word.PartOfSpeech, word.Pronunciation, word.Difficulty)
+	} else {
+		err = database.DB.QueryRow(`INSERT INTO word (lang, content, translate, part_of_speech, pronunciation, difficulty)
+			VALUES ($1, $2, '', $3, $4, $5) RETURNING id`,
+			word.Lang, word.Content, word.PartOfSpeech, word.Pronunciation, word.Difficulty).Scan(&id)
 	}
-	err = database.DB.QueryRow("INSERT INTO word (lang, content, translate) VALUES ($1, $2, $3) RETURNING id", word.Lang, word.Content, word.Translate).Scan(&id)
-	return id, err
+	if err != nil {
+		return id, err
+	}
+	return id, saveWordTranslation(id, "en", word.Translate, word.Gloss)
+}
+
+// saveWordTranslation lưu bản dịch và giải nghĩa vào word_translation như ứng dụng 03_v2;
+// bản dịch đã có chỉ được bổ sung giải nghĩa còn trống
+func saveWordTranslation(wordID int64, lang, text, gloss string) error {
+	if strings.TrimSpace(text) == "" {
+		return nil
+	}
+	var exists bool
+	err := database.DB.QueryRow("SELECT EXISTS (SELECT 1 FROM word_translation WHERE word_id = $1 AND lang = $2)", wordID, lang).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		_, err = database.DB.Exec("INSERT INTO word_translation (word_id, lang, text, gloss) VALUES ($1, $2, $3, $4)", wordID, lang, text, gloss)
+		return err
+	}
+	_, err = database.DB.Exec(`UPDATE word_translation SET gloss = $3, updated_at = NOW()
+		WHERE word_id = $1 AND lang = $2 AND gloss = ''`, wordID, lang, gloss)
+	return err
 }
 
-func createWordDialogRelation(dialogID, wordID int64) error {
-	_, err := database.DB.Exec("INSERT INTO word_dialog (dialog_id, word_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", dialogID, wordID)
+func createWordDialogRelation(dialogID, wordID int64, example string) error {
+	_, err := database.DB.Exec(`INSERT INTO word_dialog (dialog_id, word_id, example) VALUES ($1, $2, $3)
+		ON CONFLICT (dialog_id, word_id) DO UPDATE SET example = EXCLUDED.example WHERE EXCLUDED.example <> ''`, dialogID, wordID, example)
 	return err
 }
@@ -9,10 +9,15 @@ type Dialog struct {
 
 // Word struct represents the 'word' table
 type Word struct {
-	ID        int64
-	Lang      string
-	Content   string
-	Translate string
+	ID            int64
+	Lang          string
+	Content       string
+	Translate     string // bản dịch tiếng Anh, lưu trong word_translation
+	Gloss         string // giải nghĩa ngắn bằng tiếng Anh, lưu trong word_translation
+	PartOfSpeech  string
+	Pronunciation string // phiên âm IPA
+	Difficulty    string // cấp độ CEFR (A1–C2)
+	Example       string // câu ví dụ trong hội thoại, lưu trong word_dialog
 }
 
 // WordDialog struct represents the 'word_dialog' table (no explicit fields needed as it's a join table)
@@ -0,0 +1,285 @@
+package anki
+
+import (
+	"archive/zip"
+	"crypto/sha1"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // driver SQLite thuần Go, không cần cgo
+)
+
+// ContentType là kiểu MIME của gói Anki
+const ContentType = "application/apkg"
+
+// modelID cố định để nhập lại nhiều lần vẫn dùng chung một note type trong Anki
+const modelID int64 = 1700000000001
+
+// deckIDBase cộng với id của deck trong cơ sở dữ liệu cho id deck trong Anki
+const deckIDBase int64 = 1700000000000000
+
+// Các trường của note type theo đúng thứ tự trong notes.flds
+var fieldNames = []string{"Front", "Back", "Pronunciation", "Example", "Notes"}
+
+// Mẫu thẻ: mặt trước là từ và phiên âm, mặt sau thêm nghĩa, câu ví dụ và ghi chú
+const (
+	frontTemplate = `<div class="front">{{Front}}</div>
+{{#Pronunciation}}<div class="pron">/{{Pronunciation}}/</div>{{/Pronunciation}}`
+	backTemplate = `{{FrontSide}}
+<hr id="answer">
+<div class="back">{{Back}}</div>
+{{#Example}}<div class="example">{{Example}}</div>{{/Example}}
+{{#Notes}}<div class="notes">{{Notes}}</div>{{/Notes}}`
+	cardCSS = `.card { font-family: arial; font-size: 22px; text-align: center; color: black; background-color: white; }
+.front { font-size: 32px; }
+.pron, .notes { color: #666; font-size: 18px; }
+.example { font-style: italic; margin-top: 12px; }`
+)
+
+// Note là một thẻ cần xuất. Key phải ổn định (ví dụ id từ và id nghĩa) để khi nhập lại
+// Anki cập nhật note đã có thay vì tạo bản trùng.
+type Note struct {
+	Key           string
+	Front         string
+	Back          string
+	Pronunciation string
+	Example       string
+	Notes         string
+	Tags          []string
+}
+
+// Deck là một bộ thẻ cần xuất
+type Deck struct {
+	ID          int64 // id trong cơ sở dữ liệu, dùng để tạo id deck ổn định trong Anki
+	Name        string
+	Description string
+	Notes       []Note
+}
+
+// WritePackage ghi deck thành gói .apkg: file zip gồm collection.anki2 (SQLite, schema 11)
+// và file media (không có tệp đa phương tiện nào)
+func WritePackage(w io.Writer, deck Deck, now time.Time) error {
+	dir, err := os.MkdirTemp("", "apkg-*")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "collection.anki2")
+	if err := writeCollection(path, deck, now); err != nil {
+		return fmt.Errorf("write collection: %w", err)
+	}
+	collection, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	zw := zip.NewWriter(w)
+	f, err := zw.Create("collection.anki2")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(collection); err != nil {
+		return err
+	}
+	f, err = zw.Create("media")
+	if err != nil {
+		return err
+	}
+	if _, err := io.WriteString(f, "{}"); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func writeCollection(path string, deck Deck, now time.Time) error {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, stmt := range schema {
+		if _, err := tx.Exec(stmt); err != nil {
+			return err
+		}
+	}
+
+	sec, ms := now.Unix(), now.UnixMilli()
+	deckID := deckIDBase + deck.ID
+	conf, models, decks, dconf, err := collectionJSON(deck, deckID, sec)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO col (id, crt, mod, scm, ver, dty, usn, ls, conf, models, decks, dconf, tags)
+		VALUES (1, ?, ?, ?, 11, 0, 0, 0, ?, ?, ?, ?, '{}')`, dayStart(now), ms, ms, conf, models, decks, dconf)
+	if err != nil {
+		return err
+	}
+
+	for i, note := range deck.Notes {
+		// id của note và thẻ là mốc thời gian tính bằng mili giây, mỗi note một giá trị khác nhau
+		id := ms + int64(i)
+		fields := []string{note.Front, note.Back, note.Pronunciation, note.Example, note.Notes}
+		for k, field := range fields {
+			fields[k] = fieldHTML(field)
+		}
+		sortField := stripHTML(fields[0])
+		// Thẻ (tag) của Anki phân tách bởi dấu cách nên dấu cách trong một thẻ được thay bằng "_"
+		var tagList []string
+		for _, tag := range note.Tags {
+			if tag = strings.Join(strings.Fields(tag), "_"); tag != "" {
+				tagList = append(tagList, tag)
+			}
+		}
+		tags := ""
+		if len(tagList) > 0 {
+			tags = " " + strings.Join(tagList, " ") + " "
+		}
+		_, err := tx.Exec(`INSERT INTO notes (id, guid, mid, mod, usn, tags, flds, sfld, csum, flags, data)
+			VALUES (?, ?, ?, ?, -1, ?, ?, ?, ?, 0, '')`,
+			id, guid(note.Key), modelID, sec, tags, strings.Join(fields, "\x1f"), sortField, checksum(sortField))
+		if err != nil {
+			return err
+		}
+		// Thẻ mới (type 0, queue 0), due là thứ tự học
+		_, err = tx.Exec(`INSERT INTO cards (id, nid, did, ord, mod, usn, type, queue, due, ivl, factor, reps, lapses, left, odue, odid, flags, data)
+			VALUES (?, ?, ?, 0, ?, -1, 0, 0, ?, 0, 0, 0, 0, 0, 0, 0, 0, '')`, id, id, deckID, sec, i+1)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// collectionJSON tạo các cột JSON của bảng col: cấu hình, note type, deck và tuỳ chọn deck
+func collectionJSON(deck Deck, deckID, mod int64) (conf, models, decks, dconf string, err error) {
+	fields := make([]map[string]interface{}, len(fieldNames))
+	for i, name := range fieldNames {
+		fields[i] = map[string]interface{}{
+			"name": name, "ord": i, "sticky": false, "rtl": false, "font": "Arial", "size": 20, "media": []string{},
+		}
+	}
+	model := map[string]interface{}{
+		"id": modelID, "name": "Vocabulary", "type": 0, "mod": mod, "usn": -1, "sortf": 0, "did": deckID,
+		"tmpls": []map[string]interface{}{{
+			"name": "Recognition", "ord": 0, "qfmt": frontTemplate, "afmt": backTemplate, "did": nil, "bqfmt": "", "bafmt": "",
+		}},
+		"flds":      fields,
+		"css":       cardCSS,
+		"latexPre":  "\\documentclass[12pt]{article}\n\\special{papersize=3in,5in}\n\\usepackage[utf8]{inputenc}\n\\usepackage{amssymb,amsmath}\n\\pagestyle{empty}\n\\setlength{\\parindent}{0in}\n\\begin{document}\n",
+		"latexPost": "\\end{document}",
+		"tags":      []string{},
+		"vers":      []interface{}{},
+		"req":       []interface{}{[]interface{}{0, "any", []int{0}}},
+	}
+	deckJSON := func(id int64, name, desc string) map[string]interface{} {
+		return map[string]interface{}{
+			"id": id, "name": name, "desc": desc, "mod": mod, "usn": -1, "conf": 1, "dyn": 0,
+			"collapsed": false, "browserCollapsed": false, "extendNew": 0, "extendRev": 0,
+			"newToday": []int{0, 0}, "revToday": []int{0, 0}, "lrnToday": []int{0, 0}, "timeToday": []int{0, 0},
+		}
+	}
+	options := map[string]interface{}{
+		"id": 1, "name": "Default", "mod": 0, "usn": 0, "maxTaken": 60, "autoplay": true, "timer": 0, "replayq": true, "dyn": false,
+		"new":   map[string]interface{}{"bury": false, "delays": []int{1, 10}, "initialFactor": 2500, "ints": []int{1, 4, 0}, "order": 1, "perDay": 20},
+		"lapse": map[string]interface{}{"delays": []int{10}, "leechAction": 1, "leechFails": 8, "minInt": 1, "mult": 0},
+		"rev":   map[string]interface{}{"bury": false, "ease4": 1.3, "ivlFct": 1, "maxIvl": 36500, "perDay": 200, "hardFactor": 1.2},
+	}
+	collectionConf := map[string]interface{}{
+		"activeDecks": []int64{deckID}, "curDeck": deckID, "curModel": strconv.FormatInt(modelID, 10), "nextPos": len(deck.Notes) + 1,
+		"newSpread": 0, "collapseTime": 1200, "timeLim": 0, "estTimes": true, "dueCounts": true,
+		"sortType": "noteFld", "sortBackwards": false, "addToCur": true,
+	}
+
+	parts := []interface{}{
+		collectionConf,
+		map[string]interface{}{strconv.FormatInt(modelID, 10): model},
+		map[string]interface{}{
+			"1":                           deckJSON(1, "Default", ""),
+			strconv.FormatInt(deckID, 10): deckJSON(deckID, deck.Name, deck.Description),
+		},
+		map[string]interface{}{"1": options},
+	}
+	out := make([]string, len(parts))
+	for i, part := range parts {
+		data, err := json.Marshal(part)
+		if err != nil {
+			return "", "", "", "", err
+		}
+		out[i] = string(data)
+	}
+	return out[0], out[1], out[2], out[3], nil
+}
+
+// fieldHTML chuyển văn bản thuần thành nội dung trường của Anki (HTML)
+func fieldHTML(s string) string {
+	return strings.ReplaceAll(html.EscapeString(strings.TrimSpace(s)), "\n", "<br>")
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// stripHTML bỏ thẻ HTML như Anki làm khi tính trường sắp xếp và checksum
+func stripHTML(s string) string {
+	return html.UnescapeString(htmlTag.ReplaceAllString(s, ""))
+}
+
+// checksum là 8 chữ số hex đầu của SHA-1 trường đầu tiên, đổi sang số nguyên (cột notes.csum)
+func checksum(s string) int64 {
+	sum := sha1.Sum([]byte(s))
+	n, _ := strconv.ParseInt(hex.EncodeToString(sum[:4]), 16, 64)
+	return n
+}
+
+// guid tạo guid của note từ khoá ổn định
+func guid(key string) string {
+	sum := sha1.Sum([]byte("vocabulary:" + key))
+	return base64.RawURLEncoding.EncodeToString(sum[:8])
+}
+
+// dayStart là mốc bắt đầu ngày của collection (giây), cột col.crt
+func dayStart(now time.Time) int64 {
+	y, m, d := now.Date()
+	return time.Date(y, m, d, 4, 0, 0, 0, now.Location()).Unix()
+}
+
+// schema là cấu trúc collection.anki2 (schema 11) mà Anki đọc được khi nhập gói
+var schema = []string{
+	`CREATE TABLE col (id integer primary key, crt integer not null, mod integer not null, scm integer not null,
+		ver integer not null, dty integer not null, usn integer not null, ls integer not null, conf text not null,
+		models text not null, decks text not null, dconf text not null, tags text not null)`,
+	`CREATE TABLE notes (id integer primary key, guid text not null, mid integer not null, mod integer not null,
+		usn integer not null, tags text not null, flds text not null, sfld integer not null, csum integer not null,
+		flags integer not null, data text not null)`,
+	`CREATE TABLE cards (id integer primary key, nid integer not null, did integer not null, ord integer not null,
+		mod integer not null, usn integer not null, type integer not null, queue integer not null, due integer not null,
+		ivl integer not null, factor integer not null, reps integer not null, lapses integer not null, left integer not null,
+		odue integer not null, odid integer not null, flags integer not null, data text not null)`,
+	`CREATE TABLE revlog (id integer primary key, cid integer not null, usn integer not null, ease integer not null,
+		ivl integer not null, lastIvl integer not null, factor integer not null, time integer not null, type integer not null)`,
+	`CREATE TABLE graves (usn integer not null, oid integer not null, type integer not null)`,
+	`CREATE INDEX ix_notes_usn ON notes (usn)`,
+	`CREATE INDEX ix_cards_usn ON cards (usn)`,
+	`CREATE INDEX ix_revlog_usn ON revlog (usn)`,
+	`CREATE INDEX ix_cards_nid ON cards (nid)`,
+	`CREATE INDEX ix_cards_sched ON cards (did, queue, due)`,
+	`CREATE INDEX ix_revlog_cid ON revlog (cid)`,
+	`CREATE INDEX ix_notes_csum ON notes (csum)`,
+}
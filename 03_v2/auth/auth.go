@@ -0,0 +1,86 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/iris-contrib/middleware/jwt"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// accessTokenType đánh dấu access token trong claim "typ"
+const accessTokenType = "access"
+
+// refreshTokenBytes là số byte ngẫu nhiên của một refresh token
+const refreshTokenBytes = 32
+
+// HashPassword băm mật khẩu bằng bcrypt với cost mặc định
+func HashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// CheckPassword cho biết password có khớp với mã băm đã lưu không
+func CheckPassword(hash, password string) bool {
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+}
+
+// NewAccessToken ký một access token HS256 cho người dùng userID, hết hạn sau ttl kể từ now
+func NewAccessToken(secret string, userID int64, ttl time.Duration, now time.Time) (string, time.Time, error) {
+	expires := now.Add(ttl)
+	token := jwt.NewTokenWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": strconv.FormatInt(userID, 10),
+		"typ": accessTokenType,
+		"iat": now.Unix(),
+		"exp": expires.Unix(),
+	})
+	signed, err := token.SignedString([]byte(secret))
+	return signed, expires, err
+}
+
+// KeyFunc trả về khoá kiểm tra chữ ký, chỉ chấp nhận token ký bằng HMAC
+func KeyFunc(secret string) func(*jwt.Token) (interface{}, error) {
+	return func(token *jwt.Token) (interface{}, error) {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, fmt.Errorf("unexpected signing method %v", token.Header["alg"])
+		}
+		return []byte(secret), nil
+	}
+}
+
+// UserID đọc id người dùng từ access token đã được kiểm tra chữ ký
+func UserID(token *jwt.Token) (int64, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || claims["typ"] != accessTokenType {
+		return 0, fmt.Errorf("not an access token")
+	}
+	sub, _ := claims["sub"].(string)
+	id, err := strconv.ParseInt(sub, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid subject %q", sub)
+	}
+	return id, nil
+}
+
+// NewRefreshToken tạo một refresh token ngẫu nhiên; chỉ mã băm (HashRefreshToken) được lưu
+func NewRefreshToken() (string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashRefreshToken trả về mã băm SHA-256 (hex) của refresh token để lưu và tra cứu
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,16 +1,41 @@
 package config
 
 import (
+	"encoding/json"
+	"fmt"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"vocabulary/models"
 
 	"github.com/joho/godotenv"
 )
 
+// minJWTSecretLen là độ dài tối thiểu của JWT_SECRET (256 bit cho HS256)
+const minJWTSecretLen = 32
+
 // Configuration struct định nghĩa các biến cấu hình
 type Configuration struct {
-	DatabaseURL string
-	GroqAPIKey  string
-	GroqAPIURL  string
+	DatabaseURL  string
+	GroqAPIKey   string
+	GroqAPIURL   string
+	DefaultVoice string
+	Voices       []models.Voice
+	Characters   []models.Character
+	LearnerRate  string
+	TTSProvider  string
+	TTSCommand   string
+	BlobStore    string
+	AudioDir     string
+	PublicURL    string
+	// Số worker chạy pipeline nền
+	PipelineWorkers int
+	// Khoá ký access token (HS256) và thời hạn của access token, refresh token
+	JWTSecret       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
 }
 
 // LoadConfig đọc cấu hình từ file .env hoặc biến môi trường
@@ -20,11 +45,106 @@ func LoadConfig() (*Configuration, error) {
 		// Nếu không tìm thấy file .env, thử đọc từ biến môi trường
 	}
 
-	return &Configuration{
-		DatabaseURL: getEnv("DATABASE_URL", ""),
-		GroqAPIKey:  getEnv("GROQ_API_KEY", ""),
-		GroqAPIURL:  getEnv("GROQ_API_URL", ""),
-	}, nil
+	cfg := &Configuration{
+		DatabaseURL:  getEnv("DATABASE_URL", ""),
+		GroqAPIKey:   getEnv("GROQ_API_KEY", ""),
+		GroqAPIURL:   getEnv("GROQ_API_URL", ""),
+		DefaultVoice: getEnv("SSML_DEFAULT_VOICE", "vi-VN-HoaiMyNeural"),
+		Voices:       defaultVoices,
+		Characters:   defaultCharacters,
+		LearnerRate:  getEnv("SSML_LEARNER_RATE", "80%"),
+		TTSProvider:  getEnv("TTS_PROVIDER", "fake"),
+		TTSCommand:   getEnv("TTS_COMMAND", "espeak-ng"),
+		BlobStore:    getEnv("BLOB_STORE", "local"),
+		AudioDir:     getEnv("AUDIO_DIR", "./data/audio"),
+		PublicURL:    strings.TrimRight(getEnv("PUBLIC_URL", "http://localhost:8080"), "/"),
+		JWTSecret:    getEnv("JWT_SECRET", ""),
+	}
+
+	// Không có khoá mặc định: một khoá viết sẵn trong mã nguồn cho phép bất kỳ ai tự ký token
+	if len(cfg.JWTSecret) < minJWTSecretLen {
+		return nil, fmt.Errorf("JWT_SECRET must be set to at least %d characters", minJWTSecretLen)
+	}
+	cfg.AccessTokenTTL, err = getEnvDuration("ACCESS_TOKEN_TTL", 15*time.Minute)
+	if err != nil {
+		return nil, err
+	}
+	cfg.RefreshTokenTTL, err = getEnvDuration("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg.PipelineWorkers, err = getEnvInt("PIPELINE_WORKERS", 2)
+	if err != nil {
+		return nil, err
+	}
+
+	// SSML_VOICES chỉ liệt kê tên giọng; ngôn ngữ được suy ra từ tên (vi-VN-HoaiMyNeural -> vi-VN)
+	if names := getEnvList("SSML_VOICES", nil); len(names) > 0 {
+		cfg.Voices = nil
+		for _, name := range names {
+			cfg.Voices = append(cfg.Voices, models.Voice{Name: name, Lang: voiceLang(name), DisplayName: name})
+		}
+	}
+
+	// CATALOG_FILE là file JSON dạng {"voices": [...], "characters": [...]} dùng để khởi tạo danh mục
+	if path := getEnv("CATALOG_FILE", ""); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read catalog file: %w", err)
+		}
+		var catalog struct {
+			Voices     []models.Voice     `json:"voices"`
+			Characters []models.Character `json:"characters"`
+		}
+		if err := json.Unmarshal(data, &catalog); err != nil {
+			return nil, fmt.Errorf("failed to parse catalog file: %w", err)
+		}
+		if len(catalog.Voices) > 0 {
+			cfg.Voices = catalog.Voices
+		}
+		if len(catalog.Characters) > 0 {
+			cfg.Characters = catalog.Characters
+		}
+	}
+
+	return cfg, nil
+}
+
+// defaultVoices là danh mục giọng đọc mặc định, giống các lựa chọn trong trang 02
+var defaultVoices = []models.Voice{
+	{Name: "en-US-AndrewMultilingualNeural", Lang: "en-US", Gender: "male", Style: "conversational", DisplayName: "Andrew (EN)"},
+	{Name: "en-US-ChristopherNeural", Lang: "en-US", Gender: "male", Style: "reliable", DisplayName: "Christopher (EN)"},
+	{Name: "en-US-EricNeural", Lang: "en-US", Gender: "male", Style: "rational", DisplayName: "Eric (EN)"},
+	{Name: "vi-VN-HoaiMyNeural", Lang: "vi-VN", Gender: "female", Style: "friendly", DisplayName: "Hoai My (VN)"},
+	{Name: "vi-VN-NamMinhNeural", Lang: "vi-VN", Gender: "male", Style: "friendly", DisplayName: "Nam Minh (VN)"},
+}
+
+// defaultCharacters là các nhân vật của hội thoại mặc định (hỏi đường đến hồ Hoàn Kiếm)
+var defaultCharacters = []models.Character{
+	{
+		Name:         "James",
+		Nationality:  "Mỹ",
+		Gender:       "male",
+		Persona:      "khách du lịch người Mỹ mới đến Hà Nội, nói tiếng Việt đơn giản và lịch sự",
+		DefaultVoice: "en-US-AndrewMultilingualNeural",
+	},
+	{
+		Name:         "Lan",
+		Nationality:  "Việt Nam",
+		Gender:       "female",
+		Persona:      "sinh viên người Hà Nội thân thiện, nhiệt tình chỉ đường cho khách du lịch",
+		DefaultVoice: "vi-VN-HoaiMyNeural",
+	},
+}
+
+// voiceLang lấy mã ngôn ngữ từ tên giọng dạng "<lang>-<region>-<Name>"
+func voiceLang(name string) string {
+	parts := strings.Split(name, "-")
+	if len(parts) < 3 {
+		return ""
+	}
+	return parts[0] + "-" + parts[1]
 }
 
 func getEnv(key string, defaultVal string) string {
@@ -33,3 +153,47 @@ func getEnv(key string, defaultVal string) string {
 	}
 	return defaultVal
 }
+
+// getEnvInt đọc một số nguyên, trả lỗi nếu giá trị không hợp lệ
+func getEnvInt(key string, defaultVal int) (int, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || strings.TrimSpace(value) == "" {
+		return defaultVal, nil
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	return n, nil
+}
+
+// getEnvDuration đọc một khoảng thời gian dạng "15m", "720h", trả lỗi nếu giá trị không hợp lệ hoặc không dương
+func getEnvDuration(key string, defaultVal time.Duration) (time.Duration, error) {
+	value, exists := os.LookupEnv(key)
+	if !exists || strings.TrimSpace(value) == "" {
+		return defaultVal, nil
+	}
+	d, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, value, err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be positive", key, value)
+	}
+	return d, nil
+}
+
+// getEnvList đọc một danh sách phân tách bởi dấu phẩy
+func getEnvList(key string, defaultVal []string) []string {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return defaultVal
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
@@ -7,6 +7,9 @@ import (
 	"net/url"
 	"strings"
 
+	"vocabulary/models"
+	"vocabulary/textnorm"
+
 	_ "github.com/lib/pq" // Import the PostgreSQL driver
 )
 
@@ -86,21 +89,73 @@ func createDatabaseIfNotExists(serverURL, dbName string) error {
 }
 
 func createTablesIfNotExists() error {
+	// SQL lệnh tạo bảng app_user (tài khoản người dùng; "user" là từ khoá của PostgreSQL)
+	appUserTableSQL := `
+	CREATE TABLE IF NOT EXISTS app_user (
+		id BIGSERIAL PRIMARY KEY,
+		email VARCHAR(254) NOT NULL UNIQUE,
+		password_hash TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	// SQL lệnh tạo bảng refresh_token (chỉ lưu mã băm SHA-256 của token)
+	refreshTokenTableSQL := `
+	CREATE TABLE IF NOT EXISTS refresh_token (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES app_user(id) ON DELETE CASCADE,
+		token_hash CHAR(64) NOT NULL UNIQUE,
+		expires_at TIMESTAMPTZ NOT NULL,
+		revoked_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
 	// SQL lệnh tạo bảng dialog
 	dialogTableSQL := `
 	CREATE TABLE IF NOT EXISTS dialog (
 		id BIGSERIAL PRIMARY KEY,
-		lang VARCHAR(2) NOT NULL,
+		lang VARCHAR(35) NOT NULL,
 		content TEXT NOT NULL
 	);`
 
+	// SQL lệnh tạo bảng dialog_turn (các lượt nói đã tách từ nội dung hội thoại)
+	dialogTurnTableSQL := `
+	CREATE TABLE IF NOT EXISTS dialog_turn (
+		dialog_id BIGINT REFERENCES dialog(id) ON DELETE CASCADE,
+		ordinal INT NOT NULL,
+		speaker TEXT NOT NULL,
+		text TEXT NOT NULL,
+		line INT NOT NULL,
+		PRIMARY KEY (dialog_id, ordinal)
+	);`
+
 	// SQL lệnh tạo bảng word
 	wordTableSQL := `
 	CREATE TABLE IF NOT EXISTS word (
 		id BIGSERIAL PRIMARY KEY,
-		lang VARCHAR(2) NOT NULL,
+		lang VARCHAR(35) NOT NULL,
 		content TEXT NOT NULL,
-		translate TEXT NOT NULL
+		translate TEXT NOT NULL DEFAULT ''
+	);`
+
+	// SQL lệnh tạo bảng word_sense (các nghĩa của một từ; bản dịch và liên kết hội thoại gắn với nghĩa)
+	wordSenseTableSQL := `
+	CREATE TABLE IF NOT EXISTS word_sense (
+		id BIGSERIAL PRIMARY KEY,
+		word_id BIGINT NOT NULL REFERENCES word(id) ON DELETE CASCADE,
+		part_of_speech VARCHAR(16) NOT NULL DEFAULT '',
+		needs_review BOOLEAN NOT NULL DEFAULT FALSE,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	// SQL lệnh tạo bảng word_translation (bản dịch của một nghĩa sang từng ngôn ngữ)
+	wordTranslationTableSQL := `
+	CREATE TABLE IF NOT EXISTS word_translation (
+		word_id BIGINT NOT NULL REFERENCES word(id) ON DELETE CASCADE,
+		sense_id BIGINT REFERENCES word_sense(id) ON DELETE CASCADE,
+		lang VARCHAR(35) NOT NULL,
+		text TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
 	);`
 
 	// SQL lệnh tạo bảng word_dialog
@@ -111,23 +166,470 @@ func createTablesIfNotExists() error {
 		PRIMARY KEY (dialog_id, word_id)
 	);`
 
-	_, err := DB.Exec(dialogTableSQL)
+	// SQL lệnh tạo bảng user_word (từ vựng của từng người dùng)
+	userWordTableSQL := `
+	CREATE TABLE IF NOT EXISTS user_word (
+		user_id BIGINT NOT NULL REFERENCES app_user(id) ON DELETE CASCADE,
+		word_id BIGINT NOT NULL REFERENCES word(id) ON DELETE CASCADE,
+		added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (user_id, word_id)
+	);`
+
+	// SQL lệnh tạo bảng word_occurrence (vị trí của từ trong từng lượt nói, tính theo ký tự)
+	wordOccurrenceTableSQL := `
+	CREATE TABLE IF NOT EXISTS word_occurrence (
+		dialog_id BIGINT NOT NULL,
+		ordinal INT NOT NULL,
+		start_offset INT NOT NULL,
+		end_offset INT NOT NULL,
+		word_id BIGINT NOT NULL REFERENCES word(id) ON DELETE CASCADE,
+		surface TEXT NOT NULL,
+		PRIMARY KEY (dialog_id, ordinal, start_offset),
+		FOREIGN KEY (dialog_id, ordinal) REFERENCES dialog_turn(dialog_id, ordinal) ON DELETE CASCADE
+	);`
+
+	// SQL lệnh tạo bảng review_card (trạng thái ôn tập SM-2 của từng từ với từng người học)
+	reviewCardTableSQL := `
+	CREATE TABLE IF NOT EXISTS review_card (
+		learner VARCHAR(64) NOT NULL,
+		word_id BIGINT NOT NULL REFERENCES word(id) ON DELETE CASCADE,
+		ease DOUBLE PRECISION NOT NULL,
+		interval_days INT NOT NULL DEFAULT 0,
+		repetitions INT NOT NULL DEFAULT 0,
+		lapses INT NOT NULL DEFAULT 0,
+		due_at TIMESTAMPTZ NOT NULL,
+		last_reviewed_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (learner, word_id)
+	);`
+
+	// SQL lệnh tạo bảng review_log (lịch sử các lần ôn tập)
+	reviewLogTableSQL := `
+	CREATE TABLE IF NOT EXISTS review_log (
+		id BIGSERIAL PRIMARY KEY,
+		learner VARCHAR(64) NOT NULL,
+		word_id BIGINT NOT NULL REFERENCES word(id) ON DELETE CASCADE,
+		grade SMALLINT NOT NULL,
+		ease DOUBLE PRECISION NOT NULL,
+		interval_days INT NOT NULL,
+		due_at TIMESTAMPTZ NOT NULL,
+		reviewed_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	// SQL lệnh tạo bảng deck (bộ thẻ từ vựng của người dùng)
+	deckTableSQL := `
+	CREATE TABLE IF NOT EXISTS deck (
+		id BIGSERIAL PRIMARY KEY,
+		user_id BIGINT NOT NULL REFERENCES app_user(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		dialog_id BIGINT REFERENCES dialog(id) ON DELETE SET NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (user_id, name)
+	);`
+
+	// SQL lệnh tạo bảng deck_word (các từ trong bộ thẻ, kèm nghĩa và câu ví dụ dùng cho thẻ)
+	deckWordTableSQL := `
+	CREATE TABLE IF NOT EXISTS deck_word (
+		deck_id BIGINT NOT NULL REFERENCES deck(id) ON DELETE CASCADE,
+		word_id BIGINT NOT NULL REFERENCES word(id) ON DELETE CASCADE,
+		sense_id BIGINT REFERENCES word_sense(id) ON DELETE SET NULL,
+		example TEXT NOT NULL DEFAULT '',
+		added_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (deck_id, word_id)
+	);`
+
+	// SQL lệnh tạo bảng exercise_set (bộ bài tập sinh từ hội thoại, gồm cả đáp án)
+	exerciseSetTableSQL := `
+	CREATE TABLE IF NOT EXISTS exercise_set (
+		id BIGSERIAL PRIMARY KEY,
+		dialog_id BIGINT NOT NULL REFERENCES dialog(id) ON DELETE CASCADE,
+		seed BIGINT NOT NULL,
+		lang VARCHAR(35) NOT NULL,
+		kinds TEXT[] NOT NULL,
+		items JSONB NOT NULL,
+		created_by BIGINT REFERENCES app_user(id) ON DELETE SET NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	);`
+
+	// SQL lệnh tạo bảng dialog_voice (ánh xạ người nói -> giọng đọc cho từng hội thoại)
+	dialogVoiceTableSQL := `
+	CREATE TABLE IF NOT EXISTS dialog_voice (
+		dialog_id BIGINT REFERENCES dialog(id) ON DELETE CASCADE,
+		speaker TEXT NOT NULL,
+		voice TEXT NOT NULL,
+		PRIMARY KEY (dialog_id, speaker)
+	);`
+
+	// SQL lệnh tạo bảng dialog_audio (âm thanh của từng câu thoại)
+	dialogAudioTableSQL := `
+	CREATE TABLE IF NOT EXISTS dialog_audio (
+		dialog_id BIGINT REFERENCES dialog(id) ON DELETE CASCADE,
+		ordinal INT NOT NULL,
+		speaker TEXT NOT NULL,
+		text TEXT NOT NULL,
+		voice TEXT NOT NULL,
+		provider TEXT NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		blob_key TEXT NOT NULL DEFAULT '',
+		content_type TEXT NOT NULL DEFAULT '',
+		duration_ms BIGINT NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (dialog_id, ordinal)
+	);`
+
+	// SQL lệnh tạo bảng dialog_audio_mark (mốc thời gian của từng từ trong âm thanh)
+	dialogAudioMarkTableSQL := `
+	CREATE TABLE IF NOT EXISTS dialog_audio_mark (
+		dialog_id BIGINT NOT NULL,
+		ordinal INT NOT NULL,
+		mark_index INT NOT NULL,
+		name TEXT NOT NULL,
+		token TEXT NOT NULL,
+		offset_ms BIGINT NOT NULL,
+		PRIMARY KEY (dialog_id, ordinal, mark_index),
+		FOREIGN KEY (dialog_id, ordinal) REFERENCES dialog_audio(dialog_id, ordinal) ON DELETE CASCADE
+	);`
+
+	// SQL lệnh tạo bảng dialog_line_translation (bản dịch của từng câu thoại)
+	dialogLineTranslationTableSQL := `
+	CREATE TABLE IF NOT EXISTS dialog_line_translation (
+		dialog_id BIGINT REFERENCES dialog(id) ON DELETE CASCADE,
+		ordinal INT NOT NULL,
+		lang VARCHAR(35) NOT NULL,
+		text TEXT NOT NULL,
+		PRIMARY KEY (dialog_id, ordinal, lang)
+	);`
+
+	// SQL lệnh tạo bảng lexicon_override (cách phát âm nhập tay, ưu tiên hơn bảng word)
+	lexiconOverrideTableSQL := `
+	CREATE TABLE IF NOT EXISTS lexicon_override (
+		id BIGSERIAL PRIMARY KEY,
+		lang VARCHAR(35) NOT NULL,
+		grapheme TEXT NOT NULL,
+		alias TEXT NOT NULL DEFAULT '',
+		phoneme TEXT NOT NULL DEFAULT '',
+		UNIQUE (lang, grapheme),
+		CHECK (alias <> '' OR phoneme <> '')
+	);`
+
+	// SQL lệnh tạo bảng voice (danh mục giọng đọc)
+	voiceTableSQL := `
+	CREATE TABLE IF NOT EXISTS voice (
+		name TEXT PRIMARY KEY,
+		lang VARCHAR(35) NOT NULL,
+		gender TEXT NOT NULL DEFAULT '',
+		style TEXT NOT NULL DEFAULT '',
+		display_name TEXT NOT NULL DEFAULT ''
+	);`
+
+	// SQL lệnh tạo bảng character_profile (nhân vật dùng chung cho sinh hội thoại và SSML)
+	characterProfileTableSQL := `
+	CREATE TABLE IF NOT EXISTS character_profile (
+		id BIGSERIAL PRIMARY KEY,
+		name TEXT NOT NULL UNIQUE,
+		nationality TEXT NOT NULL DEFAULT '',
+		gender TEXT NOT NULL DEFAULT '',
+		persona TEXT NOT NULL DEFAULT '',
+		default_voice TEXT REFERENCES voice(name) ON UPDATE CASCADE ON DELETE SET NULL
+	);`
+
+	// SQL lệnh tạo bảng pipeline_job (các lần chạy pipeline nền)
+	pipelineJobTableSQL := `
+	CREATE TABLE IF NOT EXISTS pipeline_job (
+		id BIGSERIAL PRIMARY KEY,
+		status VARCHAR(16) NOT NULL,
+		params JSONB NOT NULL,
+		dialog_id BIGINT REFERENCES dialog(id) ON DELETE SET NULL,
+		attempts INT NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		started_at TIMESTAMPTZ,
+		finished_at TIMESTAMPTZ
+	);`
+
+	// SQL lệnh tạo bảng pipeline_stage (trạng thái và kết quả của từng bước trong pipeline)
+	pipelineStageTableSQL := `
+	CREATE TABLE IF NOT EXISTS pipeline_stage (
+		job_id BIGINT REFERENCES pipeline_job(id) ON DELETE CASCADE,
+		ordinal INT NOT NULL,
+		name TEXT NOT NULL,
+		status VARCHAR(16) NOT NULL,
+		output JSONB,
+		error TEXT NOT NULL DEFAULT '',
+		started_at TIMESTAMPTZ,
+		finished_at TIMESTAMPTZ,
+		PRIMARY KEY (job_id, name)
+	);`
+
+	tables := []struct {
+		name string
+		sql  string
+	}{
+		{"App_user", appUserTableSQL},
+		{"Refresh_token", refreshTokenTableSQL},
+		{"Dialog", dialogTableSQL},
+		{"Dialog_turn", dialogTurnTableSQL},
+		{"Word", wordTableSQL},
+		{"Word_sense", wordSenseTableSQL},
+		{"Word_translation", wordTranslationTableSQL},
+		{"Word_dialog", wordDialogTableSQL},
+		{"User_word", userWordTableSQL},
+		{"Word_occurrence", wordOccurrenceTableSQL},
+		{"Review_card", reviewCardTableSQL},
+		{"Review_log", reviewLogTableSQL},
+		{"Deck", deckTableSQL},
+		{"Deck_word", deckWordTableSQL},
+		{"Exercise_set", exerciseSetTableSQL},
+		{"Dialog_voice", dialogVoiceTableSQL},
+		{"Dialog_audio", dialogAudioTableSQL},
+		{"Dialog_audio_mark", dialogAudioMarkTableSQL},
+		{"Dialog_line_translation", dialogLineTranslationTableSQL},
+		{"Lexicon_override", lexiconOverrideTableSQL},
+		{"Voice", voiceTableSQL},
+		{"Character_profile", characterProfileTableSQL},
+		{"Pipeline_job", pipelineJobTableSQL},
+		{"Pipeline_stage", pipelineStageTableSQL},
+	}
+
+	for _, table := range tables {
+		if _, err := DB.Exec(table.sql); err != nil {
+			return fmt.Errorf("failed to create %s table: %w", strings.ToLower(table.name), err)
+		}
+		log.Printf("%s table created or already exists", table.name)
+	}
+
+	// Các thay đổi cấu trúc cho bảng đã tồn tại, phải chạy được nhiều lần
+	migrations := []string{
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS pronunciation TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS topic TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS setting TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS characters TEXT[] NOT NULL DEFAULT '{}'`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS turns INT NOT NULL DEFAULT 0`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS level VARCHAR(2) NOT NULL DEFAULT ''`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS register VARCHAR(16) NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS dialog_level_idx ON dialog (level)`,
+		`CREATE INDEX IF NOT EXISTS dialog_topic_idx ON dialog (topic)`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS raw TEXT NOT NULL DEFAULT ''`,
+		`CREATE INDEX IF NOT EXISTS dialog_turn_speaker_idx ON dialog_turn (dialog_id, speaker)`,
+		`CREATE INDEX IF NOT EXISTS pipeline_job_pending_idx ON pipeline_job (id) WHERE status = 'pending'`,
+		// Mã ngôn ngữ BCP-47 (ví dụ "zh-Hant-TW") dài hơn 2 ký tự
+		`ALTER TABLE dialog ALTER COLUMN lang TYPE VARCHAR(35)`,
+		`ALTER TABLE word ALTER COLUMN lang TYPE VARCHAR(35)`,
+		`ALTER TABLE dialog_line_translation ALTER COLUMN lang TYPE VARCHAR(35)`,
+		`ALTER TABLE lexicon_override ALTER COLUMN lang TYPE VARCHAR(35)`,
+		// Bản dịch tiếng Anh cũ trong word.translate được chuyển sang word_translation rồi xoá khỏi
+		// word.translate, để bản dịch đã xoá không quay lại ở lần khởi động sau; cột translate được
+		// giữ lại cho dữ liệu cũ, ứng dụng 03 nay cũng ghi bản dịch vào word_translation
+		`ALTER TABLE word ALTER COLUMN translate SET DEFAULT ''`,
+		`WITH pending AS (
+				SELECT id, translate FROM word WHERE translate <> ''
+			), copied AS (
+				INSERT INTO word_translation (word_id, lang, text)
+				SELECT id, 'en', translate FROM pending
+				WHERE NOT EXISTS (SELECT 1 FROM word_translation t WHERE t.word_id = pending.id AND t.lang = 'en')
+			)
+			UPDATE word SET translate = '' FROM pending WHERE word.id = pending.id`,
+		// Khoá chuẩn hoá (textnorm.Normalize) để không lưu trùng một từ; ứng dụng 03 không ghi
+		// cột này nên khoá rỗng được điền khi khởi động và không nằm trong unique index
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS norm_key TEXT NOT NULL DEFAULT ''`,
+		// Thông tin cho người học; câu ví dụ gắn với hội thoại nên nằm trong word_dialog
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS part_of_speech VARCHAR(16) NOT NULL DEFAULT ''`,
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS difficulty VARCHAR(2) NOT NULL DEFAULT ''`,
+		`ALTER TABLE word_translation ADD COLUMN IF NOT EXISTS gloss TEXT NOT NULL DEFAULT ''`,
+		`ALTER TABLE word_dialog ADD COLUMN IF NOT EXISTS example TEXT NOT NULL DEFAULT ''`,
+		// Mỗi bản dịch thuộc về một nghĩa; bản dịch chưa có nghĩa được gắn vào nghĩa đầu tiên của từ
+		`ALTER TABLE word_translation ADD COLUMN IF NOT EXISTS sense_id BIGINT REFERENCES word_sense(id) ON DELETE CASCADE`,
+		`ALTER TABLE word_dialog ADD COLUMN IF NOT EXISTS sense_id BIGINT REFERENCES word_sense(id) ON DELETE SET NULL`,
+		`CREATE INDEX IF NOT EXISTS word_sense_word_idx ON word_sense (word_id)`,
+		`CREATE INDEX IF NOT EXISTS word_sense_review_idx ON word_sense (word_id) WHERE needs_review`,
+		`INSERT INTO word_sense (word_id, part_of_speech)
+			SELECT DISTINCT t.word_id, w.part_of_speech FROM word_translation t JOIN word w ON w.id = t.word_id
+			WHERE t.sense_id IS NULL AND NOT EXISTS (SELECT 1 FROM word_sense s WHERE s.word_id = t.word_id)`,
+		`UPDATE word_translation t SET sense_id = (SELECT MIN(s.id) FROM word_sense s WHERE s.word_id = t.word_id)
+			WHERE t.sense_id IS NULL`,
+		`UPDATE word_dialog wd SET sense_id = (SELECT MIN(s.id) FROM word_sense s WHERE s.word_id = wd.word_id)
+			WHERE wd.sense_id IS NULL`,
+		`ALTER TABLE word_translation DROP CONSTRAINT IF EXISTS word_translation_pkey`,
+		`CREATE UNIQUE INDEX IF NOT EXISTS word_translation_sense_lang_idx ON word_translation (sense_id, lang)`,
+		`CREATE INDEX IF NOT EXISTS word_translation_word_idx ON word_translation (word_id)`,
+		`CREATE INDEX IF NOT EXISTS word_occurrence_word_idx ON word_occurrence (word_id)`,
+		`CREATE INDEX IF NOT EXISTS review_card_due_idx ON review_card (learner, due_at)`,
+		`CREATE INDEX IF NOT EXISTS review_log_learner_idx ON review_log (learner, word_id, reviewed_at)`,
+		// Người tạo; bản ghi cũ và bản ghi của ứng dụng 03 không có người tạo
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS created_by BIGINT REFERENCES app_user(id) ON DELETE SET NULL`,
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS created_by BIGINT REFERENCES app_user(id) ON DELETE SET NULL`,
+		`ALTER TABLE pipeline_job ADD COLUMN IF NOT EXISTS created_by BIGINT REFERENCES app_user(id) ON DELETE SET NULL`,
+		`CREATE INDEX IF NOT EXISTS dialog_created_by_idx ON dialog (created_by)`,
+		`CREATE INDEX IF NOT EXISTS refresh_token_user_idx ON refresh_token (user_id)`,
+		`CREATE INDEX IF NOT EXISTS deck_word_word_idx ON deck_word (word_id)`,
+		`CREATE INDEX IF NOT EXISTS exercise_set_dialog_idx ON exercise_set (dialog_id)`,
+		// Tìm kiếm toàn văn không phân biệt dấu: cấu hình vocabulary_search bỏ dấu (unaccent) rồi
+		// chuyển chữ thường (simple), nên "ho hoan kiem" khớp "hồ Hoàn Kiếm" với mọi ngôn ngữ.
+		// Cột search_vector là cột sinh tự động nên luôn khớp với dữ liệu, kể cả khi ứng dụng 03 ghi.
+		`CREATE EXTENSION IF NOT EXISTS unaccent`,
+		`DO $$ BEGIN
+			IF NOT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = 'vocabulary_search') THEN
+				CREATE TEXT SEARCH CONFIGURATION vocabulary_search (COPY = simple);
+				ALTER TEXT SEARCH CONFIGURATION vocabulary_search
+					ALTER MAPPING FOR asciiword, asciihword, hword_asciipart, word, hword, hword_part WITH unaccent, simple;
+			END IF;
+		END $$`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('vocabulary_search', topic), 'A') || setweight(to_tsvector('vocabulary_search', content), 'B')
+		) STORED`,
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS search_vector tsvector
+			GENERATED ALWAYS AS (to_tsvector('vocabulary_search', content)) STORED`,
+		`ALTER TABLE word_translation ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('vocabulary_search', text), 'A') || setweight(to_tsvector('vocabulary_search', gloss), 'C')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS dialog_search_idx ON dialog USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS word_search_idx ON word USING GIN (search_vector)`,
+		`CREATE INDEX IF NOT EXISTS word_translation_search_idx ON word_translation USING GIN (search_vector)`,
+		// Thời điểm tạo và sửa cho danh sách có phân trang; bản ghi cũ nhận thời điểm chạy migration
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`ALTER TABLE dialog ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`ALTER TABLE word ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW()`,
+		`CREATE INDEX IF NOT EXISTS dialog_created_at_idx ON dialog (created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS word_created_at_idx ON word (created_at, id)`,
+		`CREATE INDEX IF NOT EXISTS word_lang_content_idx ON word (lang, content, id)`,
+	}
+
+	for _, migration := range migrations {
+		if _, err := DB.Exec(migration); err != nil {
+			return fmt.Errorf("failed to migrate schema: %w", err)
+		}
+	}
+	log.Println("Schema migrations applied")
+
+	if err := migrateWordKeys(); err != nil {
+		return fmt.Errorf("failed to migrate word keys: %w", err)
+	}
+
+	return nil
+}
+
+// migrateWordKeys điền norm_key cho các từ chưa có khoá, gộp các từ trùng khoá vào từ
+// có id nhỏ nhất (chuyển liên kết hội thoại và các nghĩa sang từ giữ lại) rồi tạo unique index
+func migrateWordKeys() error {
+	tx, err := DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to create dialog table: %w", err)
+		return err
 	}
-	log.Println("Dialog table created or already exists")
+	defer tx.Rollback()
 
-	_, err = DB.Exec(wordTableSQL)
+	rows, err := tx.Query("SELECT id, content FROM word WHERE norm_key = ''")
 	if err != nil {
-		return fmt.Errorf("failed to create word table: %w", err)
+		return err
+	}
+	keys := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			rows.Close()
+			return err
+		}
+		if key := textnorm.Normalize(content); key != "" {
+			keys[id] = key
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if len(keys) > 0 {
+		// Khoá mới có thể trùng với từ đã có, nên index được tạo lại sau khi gộp
+		if _, err := tx.Exec("DROP INDEX IF EXISTS word_norm_key_idx"); err != nil {
+			return err
+		}
+		for id, key := range keys {
+			if _, err := tx.Exec("UPDATE word SET norm_key = $1 WHERE id = $2", key, id); err != nil {
+				return err
+			}
+		}
+
+		steps := []string{
+			`CREATE TEMP TABLE word_merge ON COMMIT DROP AS
+				SELECT id AS dup_id, first_value(id) OVER (PARTITION BY lang, norm_key ORDER BY id) AS keep_id
+				FROM word WHERE norm_key <> ''`,
+			`DELETE FROM word_merge WHERE dup_id = keep_id`,
+			// Các nghĩa của từ trùng được chuyển nguyên sang từ giữ lại cùng bản dịch của chúng
+			`UPDATE word_sense s SET word_id = m.keep_id FROM word_merge m WHERE s.word_id = m.dup_id`,
+			`UPDATE word_translation t SET word_id = m.keep_id FROM word_merge m WHERE t.word_id = m.dup_id`,
+			`UPDATE word_occurrence o SET word_id = m.keep_id FROM word_merge m WHERE o.word_id = m.dup_id`,
+			// Người học đã có thẻ của từ giữ lại thì giữ thẻ đó; lịch sử ôn của cả hai được giữ
+			`INSERT INTO review_card (learner, word_id, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at, created_at)
+				SELECT c.learner, m.keep_id, c.ease, c.interval_days, c.repetitions, c.lapses, c.due_at, c.last_reviewed_at, c.created_at
+				FROM review_card c JOIN word_merge m ON m.dup_id = c.word_id
+				ON CONFLICT (learner, word_id) DO NOTHING`,
+			`UPDATE review_log l SET word_id = m.keep_id FROM word_merge m WHERE l.word_id = m.dup_id`,
+			`INSERT INTO user_word (user_id, word_id, added_at)
+				SELECT uw.user_id, m.keep_id, uw.added_at FROM user_word uw JOIN word_merge m ON m.dup_id = uw.word_id
+				ON CONFLICT (user_id, word_id) DO NOTHING`,
+			`INSERT INTO deck_word (deck_id, word_id, sense_id, example, added_at)
+				SELECT dw.deck_id, m.keep_id, dw.sense_id, dw.example, dw.added_at FROM deck_word dw JOIN word_merge m ON m.dup_id = dw.word_id
+				ON CONFLICT (deck_id, word_id) DO NOTHING`,
+			`INSERT INTO word_dialog (dialog_id, word_id, sense_id, example)
+				SELECT wd.dialog_id, m.keep_id, wd.sense_id, wd.example FROM word_dialog wd JOIN word_merge m ON m.dup_id = wd.word_id
+				ON CONFLICT DO NOTHING`,
+			`UPDATE word w SET pronunciation = d.pronunciation
+				FROM word_merge m JOIN word d ON d.id = m.dup_id
+				WHERE w.id = m.keep_id AND w.pronunciation = '' AND d.pronunciation <> ''`,
+		}
+		for _, step := range steps {
+			if _, err := tx.Exec(step); err != nil {
+				return err
+			}
+		}
+		result, err := tx.Exec("DELETE FROM word WHERE id IN (SELECT dup_id FROM word_merge)")
+		if err != nil {
+			return err
+		}
+		if merged, _ := result.RowsAffected(); merged > 0 {
+			log.Printf("Merged %d duplicate words", merged)
+		}
+	}
+
+	if _, err := tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS word_norm_key_idx ON word (lang, norm_key) WHERE norm_key <> ''`); err != nil {
+		return err
 	}
-	log.Println("Word table created or already exists")
+	return tx.Commit()
+}
 
-	_, err = DB.Exec(wordDialogTableSQL)
+// SeedCatalog thêm các giọng đọc và nhân vật mặc định nếu chưa có.
+// Bản ghi đã tồn tại được giữ nguyên để không ghi đè thay đổi qua API.
+func SeedCatalog(voices []models.Voice, characters []models.Character) error {
+	tx, err := DB.Begin()
 	if err != nil {
-		return fmt.Errorf("failed to create word_dialog table: %w", err)
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, v := range voices {
+		_, err := tx.Exec(`INSERT INTO voice (name, lang, gender, style, display_name) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (name) DO NOTHING`, v.Name, v.Lang, v.Gender, v.Style, v.DisplayName)
+		if err != nil {
+			return fmt.Errorf("failed to seed voice %q: %w", v.Name, err)
+		}
+	}
+	for _, c := range characters {
+		_, err := tx.Exec(`INSERT INTO character_profile (name, nationality, gender, persona, default_voice)
+			VALUES ($1, $2, $3, $4, (SELECT name FROM voice WHERE name = $5))
+			ON CONFLICT (name) DO NOTHING`, c.Name, c.Nationality, c.Gender, c.Persona, c.DefaultVoice)
+		if err != nil {
+			return fmt.Errorf("failed to seed character %q: %w", c.Name, err)
+		}
 	}
-	log.Println("Word_dialog table created or already exists")
 
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Catalog seeded with %d voices and %d characters", len(voices), len(characters))
 	return nil
 }
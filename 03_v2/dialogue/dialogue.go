@@ -0,0 +1,114 @@
+package dialogue
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// Turn là một lượt nói đã nhận diện được người nói
+type Turn struct {
+	Line    int    `json:"line"` // số dòng trong nội dung gốc, bắt đầu từ 1
+	Speaker string `json:"speaker"`
+	Text    string `json:"text"`
+}
+
+// Line là một dòng không nhận diện được người nói
+type Line struct {
+	Line int    `json:"line"`
+	Text string `json:"text"`
+}
+
+// Result là kết quả phân tích một hội thoại
+type Result struct {
+	Turns     []Turn `json:"turns"`
+	Unmatched []Line `json:"unmatched"`
+}
+
+// speakerRe nhận các dạng "Lan:", "**Lan:**", "**Lan**:", "- Lan:", "*Lan:*"
+var speakerRe = regexp.MustCompile(`^[-•\s]*(\*\*|\*|__)?\s*([^:*_]+?)\s*(\*\*|\*|__)?\s*[:：]\s*(\*\*|\*|__)?\s*(.*)$`)
+
+// numberingRe nhận phần đánh số đầu dòng: "1.", "2)", "(3)", "#4", "Câu 5:"
+var numberingRe = regexp.MustCompile(`^[-•\s]*(?:\(\d+\)|#\d+|\d+[.)]|(?i:câu|line)\s*\d+\s*[.:)\-–]?)\s+`)
+
+// quotePairs là các cặp dấu ngoặc kép bao quanh câu thoại sẽ được bỏ đi
+var quotePairs = [][2]string{{`"`, `"`}, {"“", "”"}, {"«", "»"}}
+
+// maxSpeakerWords giới hạn số từ trong tên người nói để tránh nhận nhầm câu văn có dấu hai chấm
+const maxSpeakerWords = 4
+
+// Parse tách nội dung hội thoại thành các lượt nói theo tiền tố "Tên:", bỏ qua dòng trống,
+// phần đánh số đầu dòng và dấu in đậm Markdown quanh tên.
+// Các dòng không có tiền tố hợp lệ được trả về trong Unmatched thay vì bị bỏ qua.
+func Parse(content string) Result {
+	result := Result{Turns: []Turn{}, Unmatched: []Line{}}
+	for i, raw := range strings.Split(content, "\n") {
+		line := strings.TrimSpace(raw)
+		if line == "" {
+			continue
+		}
+		if speaker, text, ok := splitSpeaker(line); ok {
+			result.Turns = append(result.Turns, Turn{Line: i + 1, Speaker: speaker, Text: text})
+			continue
+		}
+		result.Unmatched = append(result.Unmatched, Line{Line: i + 1, Text: line})
+	}
+	return result
+}
+
+// Speakers trả về danh sách người nói theo thứ tự xuất hiện, không trùng lặp
+func Speakers(turns []Turn) []string {
+	speakers := []string{}
+	seen := make(map[string]bool)
+	for _, turn := range turns {
+		if !seen[turn.Speaker] {
+			seen[turn.Speaker] = true
+			speakers = append(speakers, turn.Speaker)
+		}
+	}
+	return speakers
+}
+
+func splitSpeaker(line string) (string, string, bool) {
+	line = numberingRe.ReplaceAllString(line, "")
+	m := speakerRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+	speaker := strings.TrimSpace(m[2])
+	text := unquote(strings.TrimSpace(strings.Trim(strings.TrimSpace(m[5]), "*_")))
+	if !isSpeakerName(speaker) || text == "" {
+		return "", "", false
+	}
+	return speaker, text, true
+}
+
+// isSpeakerName kiểm tra tên người nói: bắt đầu bằng chữ cái, tối đa vài từ, không chứa dấu câu
+func isSpeakerName(name string) bool {
+	words := strings.Fields(name)
+	if len(words) == 0 || len(words) > maxSpeakerWords {
+		return false
+	}
+	for i, r := range name {
+		if i == 0 && !unicode.IsLetter(r) {
+			return false
+		}
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) && r != '.' && r != '-' && r != '\'' {
+			return false
+		}
+	}
+	return true
+}
+
+// unquote bỏ cặp dấu ngoặc kép bao quanh toàn bộ câu thoại
+func unquote(text string) string {
+	for _, q := range quotePairs {
+		if len(text) > len(q[0])+len(q[1]) && strings.HasPrefix(text, q[0]) && strings.HasSuffix(text, q[1]) {
+			inner := text[len(q[0]) : len(text)-len(q[1])]
+			if !strings.Contains(inner, q[0]) && !strings.Contains(inner, q[1]) {
+				return strings.TrimSpace(inner)
+			}
+		}
+	}
+	return text
+}
@@ -0,0 +1,357 @@
+package exercise
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"vocabulary/textnorm"
+)
+
+// Kind là loại bài tập
+type Kind string
+
+// Các loại bài tập
+const (
+	Choice   Kind = "choice"   // chọn bản dịch đúng trong nhiều phương án
+	Cloze    Kind = "cloze"    // điền từ còn thiếu vào câu thoại
+	Matching Kind = "matching" // nối từ với bản dịch
+)
+
+// Kinds là các loại bài tập theo thứ tự sinh
+var Kinds = []Kind{Choice, Cloze, Matching}
+
+// Blank là chỗ trống thay cho từ cần điền trong câu cloze
+const Blank = "_____"
+
+// Giá trị mặc định của Options
+const (
+	DefaultCount   = 10 // số câu tối đa cho mỗi loại choice và cloze
+	DefaultChoices = 4  // số phương án của một câu trắc nghiệm
+	DefaultPairs   = 6  // số cặp của bài nối
+)
+
+// Word là một từ vựng của hội thoại cùng bản dịch sang ngôn ngữ của bài tập
+type Word struct {
+	ID          int64
+	Content     string
+	Translation string
+}
+
+// Span là vị trí [Start, End) của một từ vựng trong câu thoại, tính theo ký tự Unicode
+type Span struct {
+	WordID  int64
+	Start   int
+	End     int
+	Surface string
+}
+
+// Line là một lượt nói của hội thoại
+type Line struct {
+	Ordinal int
+	Speaker string
+	Text    string
+	Spans   []Span
+}
+
+// Input là dữ liệu để sinh bài tập. Distractors là bản dịch của các từ khác dùng làm phương án nhiễu.
+// Các hàm trong gói không đọc cơ sở dữ liệu: cùng Input, cùng Options luôn cho cùng bài tập.
+type Input struct {
+	Words       []Word
+	Lines       []Line
+	Distractors []Word
+}
+
+// Options điều chỉnh việc sinh bài tập; giá trị 0 dùng mặc định, Kinds rỗng nghĩa là mọi loại
+type Options struct {
+	Seed    int64
+	Kinds   []Kind
+	Count   int
+	Choices int
+	Pairs   int
+}
+
+// Item là một câu hỏi. Answer và Pairs là đáp án, được ẩn đi khi gửi cho người làm bài (Public).
+type Item struct {
+	ID      int      `json:"id"`
+	Kind    Kind     `json:"kind"`
+	Prompt  string   `json:"prompt,omitempty"`
+	Hint    string   `json:"hint,omitempty"`    // cloze: bản dịch của từ cần điền
+	WordID  int64    `json:"wordID,omitempty"`  // choice, cloze
+	Ordinal int      `json:"ordinal,omitempty"` // cloze: lượt nói chứa câu
+	Speaker string   `json:"speaker,omitempty"` // cloze
+	Choices []string `json:"choices,omitempty"` // choice
+	Left    []string `json:"left,omitempty"`    // matching: các từ
+	Right   []string `json:"right,omitempty"`   // matching: các bản dịch đã xáo trộn
+	WordIDs []int64  `json:"wordIDs,omitempty"` // matching: id của các từ bên trái
+	Answer  string   `json:"answer,omitempty"`  // choice: phương án đúng; cloze: từ cần điền
+	Pairs   []int    `json:"pairs,omitempty"`   // matching: chỉ số trong Right của từng từ bên trái
+}
+
+// Public trả về bản sao của câu hỏi không kèm đáp án
+func (item Item) Public() Item {
+	item.Answer = ""
+	item.Pairs = nil
+	return item
+}
+
+// ParseKind kiểm tra tên loại bài tập
+func ParseKind(s string) (Kind, error) {
+	kind := Kind(strings.ToLower(strings.TrimSpace(s)))
+	for _, k := range Kinds {
+		if kind == k {
+			return kind, nil
+		}
+	}
+	return "", fmt.Errorf("unknown exercise type %q, expected choice, cloze or matching", s)
+}
+
+// Generate sinh bài tập từ hội thoại. Thứ tự các câu hỏi, phương án nhiễu và cách xáo trộn
+// chỉ phụ thuộc vào Seed và Input.
+func Generate(in Input, opts Options) []Item {
+	opts = withDefaults(opts)
+	rng := rand.New(rand.NewSource(opts.Seed))
+
+	// Sắp xếp để kết quả không phụ thuộc thứ tự đọc từ cơ sở dữ liệu
+	words := withTranslation(in.Words)
+	sort.Slice(words, func(i, j int) bool { return words[i].ID < words[j].ID })
+	pool := withTranslation(in.Distractors)
+	sort.Slice(pool, func(i, j int) bool { return pool[i].ID < pool[j].ID })
+
+	var items []Item
+	for _, kind := range opts.Kinds {
+		switch kind {
+		case Choice:
+			items = append(items, choiceItems(rng, words, pool, opts)...)
+		case Cloze:
+			items = append(items, clozeItems(rng, in.Lines, words, opts)...)
+		case Matching:
+			if item, ok := matchingItem(rng, words, opts); ok {
+				items = append(items, item)
+			}
+		}
+	}
+	for i := range items {
+		items[i].ID = i + 1
+	}
+	return items
+}
+
+func withDefaults(opts Options) Options {
+	if len(opts.Kinds) == 0 {
+		opts.Kinds = Kinds
+	}
+	if opts.Count <= 0 {
+		opts.Count = DefaultCount
+	}
+	if opts.Choices < 2 {
+		opts.Choices = DefaultChoices
+	}
+	if opts.Pairs < 2 {
+		opts.Pairs = DefaultPairs
+	}
+	return opts
+}
+
+func withTranslation(words []Word) []Word {
+	out := make([]Word, 0, len(words))
+	for _, w := range words {
+		if strings.TrimSpace(w.Translation) != "" {
+			out = append(out, w)
+		}
+	}
+	return out
+}
+
+// choiceItems hỏi bản dịch của từng từ. Phương án nhiễu lấy từ Distractors trước, thiếu thì lấy
+// bản dịch của các từ khác trong hội thoại; từ không đủ phương án nhiễu bị bỏ qua.
+func choiceItems(rng *rand.Rand, words, pool []Word, opts Options) []Item {
+	var items []Item
+	for _, i := range rng.Perm(len(words)) {
+		if len(items) == opts.Count {
+			break
+		}
+		w := words[i]
+		seen := map[string]bool{textnorm.Normalize(w.Translation): true}
+		choices := []string{w.Translation}
+		for _, source := range [][]Word{pool, words} {
+			for _, j := range rng.Perm(len(source)) {
+				if len(choices) == opts.Choices {
+					break
+				}
+				key := textnorm.Normalize(source[j].Translation)
+				if source[j].ID == w.ID || seen[key] {
+					continue
+				}
+				seen[key] = true
+				choices = append(choices, source[j].Translation)
+			}
+		}
+		if len(choices) < opts.Choices {
+			continue
+		}
+		rng.Shuffle(len(choices), func(a, b int) { choices[a], choices[b] = choices[b], choices[a] })
+		items = append(items, Item{Kind: Choice, Prompt: w.Content, WordID: w.ID, Choices: choices, Answer: w.Translation})
+	}
+	return items
+}
+
+// clozeItems xoá một lần xuất hiện của từ vựng khỏi câu thoại. Mỗi từ chỉ được hỏi một lần
+// và mỗi câu thoại chỉ có một chỗ trống.
+func clozeItems(rng *rand.Rand, lines []Line, words []Word, opts Options) []Item {
+	translations := make(map[int64]string, len(words))
+	for _, w := range words {
+		translations[w.ID] = w.Translation
+	}
+
+	type candidate struct {
+		line Line
+		span Span
+	}
+	var candidates []candidate
+	for _, line := range lines {
+		for _, span := range line.Spans {
+			candidates = append(candidates, candidate{line, span})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].line.Ordinal != candidates[j].line.Ordinal {
+			return candidates[i].line.Ordinal < candidates[j].line.Ordinal
+		}
+		return candidates[i].span.Start < candidates[j].span.Start
+	})
+
+	var items []Item
+	usedWords := make(map[int64]bool)
+	usedLines := make(map[int]bool)
+	for _, i := range rng.Perm(len(candidates)) {
+		if len(items) == opts.Count {
+			break
+		}
+		c := candidates[i]
+		if usedWords[c.span.WordID] || usedLines[c.line.Ordinal] {
+			continue
+		}
+		runes := []rune(c.line.Text)
+		if c.span.Start < 0 || c.span.End > len(runes) || c.span.Start >= c.span.End {
+			continue
+		}
+		usedWords[c.span.WordID] = true
+		usedLines[c.line.Ordinal] = true
+		items = append(items, Item{
+			Kind:    Cloze,
+			Prompt:  string(runes[:c.span.Start]) + Blank + string(runes[c.span.End:]),
+			Hint:    translations[c.span.WordID],
+			WordID:  c.span.WordID,
+			Ordinal: c.line.Ordinal,
+			Speaker: c.line.Speaker,
+			Answer:  c.span.Surface,
+		})
+	}
+	// Câu hỏi theo thứ tự xuất hiện trong hội thoại cho dễ đọc
+	sort.SliceStable(items, func(i, j int) bool { return items[i].Ordinal < items[j].Ordinal })
+	return items
+}
+
+// matchingItem nối tối đa opts.Pairs từ với bản dịch; cần ít nhất hai từ có bản dịch khác nhau
+func matchingItem(rng *rand.Rand, words []Word, opts Options) (Item, bool) {
+	item := Item{Kind: Matching}
+	seen := make(map[string]bool)
+	for _, i := range rng.Perm(len(words)) {
+		if len(item.Left) == opts.Pairs {
+			break
+		}
+		key := textnorm.Normalize(words[i].Translation)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		item.Left = append(item.Left, words[i].Content)
+		item.WordIDs = append(item.WordIDs, words[i].ID)
+		item.Right = append(item.Right, words[i].Translation)
+	}
+	if len(item.Left) < 2 {
+		return Item{}, false
+	}
+
+	order := rng.Perm(len(item.Right))
+	right := make([]string, len(order))
+	item.Pairs = make([]int, len(order))
+	for to, from := range order {
+		right[to] = item.Right[from]
+		item.Pairs[from] = to
+	}
+	item.Right = right
+	return item, true
+}
+
+// Response là câu trả lời cho một câu hỏi: Answer cho choice và cloze, Pairs cho matching
+type Response struct {
+	Item   int    `json:"item"`
+	Answer string `json:"answer"`
+	Pairs  []int  `json:"pairs"`
+}
+
+// ItemResult là kết quả chấm một câu hỏi kèm đáp án đúng
+type ItemResult struct {
+	Item     int    `json:"item"`
+	Kind     Kind   `json:"kind"`
+	Score    int    `json:"score"`
+	MaxScore int    `json:"maxScore"`
+	Correct  bool   `json:"correct"`
+	Answer   string `json:"answer,omitempty"`
+	Pairs    []int  `json:"pairs,omitempty"`
+}
+
+// Result là kết quả chấm cả bài
+type Result struct {
+	Score    int          `json:"score"`
+	MaxScore int          `json:"maxScore"`
+	Items    []ItemResult `json:"items"`
+}
+
+// Grade chấm bài: choice và cloze một điểm mỗi câu, matching một điểm mỗi cặp nối đúng.
+// Câu trả lời được so sánh sau khi chuẩn hoá (chữ thường, bỏ dấu câu ở hai đầu); câu không trả lời được 0 điểm.
+func Grade(items []Item, responses []Response) (Result, error) {
+	byItem := make(map[int]Response, len(responses))
+	for _, r := range responses {
+		if _, dup := byItem[r.Item]; dup {
+			return Result{}, fmt.Errorf("item %d answered more than once", r.Item)
+		}
+		byItem[r.Item] = r
+	}
+	known := make(map[int]bool, len(items))
+	for _, item := range items {
+		known[item.ID] = true
+	}
+	for _, r := range responses {
+		if !known[r.Item] {
+			return Result{}, fmt.Errorf("unknown item %d", r.Item)
+		}
+	}
+
+	result := Result{Items: make([]ItemResult, 0, len(items))}
+	for _, item := range items {
+		r := byItem[item.ID]
+		ir := ItemResult{Item: item.ID, Kind: item.Kind, MaxScore: 1, Answer: item.Answer, Pairs: item.Pairs}
+		switch item.Kind {
+		case Matching:
+			ir.MaxScore = len(item.Pairs)
+			for i, want := range item.Pairs {
+				if i < len(r.Pairs) && r.Pairs[i] == want {
+					ir.Score++
+				}
+			}
+		default:
+			if r.Answer != "" && textnorm.Normalize(r.Answer) == textnorm.Normalize(item.Answer) {
+				ir.Score = 1
+			}
+		}
+		ir.Correct = ir.Score == ir.MaxScore
+		result.Score += ir.Score
+		result.MaxScore += ir.MaxScore
+		result.Items = append(result.Items, ir)
+	}
+	return result, nil
+}
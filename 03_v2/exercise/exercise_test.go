@@ -0,0 +1,160 @@
+package exercise
+
+import (
+	"reflect"
+	"testing"
+)
+
+func testInput() Input {
+	return Input{
+		Words: []Word{
+			{ID: 1, Content: "hồ", Translation: "lake"},
+			{ID: 2, Content: "cây cầu", Translation: "bridge"},
+			{ID: 3, Content: "phố cổ", Translation: "old quarter"},
+			{ID: 4, Content: "cà phê", Translation: "coffee"},
+			{ID: 5, Content: "bánh mì", Translation: "bread"},
+		},
+		Lines: []Line{
+			{Ordinal: 1, Speaker: "Lan", Text: "Mình đi dạo quanh hồ nhé.", Spans: []Span{{WordID: 1, Start: 18, End: 20, Surface: "hồ"}}},
+			{Ordinal: 2, Speaker: "Minh", Text: "Qua cây cầu rồi vào phố cổ.", Spans: []Span{
+				{WordID: 2, Start: 4, End: 11, Surface: "cây cầu"},
+				{WordID: 3, Start: 20, End: 26, Surface: "phố cổ"},
+			}},
+			{Ordinal: 3, Speaker: "Lan", Text: "Uống cà phê với bánh mì.", Spans: []Span{
+				{WordID: 4, Start: 5, End: 11, Surface: "cà phê"},
+				{WordID: 5, Start: 16, End: 23, Surface: "bánh mì"},
+			}},
+		},
+		Distractors: []Word{
+			{ID: 10, Content: "núi", Translation: "mountain"},
+			{ID: 11, Content: "sông", Translation: "river"},
+		},
+	}
+}
+
+func TestGenerateIsDeterministic(t *testing.T) {
+	tests := []struct {
+		name string
+		opts Options
+	}{
+		{name: "all kinds", opts: Options{Seed: 42}},
+		{name: "choice only", opts: Options{Seed: 7, Kinds: []Kind{Choice}, Count: 3}},
+		{name: "cloze only", opts: Options{Seed: 7, Kinds: []Kind{Cloze}}},
+		{name: "matching only", opts: Options{Seed: 1, Kinds: []Kind{Matching}, Pairs: 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			first := Generate(testInput(), tt.opts)
+			if len(first) == 0 {
+				t.Fatal("Generate returned no items")
+			}
+
+			// Thứ tự đọc từ cơ sở dữ liệu không được ảnh hưởng đến kết quả
+			in := testInput()
+			in.Words[0], in.Words[4] = in.Words[4], in.Words[0]
+			in.Distractors[0], in.Distractors[1] = in.Distractors[1], in.Distractors[0]
+			second := Generate(in, tt.opts)
+
+			if !reflect.DeepEqual(first, second) {
+				t.Errorf("Generate with the same seed differs:\n%+v\n%+v", first, second)
+			}
+		})
+	}
+}
+
+func TestGrade(t *testing.T) {
+	items := []Item{
+		{ID: 1, Kind: Choice, Prompt: "hồ", WordID: 1, Choices: []string{"river", "lake", "bread", "coffee"}, Answer: "lake"},
+		{ID: 2, Kind: Cloze, Prompt: "Qua " + Blank + " rồi vào phố cổ.", WordID: 2, Ordinal: 2, Answer: "cây cầu"},
+		{ID: 3, Kind: Matching, Left: []string{"hồ", "cà phê", "bánh mì"}, Right: []string{"bread", "lake", "coffee"}, Pairs: []int{1, 2, 0}},
+	}
+
+	tests := []struct {
+		name      string
+		responses []Response
+		wantScore int
+		correct   []bool
+	}{
+		{
+			name: "all correct",
+			responses: []Response{
+				{Item: 1, Answer: "lake"},
+				{Item: 2, Answer: "cây cầu"},
+				{Item: 3, Pairs: []int{1, 2, 0}},
+			},
+			wantScore: 5,
+			correct:   []bool{true, true, true},
+		},
+		{
+			name: "answers are normalised",
+			responses: []Response{
+				{Item: 1, Answer: " Lake. "},
+				{Item: 2, Answer: "Cây Cầu!"},
+			},
+			wantScore: 2,
+			correct:   []bool{true, true, false},
+		},
+		{
+			name: "wrong answers and partial matching",
+			responses: []Response{
+				{Item: 1, Answer: "river"},
+				{Item: 2, Answer: "phố cổ"},
+				{Item: 3, Pairs: []int{1, 0, 2}},
+			},
+			wantScore: 1,
+			correct:   []bool{false, false, false},
+		},
+		{
+			name:      "unanswered items score zero",
+			responses: nil,
+			wantScore: 0,
+			correct:   []bool{false, false, false},
+		},
+		{
+			name: "short matching response",
+			responses: []Response{
+				{Item: 3, Pairs: []int{1, 2}},
+			},
+			wantScore: 2,
+			correct:   []bool{false, false, false},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Grade(items, tt.responses)
+			if err != nil {
+				t.Fatalf("Grade returned an error: %v", err)
+			}
+			if result.Score != tt.wantScore || result.MaxScore != 5 {
+				t.Errorf("score = %d/%d, want %d/5", result.Score, result.MaxScore, tt.wantScore)
+			}
+			for i, ir := range result.Items {
+				if ir.Correct != tt.correct[i] {
+					t.Errorf("item %d correct = %v, want %v", ir.Item, ir.Correct, tt.correct[i])
+				}
+			}
+		})
+	}
+}
+
+func TestGradeRejectsInvalidResponses(t *testing.T) {
+	items := []Item{{ID: 1, Kind: Choice, Answer: "lake"}}
+
+	tests := []struct {
+		name      string
+		responses []Response
+	}{
+		{name: "unknown item", responses: []Response{{Item: 2, Answer: "lake"}}},
+		{name: "duplicate item", responses: []Response{{Item: 1, Answer: "lake"}, {Item: 1, Answer: "river"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Grade(items, tt.responses); err == nil {
+				t.Error("Grade accepted an invalid response")
+			}
+		})
+	}
+}
@@ -0,0 +1,548 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"vocabulary/config"
+	"vocabulary/database"
+	"vocabulary/dialogue"
+	"vocabulary/models"
+	"vocabulary/ssml"
+	"vocabulary/storage"
+	"vocabulary/textnorm"
+	"vocabulary/tts"
+
+	"github.com/kataras/iris/v12"
+)
+
+// Trạng thái âm thanh của một câu thoại
+const (
+	audioPending    = "pending"
+	audioProcessing = "processing"
+	audioReady      = "ready"
+	audioFailed     = "failed"
+)
+
+// synthesisTimeout giới hạn thời gian tổng hợp một câu thoại
+const synthesisTimeout = time.Minute
+
+// audioJobs ghi nhận các hội thoại đang được tổng hợp để tránh chạy trùng
+var audioJobs = struct {
+	sync.Mutex
+	running map[int64]bool
+}{running: make(map[int64]bool)}
+
+// SynthesizeDialogAudioHandler tạo âm thanh cho từng câu thoại của một hội thoại.
+// Việc tổng hợp chạy nền; dùng GET /dialogs/{id}/audio để theo dõi trạng thái.
+// Các câu đã có âm thanh với cùng văn bản và giọng đọc được giữ lại trừ khi force=true.
+func SynthesizeDialogAudioHandler(ctx iris.Context) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	provider, err := tts.NewProvider(cfg.TTSProvider, cfg.TTSCommand)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to create TTS provider: %v", err)})
+		return
+	}
+	store, err := storage.NewBlobStore(cfg.BlobStore, cfg.AudioDir)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to create blob store: %v", err)})
+		return
+	}
+
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	parsed, err := parseDialog(dialog)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog turns: %v", err)})
+		return
+	}
+	if len(parsed.Turns) == 0 {
+		ctx.StatusCode(iris.StatusUnprocessableEntity)
+		ctx.JSON(APIResponse{Status: "error", Error: "Dialog has no lines with a speaker"})
+		return
+	}
+
+	voices, err := resolveDialogVoices(dialog.ID, dialogue.Speakers(parsed.Turns))
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load voice mapping: %v", err)})
+		return
+	}
+
+	var lines []models.DialogAudio
+	var requests []tts.Request
+	for i, turn := range parsed.Turns {
+		doc := ssml.Document{
+			Lang:         dialog.Lang,
+			Voices:       voices,
+			DefaultVoice: cfg.DefaultVoice,
+			Markup:       true,
+			Marks:        true,
+			Lexicons:     []string{lexiconURI(cfg.PublicURL, dialog.Lang)},
+			Turns:        []ssml.Turn{{ID: fmt.Sprint(i + 1), Line: turn.Line, Speaker: turn.Speaker, Text: turn.Text}},
+		}
+		out, err := ssml.Build(doc)
+		if err != nil {
+			ctx.StatusCode(iris.StatusUnprocessableEntity)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to build SSML: %v", err)})
+			return
+		}
+		tokens, _ := doc.TurnTokens(0)
+		marks := make([]tts.Mark, len(tokens))
+		for j, token := range tokens {
+			marks[j] = tts.Mark{Name: token.Mark, Text: token.Text}
+		}
+		text, _ := ssml.StripMarkup(turn.Text)
+
+		lines = append(lines, models.DialogAudio{
+			DialogID: dialog.ID,
+			Ordinal:  i + 1,
+			Speaker:  turn.Speaker,
+			Text:     text,
+			Voice:    doc.VoiceFor(turn.Speaker),
+			Provider: provider.Name(),
+		})
+		requests = append(requests, tts.Request{Text: text, SSML: out, Voice: doc.VoiceFor(turn.Speaker), Lang: dialog.Lang, Marks: marks})
+	}
+
+	audioJobs.Lock()
+	if audioJobs.running[dialog.ID] {
+		audioJobs.Unlock()
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Audio for dialog %d is already being synthesized", dialog.ID)})
+		return
+	}
+	audioJobs.running[dialog.ID] = true
+	audioJobs.Unlock()
+
+	pending, err := prepareDialogAudioInDB(dialog.ID, lines, ctx.URLParamBoolDefault("force", false))
+	if err != nil {
+		finishAudioJob(dialog.ID)
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to prepare audio rows: %v", err)})
+		return
+	}
+
+	var jobs []audioJob
+	for i := range lines {
+		if pending[lines[i].Ordinal] {
+			jobs = append(jobs, audioJob{line: lines[i], request: requests[i]})
+		}
+	}
+	go synthesizeDialogAudio(dialog.ID, jobs, provider, store)
+
+	audio, err := getDialogAudioFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load audio status: %v", err)})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusAccepted)
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"dialogID":       dialog.ID,
+			"status":         overallAudioStatus(audio),
+			"lines":          audio,
+			"unmatchedLines": parsed.Unmatched,
+		},
+	})
+}
+
+// DialogAudioStatusHandler trả về trạng thái âm thanh của từng câu thoại
+func DialogAudioStatusHandler(ctx iris.Context) {
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	audio, err := getDialogAudioFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load audio status: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"dialogID": dialog.ID,
+			"status":   overallAudioStatus(audio),
+			"lines":    audio,
+		},
+	})
+}
+
+// DialogAudioStreamHandler phát âm thanh của một câu thoại (hỗ trợ Range request)
+func DialogAudioStreamHandler(ctx iris.Context) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+	store, err := storage.NewBlobStore(cfg.BlobStore, cfg.AudioDir)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to create blob store: %v", err)})
+		return
+	}
+
+	dialogID, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid dialog id"})
+		return
+	}
+	ordinal, err := ctx.Params().GetInt("line")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid line number"})
+		return
+	}
+
+	line, updatedAt, err := getDialogAudioLineFromDB(dialogID, ordinal)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("No audio for line %d of dialog %d", ordinal, dialogID)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load audio: %v", err)})
+		return
+	}
+	if line.Status != audioReady {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Data: line, Error: fmt.Sprintf("Audio for line %d is %s", ordinal, line.Status)})
+		return
+	}
+
+	blob, err := store.Open(ctx.Request().Context(), line.BlobKey)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to open audio: %v", err)})
+		return
+	}
+	defer blob.Close()
+
+	ctx.ContentType(line.ContentType)
+	ctx.ServeContent(blob, fmt.Sprintf("dialog-%d-line-%d.wav", dialogID, ordinal), updatedAt)
+}
+
+// wordTiming là mốc thời gian của một từ trong âm thanh, kèm id của từ vựng đã lưu nếu khớp
+type wordTiming struct {
+	Index   int    `json:"index"`
+	Mark    string `json:"mark"`
+	Token   string `json:"token"`
+	StartMs int64  `json:"startMs"`
+	EndMs   int64  `json:"endMs"`
+	WordID  int64  `json:"wordID,omitempty"`
+}
+
+// DialogTimingsHandler trả về mốc thời gian của từng từ trong từng câu thoại (karaoke).
+// Các từ thuộc từ vựng đã lưu của hội thoại (bảng word_dialog) được gắn wordID.
+func DialogTimingsHandler(ctx iris.Context) {
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	audio, err := getDialogAudioFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load audio status: %v", err)})
+		return
+	}
+	marks, err := getDialogAudioMarksFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load audio marks: %v", err)})
+		return
+	}
+	words, err := getDialogWordsFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog words: %v", err)})
+		return
+	}
+
+	var lines []map[string]interface{}
+	for _, line := range audio {
+		if line.Status != audioReady {
+			continue
+		}
+		lineMarks := marks[line.Ordinal]
+		timings := make([]wordTiming, len(lineMarks))
+		tokens := make([]string, len(lineMarks))
+		for i, mark := range lineMarks {
+			end := line.DurationMs
+			if i+1 < len(lineMarks) {
+				end = lineMarks[i+1].OffsetMs
+			}
+			timings[i] = wordTiming{Index: mark.MarkIndex, Mark: mark.Name, Token: mark.Token, StartMs: mark.OffsetMs, EndMs: end}
+			tokens[i] = mark.Token
+		}
+		for i, wordID := range matchWordsToTokens(tokens, words) {
+			timings[i].WordID = wordID
+		}
+
+		lines = append(lines, map[string]interface{}{
+			"ordinal":    line.Ordinal,
+			"speaker":    line.Speaker,
+			"text":       line.Text,
+			"durationMs": line.DurationMs,
+			"audioURL":   fmt.Sprintf("/dialogs/%d/audio/%d", dialog.ID, line.Ordinal),
+			"words":      timings,
+		})
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"dialogID": dialog.ID,
+			"status":   overallAudioStatus(audio),
+			"lines":    lines,
+		},
+	})
+}
+
+// matchWordsToTokens gắn id từ vựng cho các token của một câu. Từ nhiều âm tiết (ví dụ "đi thẳng")
+// được so khớp theo chuỗi token liên tiếp, ưu tiên cụm dài hơn.
+func matchWordsToTokens(tokens []string, words []models.Word) []int64 {
+	normalized := make([]string, len(tokens))
+	for i, token := range tokens {
+		normalized[i] = textnorm.Normalize(token)
+	}
+
+	ids := make([]int64, len(tokens))
+	for _, m := range matchPhrases(normalized, words) {
+		for k := m.start; k < m.end; k++ {
+			ids[k] = m.wordID
+		}
+	}
+	return ids
+}
+
+type audioJob struct {
+	line    models.DialogAudio
+	request tts.Request
+}
+
+// synthesizeDialogAudio tổng hợp lần lượt các câu thoại và cập nhật trạng thái vào cơ sở dữ liệu
+func synthesizeDialogAudio(dialogID int64, jobs []audioJob, provider tts.TTSProvider, store storage.BlobStore) {
+	defer finishAudioJob(dialogID)
+
+	for _, job := range jobs {
+		line := job.line
+		if err := updateDialogAudioStatusInDB(line, audioProcessing, ""); err != nil {
+			log.Printf("Failed to update audio status of dialog %d line %d: %v", dialogID, line.Ordinal, err)
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), synthesisTimeout)
+		result, err := provider.Synthesize(ctx, job.request)
+		var marks []models.AudioMark
+		if err == nil {
+			line.BlobKey = fmt.Sprintf("dialogs/%d/%d.wav", dialogID, line.Ordinal)
+			line.ContentType = result.ContentType
+			line.DurationMs = result.Duration.Milliseconds()
+			for i, timing := range result.Marks {
+				marks = append(marks, models.AudioMark{
+					DialogID:  dialogID,
+					Ordinal:   line.Ordinal,
+					MarkIndex: i + 1,
+					Name:      timing.Name,
+					Token:     timing.Text,
+					OffsetMs:  timing.Offset.Milliseconds(),
+				})
+			}
+			err = store.Put(ctx, line.BlobKey, bytes.NewReader(result.Audio))
+		}
+		cancel()
+
+		if err != nil {
+			log.Printf("Failed to synthesize dialog %d line %d: %v", dialogID, line.Ordinal, err)
+			if err := updateDialogAudioStatusInDB(line, audioFailed, err.Error()); err != nil {
+				log.Printf("Failed to update audio status of dialog %d line %d: %v", dialogID, line.Ordinal, err)
+			}
+			continue
+		}
+
+		if err := saveDialogAudioMarksToDB(line, marks); err != nil {
+			log.Printf("Failed to save audio marks of dialog %d line %d: %v", dialogID, line.Ordinal, err)
+			if err := updateDialogAudioStatusInDB(line, audioFailed, err.Error()); err != nil {
+				log.Printf("Failed to update audio status of dialog %d line %d: %v", dialogID, line.Ordinal, err)
+			}
+		}
+	}
+}
+
+func finishAudioJob(dialogID int64) {
+	audioJobs.Lock()
+	delete(audioJobs.running, dialogID)
+	audioJobs.Unlock()
+}
+
+// overallAudioStatus gộp trạng thái của các câu thành trạng thái của cả hội thoại
+func overallAudioStatus(lines []models.DialogAudio) string {
+	if len(lines) == 0 {
+		return "none"
+	}
+	counts := make(map[string]int)
+	for _, line := range lines {
+		counts[line.Status]++
+	}
+	switch {
+	case counts[audioReady] == len(lines):
+		return audioReady
+	case counts[audioPending]+counts[audioProcessing] > 0:
+		return audioProcessing
+	default:
+		return audioFailed
+	}
+}
+
+// prepareDialogAudioInDB đánh dấu các câu cần tổng hợp là pending và trả về tập số thứ tự của chúng.
+// Câu đã sẵn sàng với cùng văn bản, giọng và provider được giữ nguyên trừ khi force=true.
+func prepareDialogAudioInDB(dialogID int64, lines []models.DialogAudio, force bool) (map[int]bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM dialog_audio WHERE dialog_id = $1 AND ordinal > $2", dialogID, len(lines)); err != nil {
+		return nil, err
+	}
+
+	pending := make(map[int]bool)
+	for _, line := range lines {
+		var existing models.DialogAudio
+		var markCount int
+		err := tx.QueryRow(`SELECT a.text, a.voice, a.provider, a.status,
+			(SELECT COUNT(*) FROM dialog_audio_mark m WHERE m.dialog_id = a.dialog_id AND m.ordinal = a.ordinal)
+			FROM dialog_audio a WHERE a.dialog_id = $1 AND a.ordinal = $2`,
+			dialogID, line.Ordinal).Scan(&existing.Text, &existing.Voice, &existing.Provider, &existing.Status, &markCount)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		if err == nil && !force && existing.Status == audioReady && markCount > 0 &&
+			existing.Text == line.Text && existing.Voice == line.Voice && existing.Provider == line.Provider {
+			continue
+		}
+
+		_, err = tx.Exec(`INSERT INTO dialog_audio (dialog_id, ordinal, speaker, text, voice, provider, status)
+			VALUES ($1, $2, $3, $4, $5, $6, $7)
+			ON CONFLICT (dialog_id, ordinal) DO UPDATE SET speaker = EXCLUDED.speaker, text = EXCLUDED.text,
+				voice = EXCLUDED.voice, provider = EXCLUDED.provider, status = EXCLUDED.status,
+				error = '', updated_at = NOW()`,
+			dialogID, line.Ordinal, line.Speaker, line.Text, line.Voice, line.Provider, audioPending)
+		if err != nil {
+			return nil, err
+		}
+		pending[line.Ordinal] = true
+	}
+
+	return pending, tx.Commit()
+}
+
+func updateDialogAudioStatusInDB(line models.DialogAudio, status, errMsg string) error {
+	_, err := database.DB.Exec(`UPDATE dialog_audio SET status = $3, blob_key = $4, content_type = $5,
+		duration_ms = $6, error = $7, updated_at = NOW() WHERE dialog_id = $1 AND ordinal = $2`,
+		line.DialogID, line.Ordinal, status, line.BlobKey, line.ContentType, line.DurationMs, errMsg)
+	return err
+}
+
+// saveDialogAudioMarksToDB thay các mốc thời gian của một câu và đánh dấu câu là sẵn sàng trong cùng một transaction
+func saveDialogAudioMarksToDB(line models.DialogAudio, marks []models.AudioMark) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM dialog_audio_mark WHERE dialog_id = $1 AND ordinal = $2", line.DialogID, line.Ordinal); err != nil {
+		return err
+	}
+	for _, mark := range marks {
+		_, err := tx.Exec(`INSERT INTO dialog_audio_mark (dialog_id, ordinal, mark_index, name, token, offset_ms)
+			VALUES ($1, $2, $3, $4, $5, $6)`, mark.DialogID, mark.Ordinal, mark.MarkIndex, mark.Name, mark.Token, mark.OffsetMs)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`UPDATE dialog_audio SET status = $3, blob_key = $4, content_type = $5, duration_ms = $6,
+		error = '', updated_at = NOW() WHERE dialog_id = $1 AND ordinal = $2`,
+		line.DialogID, line.Ordinal, audioReady, line.BlobKey, line.ContentType, line.DurationMs)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func getDialogAudioMarksFromDB(dialogID int64) (map[int][]models.AudioMark, error) {
+	rows, err := database.DB.Query(`SELECT ordinal, mark_index, name, token, offset_ms FROM dialog_audio_mark
+		WHERE dialog_id = $1 ORDER BY ordinal, mark_index`, dialogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	marks := make(map[int][]models.AudioMark)
+	for rows.Next() {
+		m := models.AudioMark{DialogID: dialogID}
+		if err := rows.Scan(&m.Ordinal, &m.MarkIndex, &m.Name, &m.Token, &m.OffsetMs); err != nil {
+			return nil, err
+		}
+		marks[m.Ordinal] = append(marks[m.Ordinal], m)
+	}
+	return marks, rows.Err()
+}
+
+func getDialogAudioFromDB(dialogID int64) ([]models.DialogAudio, error) {
+	rows, err := database.DB.Query(`SELECT dialog_id, ordinal, speaker, text, voice, provider, status, blob_key,
+		content_type, duration_ms, error FROM dialog_audio WHERE dialog_id = $1 ORDER BY ordinal`, dialogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.DialogAudio{}
+	for rows.Next() {
+		var a models.DialogAudio
+		if err := rows.Scan(&a.DialogID, &a.Ordinal, &a.Speaker, &a.Text, &a.Voice, &a.Provider, &a.Status,
+			&a.BlobKey, &a.ContentType, &a.DurationMs, &a.Error); err != nil {
+			return nil, err
+		}
+		lines = append(lines, a)
+	}
+	return lines, rows.Err()
+}
+
+func getDialogAudioLineFromDB(dialogID int64, ordinal int) (models.DialogAudio, time.Time, error) {
+	a := models.DialogAudio{DialogID: dialogID, Ordinal: ordinal}
+	var updatedAt time.Time
+	err := database.DB.QueryRow(`SELECT speaker, text, voice, provider, status, blob_key, content_type, duration_ms,
+		error, updated_at FROM dialog_audio WHERE dialog_id = $1 AND ordinal = $2`, dialogID, ordinal).Scan(
+		&a.Speaker, &a.Text, &a.Voice, &a.Provider, &a.Status, &a.BlobKey, &a.ContentType, &a.DurationMs, &a.Error, &updatedAt)
+	return a, updatedAt, err
+}
@@ -0,0 +1,377 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"vocabulary/auth"
+	"vocabulary/config"
+	"vocabulary/database"
+	"vocabulary/models"
+
+	"github.com/iris-contrib/middleware/jwt"
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// Giới hạn của thông tin đăng ký; bcrypt chỉ dùng 72 byte đầu của mật khẩu
+const (
+	maxEmailLen       = 254
+	minPasswordLen    = 8
+	maxPasswordLength = 72
+)
+
+// userIDKey là khoá lưu id người dùng đã đăng nhập trong ctx.Values()
+const userIDKey = "userID"
+
+// Lỗi khi đổi refresh token
+var (
+	errInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	errReusedRefreshToken  = errors.New("refresh token was already used, all sessions have been signed out")
+)
+
+// authTokens là cặp token trả về khi đăng ký, đăng nhập hoặc đổi refresh token
+type authTokens struct {
+	AccessToken      string    `json:"accessToken"`
+	TokenType        string    `json:"tokenType"`
+	ExpiresAt        time.Time `json:"expiresAt"`
+	RefreshToken     string    `json:"refreshToken"`
+	RefreshExpiresAt time.Time `json:"refreshExpiresAt"`
+}
+
+// credentials là body của đăng ký và đăng nhập
+type credentials struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+// RequireAuth trả về middleware yêu cầu header "Authorization: Bearer <access token>" hợp lệ
+// và lưu id người dùng cho các handler phía sau (xem currentUserID)
+func RequireAuth(cfg *config.Configuration) iris.Handler {
+	return requireAuth(cfg, jwt.FromAuthHeader)
+}
+
+// RequireStreamAuth giống RequireAuth nhưng cũng nhận access token trong tham số query access_token,
+// dùng cho route Server-Sent Events vì EventSource của trình duyệt không gửi được header Authorization
+func RequireStreamAuth(cfg *config.Configuration) iris.Handler {
+	return requireAuth(cfg, jwt.FromFirst(jwt.FromAuthHeader, jwt.FromParameter("access_token")))
+}
+
+func requireAuth(cfg *config.Configuration, extractor jwt.TokenExtractor) iris.Handler {
+	unauthorized := func(ctx iris.Context, err error) {
+		ctx.Header("WWW-Authenticate", "Bearer")
+		ctx.StopWithJSON(iris.StatusUnauthorized, APIResponse{Status: "error", Error: fmt.Sprintf("Unauthorized: %v", err)})
+	}
+	verifier := jwt.New(jwt.Config{
+		ValidationKeyGetter: auth.KeyFunc(cfg.JWTSecret),
+		SigningMethod:       jwt.SigningMethodHS256,
+		Expiration:          true,
+		Extractor:           extractor,
+	})
+
+	return func(ctx iris.Context) {
+		if err := verifier.CheckJWT(ctx); err != nil {
+			unauthorized(ctx, err)
+			return
+		}
+		token := verifier.Get(ctx)
+		if token == nil {
+			unauthorized(ctx, jwt.ErrTokenMissing)
+			return
+		}
+		userID, err := auth.UserID(token)
+		if err != nil {
+			unauthorized(ctx, err)
+			return
+		}
+		ctx.Values().Set(userIDKey, userID)
+		ctx.Next()
+	}
+}
+
+// currentUserID trả về id người dùng đã đăng nhập, 0 nếu route không đi qua RequireAuth
+func currentUserID(ctx iris.Context) int64 {
+	return ctx.Values().GetInt64Default(userIDKey, 0)
+}
+
+// RegisterHandler tạo tài khoản từ {"email", "password"} và trả về 201 cùng người dùng và cặp token
+func RegisterHandler(ctx iris.Context) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	request, ok := readCredentials(ctx)
+	if !ok {
+		return
+	}
+	if err := validateCredentials(request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid registration: " + err.Error()})
+		return
+	}
+
+	hash, err := auth.HashPassword(request.Password)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to hash password: %v", err)})
+		return
+	}
+	user, err := createUserInDB(request.Email, hash)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: "Email is already registered"})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to create user: %v", err)})
+		return
+	}
+
+	tokens, err := issueTokens(cfg, database.DB, user.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to issue tokens: %v", err)})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"user": user, "tokens": tokens}})
+}
+
+// LoginHandler kiểm tra {"email", "password"} và trả về cặp token mới
+func LoginHandler(ctx iris.Context) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	request, ok := readCredentials(ctx)
+	if !ok {
+		return
+	}
+
+	user, err := getUserByEmailFromDB(request.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load user: %v", err)})
+		return
+	}
+	// Cùng một thông báo cho email chưa đăng ký và sai mật khẩu
+	if err != nil || !auth.CheckPassword(user.PasswordHash, request.Password) {
+		ctx.StatusCode(iris.StatusUnauthorized)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid email or password"})
+		return
+	}
+
+	tokens, err := issueTokens(cfg, database.DB, user.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to issue tokens: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"user": user, "tokens": tokens}})
+}
+
+// RefreshTokenHandler đổi {"refreshToken"} lấy cặp token mới. Mỗi refresh token chỉ dùng được một lần;
+// dùng lại một token đã đổi sẽ thu hồi mọi refresh token của người dùng.
+func RefreshTokenHandler(ctx iris.Context) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	var request struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil || request.RefreshToken == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'refreshToken'"})
+		return
+	}
+
+	tokens, err := rotateRefreshTokenInDB(cfg, request.RefreshToken)
+	if errors.Is(err, errInvalidRefreshToken) || errors.Is(err, errReusedRefreshToken) {
+		ctx.StatusCode(iris.StatusUnauthorized)
+		ctx.JSON(APIResponse{Status: "error", Error: "Unauthorized: " + err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to refresh tokens: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"tokens": tokens}})
+}
+
+// LogoutHandler thu hồi {"refreshToken"}; access token còn hiệu lực đến khi hết hạn
+func LogoutHandler(ctx iris.Context) {
+	var request struct {
+		RefreshToken string `json:"refreshToken"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil || request.RefreshToken == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'refreshToken'"})
+		return
+	}
+
+	_, err := database.DB.Exec("UPDATE refresh_token SET revoked_at = NOW() WHERE token_hash = $1 AND revoked_at IS NULL",
+		auth.HashRefreshToken(request.RefreshToken))
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to revoke token: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success"})
+}
+
+// MeHandler trả về người dùng đang đăng nhập
+func MeHandler(ctx iris.Context) {
+	user := models.User{ID: currentUserID(ctx)}
+	err := database.DB.QueryRow("SELECT email, created_at FROM app_user WHERE id = $1", user.ID).Scan(&user.Email, &user.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Tài khoản đã bị xoá sau khi token được cấp
+		ctx.StatusCode(iris.StatusUnauthorized)
+		ctx.JSON(APIResponse{Status: "error", Error: "Unauthorized: user no longer exists"})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load user: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: user})
+}
+
+// readCredentials đọc body đăng ký/đăng nhập, chuẩn hoá email; tự trả lỗi nếu body không hợp lệ
+func readCredentials(ctx iris.Context) (credentials, bool) {
+	var request credentials
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return request, false
+	}
+	request.Email = strings.ToLower(strings.TrimSpace(request.Email))
+	if request.Email == "" || request.Password == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Both 'email' and 'password' are required"})
+		return request, false
+	}
+	return request, true
+}
+
+// validateCredentials kiểm tra email và độ dài mật khẩu khi đăng ký
+func validateCredentials(c credentials) error {
+	if addr, err := mail.ParseAddress(c.Email); err != nil || addr.Address != c.Email || len(c.Email) > maxEmailLen {
+		return fmt.Errorf("invalid email %q", c.Email)
+	}
+	if len(c.Password) < minPasswordLen || len(c.Password) > maxPasswordLength {
+		return fmt.Errorf("password must be between %d and %d bytes", minPasswordLen, maxPasswordLength)
+	}
+	return nil
+}
+
+// execer là phần chung của *sql.DB và *sql.Tx dùng để ghi
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// issueTokens ký access token và lưu một refresh token mới cho người dùng
+func issueTokens(cfg *config.Configuration, db execer, userID int64) (authTokens, error) {
+	now := time.Now()
+	access, expires, err := auth.NewAccessToken(cfg.JWTSecret, userID, cfg.AccessTokenTTL, now)
+	if err != nil {
+		return authTokens{}, err
+	}
+	refresh, err := auth.NewRefreshToken()
+	if err != nil {
+		return authTokens{}, err
+	}
+	refreshExpires := now.Add(cfg.RefreshTokenTTL)
+	_, err = db.Exec("INSERT INTO refresh_token (user_id, token_hash, expires_at) VALUES ($1, $2, $3)",
+		userID, auth.HashRefreshToken(refresh), refreshExpires)
+	if err != nil {
+		return authTokens{}, err
+	}
+	return authTokens{
+		AccessToken:      access,
+		TokenType:        "Bearer",
+		ExpiresAt:        expires,
+		RefreshToken:     refresh,
+		RefreshExpiresAt: refreshExpires,
+	}, nil
+}
+
+// rotateRefreshTokenInDB thu hồi refresh token đã dùng và cấp cặp token mới trong một transaction
+func rotateRefreshTokenInDB(cfg *config.Configuration, refresh string) (authTokens, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return authTokens{}, err
+	}
+	defer tx.Rollback()
+
+	var id, userID int64
+	var expiresAt time.Time
+	var revokedAt sql.NullTime
+	err = tx.QueryRow("SELECT id, user_id, expires_at, revoked_at FROM refresh_token WHERE token_hash = $1 FOR UPDATE",
+		auth.HashRefreshToken(refresh)).Scan(&id, &userID, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return authTokens{}, errInvalidRefreshToken
+	}
+	if err != nil {
+		return authTokens{}, err
+	}
+
+	if revokedAt.Valid {
+		// Token bị dùng lại: có thể đã lộ, nên mọi phiên của người dùng phải đăng nhập lại
+		if _, err := tx.Exec("UPDATE refresh_token SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL", userID); err != nil {
+			return authTokens{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return authTokens{}, err
+		}
+		return authTokens{}, errReusedRefreshToken
+	}
+	if !expiresAt.After(time.Now()) {
+		return authTokens{}, errInvalidRefreshToken
+	}
+
+	if _, err := tx.Exec("UPDATE refresh_token SET revoked_at = NOW() WHERE id = $1", id); err != nil {
+		return authTokens{}, err
+	}
+	tokens, err := issueTokens(cfg, tx, userID)
+	if err != nil {
+		return authTokens{}, err
+	}
+	return tokens, tx.Commit()
+}
+
+func createUserInDB(email, passwordHash string) (models.User, error) {
+	user := models.User{Email: email}
+	err := database.DB.QueryRow("INSERT INTO app_user (email, password_hash) VALUES ($1, $2) RETURNING id, created_at",
+		email, passwordHash).Scan(&user.ID, &user.CreatedAt)
+	return user, err
+}
+
+func getUserByEmailFromDB(email string) (models.User, error) {
+	user := models.User{Email: email}
+	err := database.DB.QueryRow("SELECT id, password_hash, created_at FROM app_user WHERE email = $1", email).
+		Scan(&user.ID, &user.PasswordHash, &user.CreatedAt)
+	return user, err
+}
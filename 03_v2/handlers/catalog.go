@@ -0,0 +1,442 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"vocabulary/database"
+	"vocabulary/models"
+	"vocabulary/ssml"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// ListVoicesHandler liệt kê danh mục giọng đọc, lọc theo lang (ví dụ "vi" hoặc "vi-VN") nếu có
+func ListVoicesHandler(ctx iris.Context) {
+	voices, err := getVoicesFromDB(ctx.URLParam("lang"))
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load voices: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"voices": voices,
+		},
+	})
+}
+
+// CreateVoiceHandler thêm một giọng đọc vào danh mục
+func CreateVoiceHandler(ctx iris.Context) {
+	var voice models.Voice
+	if err := ctx.ReadJSON(&voice); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	if !checkVoice(ctx, &voice) {
+		return
+	}
+
+	_, err := database.DB.Exec("INSERT INTO voice (name, lang, gender, style, display_name) VALUES ($1, $2, $3, $4, $5)",
+		voice.Name, voice.Lang, voice.Gender, voice.Style, voice.DisplayName)
+	if isUniqueViolation(err) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Voice %q already exists", voice.Name)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save voice: %v", err)})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(APIResponse{Status: "success", Data: voice})
+}
+
+// UpdateVoiceHandler sửa thông tin một giọng đọc; tên giọng lấy từ route
+func UpdateVoiceHandler(ctx iris.Context) {
+	name := ctx.Params().Get("name")
+
+	var voice models.Voice
+	if err := ctx.ReadJSON(&voice); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	voice.Name = name
+	if !checkVoice(ctx, &voice) {
+		return
+	}
+
+	res, err := database.DB.Exec("UPDATE voice SET lang = $2, gender = $3, style = $4, display_name = $5 WHERE name = $1",
+		voice.Name, voice.Lang, voice.Gender, voice.Style, voice.DisplayName)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to update voice: %v", err)})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Voice %q not found", name)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: voice})
+}
+
+// DeleteVoiceHandler xoá một giọng đọc; nhân vật đang dùng giọng này sẽ mất giọng mặc định
+func DeleteVoiceHandler(ctx iris.Context) {
+	name := ctx.Params().Get("name")
+
+	res, err := database.DB.Exec("DELETE FROM voice WHERE name = $1", name)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to delete voice: %v", err)})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Voice %q not found", name)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"name": name}})
+}
+
+// ListCharactersHandler liệt kê các nhân vật
+func ListCharactersHandler(ctx iris.Context) {
+	characters, err := getCharactersFromDB()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load characters: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"characters": characters,
+		},
+	})
+}
+
+// GetCharacterHandler trả về một nhân vật theo id
+func GetCharacterHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid character id"})
+		return
+	}
+
+	character, err := getCharacterFromDB(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Character %d not found", id)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load character: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: character})
+}
+
+// CreateCharacterHandler thêm một nhân vật
+func CreateCharacterHandler(ctx iris.Context) {
+	character, ok := readCharacter(ctx)
+	if !ok {
+		return
+	}
+
+	err := database.DB.QueryRow(`INSERT INTO character_profile (name, nationality, gender, persona, default_voice)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')) RETURNING id`,
+		character.Name, character.Nationality, character.Gender, character.Persona, character.DefaultVoice).Scan(&character.ID)
+	if !writeCharacterError(ctx, character, err) {
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(APIResponse{Status: "success", Data: character})
+}
+
+// UpdateCharacterHandler sửa một nhân vật
+func UpdateCharacterHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid character id"})
+		return
+	}
+
+	character, ok := readCharacter(ctx)
+	if !ok {
+		return
+	}
+	character.ID = id
+
+	res, err := database.DB.Exec(`UPDATE character_profile SET name = $2, nationality = $3, gender = $4, persona = $5,
+		default_voice = NULLIF($6, '') WHERE id = $1`,
+		character.ID, character.Name, character.Nationality, character.Gender, character.Persona, character.DefaultVoice)
+	if !writeCharacterError(ctx, character, err) {
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Character %d not found", id)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: character})
+}
+
+// DeleteCharacterHandler xoá một nhân vật
+func DeleteCharacterHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid character id"})
+		return
+	}
+
+	res, err := database.DB.Exec("DELETE FROM character_profile WHERE id = $1", id)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to delete character: %v", err)})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Character %d not found", id)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"id": id}})
+}
+
+// checkVoice chuẩn hoá và kiểm tra một giọng đọc, tự trả lỗi nếu không hợp lệ
+func checkVoice(ctx iris.Context, voice *models.Voice) bool {
+	voice.Name = strings.TrimSpace(voice.Name)
+	voice.Gender = strings.ToLower(strings.TrimSpace(voice.Gender))
+	voice.Style = strings.TrimSpace(voice.Style)
+	voice.DisplayName = strings.TrimSpace(voice.DisplayName)
+
+	if voice.Name == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'name'"})
+		return false
+	}
+	lang, err := ssml.NormalizeLang(voice.Lang)
+	if err != nil || strings.TrimSpace(voice.Lang) == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid 'lang' %q", voice.Lang)})
+		return false
+	}
+	voice.Lang = lang
+	if voice.DisplayName == "" {
+		voice.DisplayName = voice.Name
+	}
+	return true
+}
+
+// readCharacter đọc và kiểm tra body của yêu cầu tạo/sửa nhân vật, tự trả lỗi nếu không hợp lệ
+func readCharacter(ctx iris.Context) (models.Character, bool) {
+	var character models.Character
+	if err := ctx.ReadJSON(&character); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return character, false
+	}
+
+	character.Name = strings.TrimSpace(character.Name)
+	character.Nationality = strings.TrimSpace(character.Nationality)
+	character.Gender = strings.ToLower(strings.TrimSpace(character.Gender))
+	character.Persona = strings.TrimSpace(character.Persona)
+	character.DefaultVoice = strings.TrimSpace(character.DefaultVoice)
+
+	if character.Name == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'name'"})
+		return character, false
+	}
+	return character, true
+}
+
+// writeCharacterError trả lỗi phù hợp cho lệnh ghi nhân vật; trả về true nếu không có lỗi
+func writeCharacterError(ctx iris.Context, character models.Character, err error) bool {
+	var pqErr *pq.Error
+	switch {
+	case err == nil:
+		return true
+	case isUniqueViolation(err):
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Character %q already exists", character.Name)})
+	case errors.As(err, &pqErr) && pqErr.Code == "23503":
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Voice %q is not in the voice catalog", character.DefaultVoice)})
+	default:
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save character: %v", err)})
+	}
+	return false
+}
+
+// getVoicesFromDB đọc danh mục giọng đọc; lang rỗng trả về tất cả, "vi" khớp mọi giọng "vi-*"
+func getVoicesFromDB(lang string) ([]models.Voice, error) {
+	rows, err := database.DB.Query(`SELECT name, lang, gender, style, display_name FROM voice
+		WHERE $1::text = '' OR lower(lang) = lower($1::text) OR lower(lang) LIKE lower($1::text) || '-%'
+		ORDER BY lang, name`, strings.TrimSpace(lang))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	voices := []models.Voice{}
+	for rows.Next() {
+		var v models.Voice
+		if err := rows.Scan(&v.Name, &v.Lang, &v.Gender, &v.Style, &v.DisplayName); err != nil {
+			return nil, err
+		}
+		voices = append(voices, v)
+	}
+	return voices, rows.Err()
+}
+
+// getVoiceNamesFromDB trả về tên các giọng trong danh mục, dùng để kiểm tra SSML
+func getVoiceNamesFromDB() ([]string, error) {
+	voices, err := getVoicesFromDB("")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(voices))
+	for i, v := range voices {
+		names[i] = v.Name
+	}
+	return names, nil
+}
+
+const characterColumns = "id, name, nationality, gender, persona, COALESCE(default_voice, '')"
+
+func scanCharacter(row interface{ Scan(...interface{}) error }) (models.Character, error) {
+	var c models.Character
+	err := row.Scan(&c.ID, &c.Name, &c.Nationality, &c.Gender, &c.Persona, &c.DefaultVoice)
+	return c, err
+}
+
+func getCharacterFromDB(id int64) (models.Character, error) {
+	return scanCharacter(database.DB.QueryRow("SELECT "+characterColumns+" FROM character_profile WHERE id = $1", id))
+}
+
+func getCharactersFromDB() ([]models.Character, error) {
+	rows, err := database.DB.Query("SELECT " + characterColumns + " FROM character_profile ORDER BY name")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	characters := []models.Character{}
+	for rows.Next() {
+		c, err := scanCharacter(rows)
+		if err != nil {
+			return nil, err
+		}
+		characters = append(characters, c)
+	}
+	return characters, rows.Err()
+}
+
+// getCharactersByNameFromDB tìm nhân vật theo tên (không phân biệt hoa thường), giữ thứ tự của names
+func getCharactersByNameFromDB(names []string) ([]models.Character, error) {
+	characters, err := getCharactersFromDB()
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]models.Character)
+	for _, c := range characters {
+		byName[strings.ToLower(c.Name)] = c
+	}
+
+	var found []models.Character
+	for _, name := range names {
+		if c, ok := byName[strings.ToLower(strings.TrimSpace(name))]; ok {
+			found = append(found, c)
+		}
+	}
+	return found, nil
+}
+
+// getCharacterVoices trả về giọng mặc định của những người nói trùng tên với một nhân vật
+func getCharacterVoices(speakers []string) (map[string]string, error) {
+	characters, err := getCharactersByNameFromDB(speakers)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]string)
+	for _, c := range characters {
+		if c.DefaultVoice != "" {
+			byName[strings.ToLower(c.Name)] = c.DefaultVoice
+		}
+	}
+
+	voices := make(map[string]string)
+	for _, speaker := range speakers {
+		if voice := byName[strings.ToLower(speaker)]; voice != "" {
+			voices[speaker] = voice
+		}
+	}
+	return voices, nil
+}
+
+// describeCharacters mô tả các nhân vật để đưa vào prompt sinh hội thoại, mỗi nhân vật một dòng
+func describeCharacters(characters []models.Character) string {
+	var lines []string
+	for _, c := range characters {
+		line := "- " + c.Name
+		var details []string
+		if c.Nationality != "" {
+			details = append(details, "quốc tịch "+c.Nationality)
+		}
+		switch c.Gender {
+		case "male":
+			details = append(details, "nam")
+		case "female":
+			details = append(details, "nữ")
+		}
+		if len(details) > 0 {
+			line += " (" + strings.Join(details, ", ") + ")"
+		}
+		if c.Persona != "" {
+			line += ": " + c.Persona
+		}
+		lines = append(lines, line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// resolveDialogVoices gộp ánh xạ giọng đã lưu của hội thoại với giọng mặc định của nhân vật;
+// ánh xạ đã lưu được ưu tiên
+func resolveDialogVoices(dialogID int64, speakers []string) (map[string]string, error) {
+	voices, err := getDialogVoicesFromDB(dialogID)
+	if err != nil {
+		return nil, err
+	}
+	characterVoices, err := getCharacterVoices(speakers)
+	if err != nil {
+		return nil, err
+	}
+	for speaker, voice := range characterVoices {
+		if voices[speaker] == "" {
+			voices[speaker] = voice
+		}
+	}
+	return voices, nil
+}
@@ -0,0 +1,629 @@
+package handlers
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"vocabulary/anki"
+	"vocabulary/database"
+	"vocabulary/langtag"
+	"vocabulary/models"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// maxDeckWords giới hạn số từ thêm vào bộ thẻ trong một request
+const maxDeckWords = 500
+
+var (
+	// errUnknownWord được trả về khi một id từ không có trong bảng word
+	errUnknownWord = errors.New("unknown word")
+	// errNoDialogWords được trả về khi tạo bộ thẻ từ hội thoại chưa có từ nào được lưu
+	errNoDialogWords = errors.New("dialog has no saved words")
+)
+
+// deckRequest là body của POST /decks và PUT /decks/{id}
+type deckRequest struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	WordIDs     []int64 `json:"wordIDs"`
+}
+
+// ListDecksHandler trả về các bộ thẻ của người dùng đang đăng nhập kèm số từ
+func ListDecksHandler(ctx iris.Context) {
+	decks, err := getDecksFromDB(currentUserID(ctx))
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load decks: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"decks": decks}})
+}
+
+// CreateDeckHandler tạo bộ thẻ từ {"name", "description", "wordIDs"}; wordIDs có thể rỗng
+func CreateDeckHandler(ctx iris.Context) {
+	request, ok := readDeckRequest(ctx, true)
+	if !ok {
+		return
+	}
+
+	deck, err := createDeckInDB(currentUserID(ctx), request.Name, request.Description, 0, request.WordIDs)
+	if !writeDeckError(ctx, request.Name, err) {
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(APIResponse{Status: "success", Data: deck})
+}
+
+// CreateDialogDeckHandler tạo bộ thẻ gồm các từ đã lưu của một hội thoại, giữ nghĩa và câu ví dụ
+// của từ trong hội thoại đó. Body không bắt buộc; tên mặc định lấy từ chủ đề của hội thoại.
+func CreateDialogDeckHandler(ctx iris.Context) {
+	var request deckRequest
+	if ctx.GetContentLength() > 0 {
+		if err := ctx.ReadJSON(&request); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+			return
+		}
+	}
+
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	request.Description = strings.TrimSpace(request.Description)
+	if request.Name == "" {
+		request.Name = fmt.Sprintf("Dialog %d", dialog.ID)
+		if dialog.Topic != "" {
+			request.Name = fmt.Sprintf("Dialog %d: %s", dialog.ID, dialog.Topic)
+		}
+	}
+
+	deck, err := createDeckInDB(currentUserID(ctx), request.Name, request.Description, dialog.ID, nil)
+	if errors.Is(err, errNoDialogWords) {
+		ctx.StatusCode(iris.StatusUnprocessableEntity)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Dialog %d has no saved words", dialog.ID)})
+		return
+	}
+	if !writeDeckError(ctx, request.Name, err) {
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(APIResponse{Status: "success", Data: deck})
+}
+
+// GetDeckHandler trả về một bộ thẻ cùng các từ, bản dịch và câu ví dụ
+func GetDeckHandler(ctx iris.Context) {
+	deck, ok := loadDeck(ctx)
+	if !ok {
+		return
+	}
+
+	words, err := getDeckWordsFromDB(deck.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load deck words: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"deck": deck, "words": words}})
+}
+
+// UpdateDeckHandler đổi tên và mô tả của bộ thẻ; wordIDs bị bỏ qua
+func UpdateDeckHandler(ctx iris.Context) {
+	deck, ok := loadDeck(ctx)
+	if !ok {
+		return
+	}
+	request, ok := readDeckRequest(ctx, false)
+	if !ok {
+		return
+	}
+
+	err := database.DB.QueryRow(`UPDATE deck SET name = $3, description = $4, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 RETURNING updated_at`,
+		deck.ID, currentUserID(ctx), request.Name, request.Description).Scan(&deck.UpdatedAt)
+	if !writeDeckError(ctx, request.Name, err) {
+		return
+	}
+	deck.Name = request.Name
+	deck.Description = request.Description
+
+	ctx.JSON(APIResponse{Status: "success", Data: deck})
+}
+
+// DeleteDeckHandler xoá một bộ thẻ; các từ vẫn nằm trong từ vựng của người dùng
+func DeleteDeckHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid deck id"})
+		return
+	}
+
+	deleted, err := deleteDeckFromDB(currentUserID(ctx), id)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to delete deck: %v", err)})
+		return
+	}
+	if !deleted {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Deck %d not found", id)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"id": id}})
+}
+
+// AddDeckWordsHandler thêm các từ {"wordIDs"} vào bộ thẻ; từ đã có trong bộ thẻ được bỏ qua
+func AddDeckWordsHandler(ctx iris.Context) {
+	deck, ok := loadDeck(ctx)
+	if !ok {
+		return
+	}
+
+	var request deckRequest
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	if len(request.WordIDs) == 0 || len(request.WordIDs) > maxDeckWords {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("'wordIDs' must contain between 1 and %d ids", maxDeckWords)})
+		return
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to add words: %v", err)})
+		return
+	}
+	defer tx.Rollback()
+
+	added, err := addDeckWordsTx(tx, currentUserID(ctx), deck.ID, request.WordIDs)
+	if err == nil {
+		err = tx.Commit()
+	}
+	if !writeDeckError(ctx, deck.Name, err) {
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"added": added, "wordCount": deck.WordCount + added}})
+}
+
+// RemoveDeckWordHandler bỏ một từ khỏi bộ thẻ
+func RemoveDeckWordHandler(ctx iris.Context) {
+	deck, ok := loadDeck(ctx)
+	if !ok {
+		return
+	}
+	wordID, err := ctx.Params().GetInt64("wordID")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid word id"})
+		return
+	}
+
+	res, err := database.DB.Exec("DELETE FROM deck_word WHERE deck_id = $1 AND word_id = $2", deck.ID, wordID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to remove word: %v", err)})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d is not in deck %d", wordID, deck.ID)})
+		return
+	}
+	database.DB.Exec("UPDATE deck SET updated_at = NOW() WHERE id = $1", deck.ID)
+
+	ctx.JSON(APIResponse{Status: "success"})
+}
+
+// ExportDeckHandler xuất bộ thẻ. format=apkg (mặc định) cho gói Anki, csv hoặc tsv cho các công cụ
+// kiểu Quizlet (cột: từ, nghĩa, câu ví dụ, phiên âm, từ loại, cấp độ). Mặt sau của thẻ là bản dịch
+// sang ngôn ngữ lang (mặc định en). header=true thêm dòng tiêu đề cho csv/tsv.
+func ExportDeckHandler(ctx iris.Context) {
+	format := ctx.URLParamDefault("format", "apkg")
+	if format != "apkg" && format != "csv" && format != "tsv" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Unsupported format %q, expected apkg, csv or tsv", format)})
+		return
+	}
+	lang, err := langtag.NormalizeDefault(ctx.URLParam("lang"), langtag.DefaultTarget)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+		return
+	}
+	header := ctx.URLParamBoolDefault("header", false)
+
+	deck, ok := loadDeck(ctx)
+	if !ok {
+		return
+	}
+	words, err := getDeckWordsFromDB(deck.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load deck words: %v", err)})
+		return
+	}
+
+	var buf bytes.Buffer
+	var contentType string
+	switch format {
+	case "apkg":
+		contentType = anki.ContentType
+		err = anki.WritePackage(&buf, ankiDeck(deck, words, lang), time.Now())
+	case "csv":
+		contentType = "text/csv; charset=utf-8"
+		err = writeDeckCSV(&buf, words, lang, header)
+	case "tsv":
+		contentType = "text/tab-separated-values; charset=utf-8"
+		err = writeDeckTSV(&buf, words, lang, header)
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to export deck: %v", err)})
+		return
+	}
+
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="deck-%d.%s"`, deck.ID, format))
+	ctx.ContentType(contentType)
+	ctx.Write(buf.Bytes())
+}
+
+// readDeckRequest đọc và chuẩn hoá body của bộ thẻ, tự trả lỗi nếu không hợp lệ
+func readDeckRequest(ctx iris.Context, withWords bool) (deckRequest, bool) {
+	var request deckRequest
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return request, false
+	}
+
+	request.Name = strings.TrimSpace(request.Name)
+	request.Description = strings.TrimSpace(request.Description)
+	if request.Name == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'name'"})
+		return request, false
+	}
+	if !withWords {
+		request.WordIDs = nil
+	} else if len(request.WordIDs) > maxDeckWords {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("'wordIDs' must contain at most %d ids", maxDeckWords)})
+		return request, false
+	}
+	return request, true
+}
+
+// writeDeckError trả lỗi phù hợp cho lệnh ghi bộ thẻ; trả về true nếu không có lỗi
+func writeDeckError(ctx iris.Context, name string, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case isUniqueViolation(err):
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Deck %q already exists", name)})
+	case errors.Is(err, errUnknownWord):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+	default:
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save deck: %v", err)})
+	}
+	return false
+}
+
+// loadDeck đọc bộ thẻ theo tham số {id} của người dùng đang đăng nhập, tự trả 400/404/500 nếu lỗi.
+// Bộ thẻ của người khác được coi như không tồn tại.
+func loadDeck(ctx iris.Context) (models.Deck, bool) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid deck id"})
+		return models.Deck{}, false
+	}
+
+	deck, err := getDeckFromDB(currentUserID(ctx), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Deck %d not found", id)})
+		return models.Deck{}, false
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load deck: %v", err)})
+		return models.Deck{}, false
+	}
+	return deck, true
+}
+
+// ankiDeck chuyển các từ của bộ thẻ thành note Anki; ghi chú gồm từ loại, cấp độ và giải nghĩa
+func ankiDeck(deck models.Deck, words []models.Word, lang string) anki.Deck {
+	out := anki.Deck{ID: deck.ID, Name: deck.Name, Description: deck.Description}
+	for _, w := range words {
+		var notes, tags []string
+		for _, s := range []string{w.PartOfSpeech, w.Difficulty, w.Glosses[lang]} {
+			if s != "" {
+				notes = append(notes, s)
+			}
+		}
+		for _, s := range []string{w.Difficulty, w.PartOfSpeech} {
+			if s != "" {
+				tags = append(tags, s)
+			}
+		}
+		out.Notes = append(out.Notes, anki.Note{
+			Key:           fmt.Sprintf("%d:%d", w.ID, w.SenseID),
+			Front:         w.Content,
+			Back:          deckTranslation(w, lang),
+			Pronunciation: w.Pronunciation,
+			Example:       w.Example,
+			Notes:         strings.Join(notes, " · "),
+			Tags:          tags,
+		})
+	}
+	return out
+}
+
+// deckTranslation trả về bản dịch sang lang, nếu không có thì bản dịch đầu tiên theo mã ngôn ngữ
+func deckTranslation(w models.Word, lang string) string {
+	if text, ok := w.Translations[lang]; ok {
+		return text
+	}
+	langs := make([]string, 0, len(w.Translations))
+	for l := range w.Translations {
+		langs = append(langs, l)
+	}
+	if len(langs) == 0 {
+		return ""
+	}
+	sort.Strings(langs)
+	return w.Translations[langs[0]]
+}
+
+// deckRows trả về các dòng xuất csv/tsv, có dòng tiêu đề nếu header
+func deckRows(words []models.Word, lang string, header bool) [][]string {
+	var rows [][]string
+	if header {
+		rows = append(rows, []string{"word", "translation", "example", "pronunciation", "pos", "difficulty"})
+	}
+	for _, w := range words {
+		rows = append(rows, []string{w.Content, deckTranslation(w, lang), w.Example, w.Pronunciation, w.PartOfSpeech, w.Difficulty})
+	}
+	return rows
+}
+
+func writeDeckCSV(w io.Writer, words []models.Word, lang string, header bool) error {
+	cw := csv.NewWriter(w)
+	cw.WriteAll(deckRows(words, lang, header))
+	return cw.Error()
+}
+
+// writeDeckTSV ghi mỗi từ một dòng, các cột cách nhau bởi tab. Quizlet không hiểu dấu nháy của CSV
+// nên tab và xuống dòng trong nội dung được thay bằng khoảng trắng thay vì được đặt trong nháy.
+func writeDeckTSV(w io.Writer, words []models.Word, lang string, header bool) error {
+	clean := strings.NewReplacer("\t", " ", "\r\n", " ", "\n", " ", "\r", " ")
+	for _, row := range deckRows(words, lang, header) {
+		for i, field := range row {
+			row[i] = clean.Replace(field)
+		}
+		if _, err := io.WriteString(w, strings.Join(row, "\t")+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func getDecksFromDB(userID int64) ([]models.Deck, error) {
+	rows, err := database.DB.Query(`SELECT d.id, d.name, d.description, COALESCE(d.dialog_id, 0), d.created_at, d.updated_at,
+			(SELECT COUNT(*) FROM deck_word dw WHERE dw.deck_id = d.id)
+		FROM deck d WHERE d.user_id = $1 ORDER BY d.updated_at DESC, d.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	decks := []models.Deck{}
+	for rows.Next() {
+		var d models.Deck
+		if err := rows.Scan(&d.ID, &d.Name, &d.Description, &d.DialogID, &d.CreatedAt, &d.UpdatedAt, &d.WordCount); err != nil {
+			return nil, err
+		}
+		decks = append(decks, d)
+	}
+	return decks, rows.Err()
+}
+
+func getDeckFromDB(userID, deckID int64) (models.Deck, error) {
+	var d models.Deck
+	err := database.DB.QueryRow(`SELECT d.id, d.name, d.description, COALESCE(d.dialog_id, 0), d.created_at, d.updated_at,
+			(SELECT COUNT(*) FROM deck_word dw WHERE dw.deck_id = d.id)
+		FROM deck d WHERE d.id = $1 AND d.user_id = $2`, deckID, userID).
+		Scan(&d.ID, &d.Name, &d.Description, &d.DialogID, &d.CreatedAt, &d.UpdatedAt, &d.WordCount)
+	return d, err
+}
+
+// createDeckInDB tạo bộ thẻ; dialogID khác 0 thì thêm các từ đã lưu của hội thoại đó, ngược lại thêm wordIDs.
+// Từ trong bộ thẻ cũng được thêm vào từ vựng của người dùng.
+func createDeckInDB(userID int64, name, description string, dialogID int64, wordIDs []int64) (models.Deck, error) {
+	deck := models.Deck{Name: name, Description: description, DialogID: dialogID}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return deck, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`INSERT INTO deck (user_id, name, description, dialog_id) VALUES ($1, $2, $3, NULLIF($4::bigint, 0))
+		RETURNING id, created_at, updated_at`, userID, name, description, dialogID).
+		Scan(&deck.ID, &deck.CreatedAt, &deck.UpdatedAt)
+	if err != nil {
+		return deck, err
+	}
+
+	if dialogID != 0 {
+		res, err := tx.Exec(`INSERT INTO deck_word (deck_id, word_id, sense_id, example)
+			SELECT $1, word_id, sense_id, example FROM word_dialog WHERE dialog_id = $2`, deck.ID, dialogID)
+		if err != nil {
+			return deck, err
+		}
+		n, _ := res.RowsAffected()
+		if n == 0 {
+			return deck, errNoDialogWords
+		}
+		deck.WordCount = int(n)
+		if _, err := tx.Exec(`INSERT INTO user_word (user_id, word_id)
+			SELECT $1, word_id FROM word_dialog WHERE dialog_id = $2 ON CONFLICT DO NOTHING`, userID, dialogID); err != nil {
+			return deck, err
+		}
+	} else if len(wordIDs) > 0 {
+		if deck.WordCount, err = addDeckWordsTx(tx, userID, deck.ID, wordIDs); err != nil {
+			return deck, err
+		}
+	}
+	return deck, tx.Commit()
+}
+
+// addDeckWordsTx thêm các từ vào bộ thẻ và trả về số từ mới được thêm. Nghĩa và câu ví dụ lấy từ
+// lần gần nhất từ được lưu cùng một hội thoại có câu ví dụ.
+func addDeckWordsTx(tx *sql.Tx, userID, deckID int64, wordIDs []int64) (int, error) {
+	ids := uniqueIDs(wordIDs)
+
+	rows, err := tx.Query("SELECT id FROM word WHERE id = ANY($1)", pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	found := make(map[int64]bool)
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		found[id] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	for _, id := range ids {
+		if !found[id] {
+			return 0, fmt.Errorf("%w: word %d not found", errUnknownWord, id)
+		}
+	}
+
+	res, err := tx.Exec(`INSERT INTO deck_word (deck_id, word_id, sense_id, example)
+		SELECT $1, w.id, wd.sense_id, COALESCE(wd.example, '') FROM word w
+		LEFT JOIN LATERAL (SELECT sense_id, example FROM word_dialog WHERE word_id = w.id
+			ORDER BY example = '', dialog_id DESC LIMIT 1) wd ON true
+		WHERE w.id = ANY($2)
+		ON CONFLICT (deck_id, word_id) DO NOTHING`, deckID, pq.Array(ids))
+	if err != nil {
+		return 0, err
+	}
+	added, _ := res.RowsAffected()
+
+	if _, err := tx.Exec(`INSERT INTO user_word (user_id, word_id) SELECT $1, unnest($2::bigint[])
+		ON CONFLICT DO NOTHING`, userID, pq.Array(ids)); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE deck SET updated_at = NOW() WHERE id = $1", deckID); err != nil {
+		return 0, err
+	}
+	return int(added), nil
+}
+
+// uniqueIDs bỏ các id trùng, giữ thứ tự xuất hiện đầu tiên
+func uniqueIDs(ids []int64) []int64 {
+	seen := make(map[int64]bool, len(ids))
+	out := make([]int64, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+func deleteDeckFromDB(userID, deckID int64) (bool, error) {
+	res, err := database.DB.Exec("DELETE FROM deck WHERE id = $1 AND user_id = $2", deckID, userID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// getDeckWordsFromDB đọc các từ của bộ thẻ theo thứ tự thêm vào. Bản dịch và giải nghĩa lấy từ nghĩa
+// đã chọn cho bộ thẻ; ngôn ngữ mà nghĩa đó chưa có bản dịch thì lấy từ nghĩa đầu tiên của từ.
+func getDeckWordsFromDB(deckID int64) ([]models.Word, error) {
+	rows, err := database.DB.Query(`SELECT w.id, w.lang, w.content, w.pronunciation, w.part_of_speech, w.difficulty,
+			COALESCE(dw.sense_id, 0), dw.example
+		FROM deck_word dw JOIN word w ON w.id = dw.word_id
+		WHERE dw.deck_id = $1 ORDER BY dw.added_at, w.id`, deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := []models.Word{}
+	index := make(map[int64]int)
+	for rows.Next() {
+		var w models.Word
+		if err := rows.Scan(&w.ID, &w.Lang, &w.Content, &w.Pronunciation, &w.PartOfSpeech, &w.Difficulty, &w.SenseID, &w.Example); err != nil {
+			return nil, err
+		}
+		w.Translations = make(map[string]string)
+		w.Glosses = make(map[string]string)
+		index[w.ID] = len(words)
+		words = append(words, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(words) == 0 {
+		return words, nil
+	}
+
+	rows, err = database.DB.Query(`SELECT DISTINCT ON (t.word_id, t.lang) t.word_id, t.lang, t.text, t.gloss
+		FROM word_translation t JOIN deck_word dw ON dw.word_id = t.word_id AND dw.deck_id = $1
+		ORDER BY t.word_id, t.lang, t.sense_id IS DISTINCT FROM dw.sense_id, t.sense_id`, deckID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var wordID int64
+		var lang, text, gloss string
+		if err := rows.Scan(&wordID, &lang, &text, &gloss); err != nil {
+			return nil, err
+		}
+		w := &words[index[wordID]]
+		w.Translations[lang] = text
+		if gloss != "" {
+			w.Glosses[lang] = gloss
+		}
+	}
+	return words, rows.Err()
+}
@@ -0,0 +1,610 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"vocabulary/database"
+	"vocabulary/dialogue"
+	"vocabulary/langtag"
+	"vocabulary/models"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// GetDialogHandler trả về một hội thoại đã lưu cùng các lượt nói dạng có cấu trúc
+// và các từ vựng đã lưu của hội thoại (bản dịch, giải nghĩa, từ loại, câu ví dụ, phát âm, cấp độ).
+// raw=true kèm theo phản hồi gốc của mô hình.
+func GetDialogHandler(ctx iris.Context) {
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	data, err := dialogData(dialog)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog: %v", err)})
+		return
+	}
+	if ctx.URLParamBoolDefault("raw", false) {
+		data["raw"] = dialog.Raw
+	}
+	ctx.JSON(APIResponse{Status: "success", Data: data})
+}
+
+// dialogData trả về hội thoại theo dạng của GET /dialogs/{id}
+func dialogData(dialog models.Dialog) (map[string]interface{}, error) {
+	parsed, err := parseDialog(dialog)
+	if err != nil {
+		return nil, fmt.Errorf("load dialog turns: %w", err)
+	}
+
+	words, err := getDialogWordsFromDB(dialog.ID)
+	if err != nil {
+		return nil, fmt.Errorf("load dialog words: %w", err)
+	}
+
+	return map[string]interface{}{
+		"dialogID":       dialog.ID,
+		"lang":           dialog.Lang,
+		"dialog":         dialog.Content,
+		"topic":          dialog.Topic,
+		"setting":        dialog.Setting,
+		"characters":     dialog.Characters,
+		"level":          dialog.Level,
+		"register":       dialog.Register,
+		"createdBy":      dialog.CreatedBy,
+		"createdAt":      dialog.CreatedAt,
+		"updatedAt":      dialog.UpdatedAt,
+		"speakers":       dialogue.Speakers(parsed.Turns),
+		"turns":          dialogTurnModels(dialog.ID, parsed.Turns),
+		"unmatchedLines": parsed.Unmatched,
+		"words":          words,
+	}, nil
+}
+
+// parseDialog trả về các lượt nói đã lưu trong dialog_turn cùng những dòng không có người nói.
+// Hội thoại cũ chưa có lượt nói được tách từ nội dung và lưu lại.
+func parseDialog(dialog models.Dialog) (dialogue.Result, error) {
+	parsed := dialogue.Parse(dialog.Content)
+
+	turns, err := getDialogTurnsFromDB(database.DB, dialog.ID)
+	if err != nil {
+		return parsed, err
+	}
+	if len(turns) == 0 && len(parsed.Turns) > 0 {
+		tx, err := database.DB.Begin()
+		if err != nil {
+			return parsed, err
+		}
+		defer tx.Rollback()
+		if err := saveDialogTurns(tx, dialog.ID, parsed.Turns); err != nil {
+			return parsed, err
+		}
+		return parsed, tx.Commit()
+	}
+
+	parsed.Turns = turns
+	return parsed, nil
+}
+
+// dialogTurnModels chuyển các lượt nói sang dạng JSON, số thứ tự bắt đầu từ 1
+func dialogTurnModels(dialogID int64, turns []dialogue.Turn) []models.DialogTurn {
+	result := make([]models.DialogTurn, len(turns))
+	for i, turn := range turns {
+		result[i] = models.DialogTurn{DialogID: dialogID, Ordinal: i + 1, Speaker: turn.Speaker, Text: turn.Text, Line: turn.Line}
+	}
+	return result
+}
+
+func saveDialogTurns(tx *sql.Tx, dialogID int64, turns []dialogue.Turn) error {
+	for _, turn := range dialogTurnModels(dialogID, turns) {
+		_, err := tx.Exec(`INSERT INTO dialog_turn (dialog_id, ordinal, speaker, text, line) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (dialog_id, ordinal) DO NOTHING`, turn.DialogID, turn.Ordinal, turn.Speaker, turn.Text, turn.Line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dialogTurnsInTx giống parseDialog nhưng đọc và lưu lượt nói trong tx, để thấy nội dung và
+// lượt nói vừa ghi trong cùng transaction mà không mở transaction thứ hai
+func dialogTurnsInTx(tx *sql.Tx, dialogID int64) ([]dialogue.Turn, error) {
+	turns, err := getDialogTurnsFromDB(tx, dialogID)
+	if err != nil || len(turns) > 0 {
+		return turns, err
+	}
+
+	var content string
+	if err := tx.QueryRow("SELECT content FROM dialog WHERE id = $1", dialogID).Scan(&content); err != nil {
+		return nil, err
+	}
+	turns = dialogue.Parse(content).Turns
+	return turns, saveDialogTurns(tx, dialogID, turns)
+}
+
+func getDialogTurnsFromDB(q sqlQuerier, dialogID int64) ([]dialogue.Turn, error) {
+	rows, err := q.Query("SELECT speaker, text, line FROM dialog_turn WHERE dialog_id = $1 ORDER BY ordinal", dialogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	turns := []dialogue.Turn{}
+	for rows.Next() {
+		var t dialogue.Turn
+		if err := rows.Scan(&t.Speaker, &t.Text, &t.Line); err != nil {
+			return nil, err
+		}
+		turns = append(turns, t)
+	}
+	return turns, rows.Err()
+}
+
+// getDialogWordsFromDB trả về các từ vựng của hội thoại cùng bản dịch của nghĩa được dùng và câu ví dụ trong hội thoại đó
+func getDialogWordsFromDB(dialogID int64) ([]models.Word, error) {
+	rows, err := database.DB.Query(`SELECT w.id, w.lang, w.content, w.pronunciation, w.part_of_speech, w.difficulty, wd.example,
+			COALESCE(wd.sense_id, 0), t.lang, t.text, t.gloss
+		FROM word_dialog wd
+		JOIN word w ON w.id = wd.word_id
+		LEFT JOIN word_translation t ON t.sense_id = wd.sense_id
+		WHERE wd.dialog_id = $1 ORDER BY w.id, t.lang`, dialogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := []models.Word{}
+	for rows.Next() {
+		var w models.Word
+		var lang, text, gloss sql.NullString
+		if err := rows.Scan(&w.ID, &w.Lang, &w.Content, &w.Pronunciation, &w.PartOfSpeech, &w.Difficulty, &w.Example, &w.SenseID, &lang, &text, &gloss); err != nil {
+			return nil, err
+		}
+		if len(words) == 0 || words[len(words)-1].ID != w.ID {
+			w.Translations = make(map[string]string)
+			w.Glosses = make(map[string]string)
+			words = append(words, w)
+		}
+		last := &words[len(words)-1]
+		if lang.Valid {
+			last.Translations[lang.String] = text.String
+			if gloss.String != "" {
+				last.Glosses[lang.String] = gloss.String
+			}
+		}
+	}
+	return words, rows.Err()
+}
+
+// maxDialogContentLen là độ dài tối đa (ký tự) của hội thoại nhập tay
+const maxDialogContentLen = 20000
+
+// dialogSortColumns là các cách sắp xếp của GET /dialogs
+var dialogSortColumns = map[string]sortColumn{
+	"id":        {Expr: "d.id"},
+	"createdAt": {Expr: "d.created_at", Cast: "timestamptz"},
+	"updatedAt": {Expr: "d.updated_at", Cast: "timestamptz"},
+	"topic":     {Expr: "d.topic", Cast: "text"},
+}
+
+// dialogSummary là một hội thoại trong danh sách, không kèm nội dung
+type dialogSummary struct {
+	ID         int64     `json:"id"`
+	Lang       string    `json:"lang"`
+	Topic      string    `json:"topic"`
+	Setting    string    `json:"setting"`
+	Characters []string  `json:"characters"`
+	Turns      int       `json:"turns"`
+	Level      string    `json:"level"`
+	Register   string    `json:"register"`
+	CreatedBy  int64     `json:"createdBy"`
+	WordCount  int       `json:"wordCount"`
+	CreatedAt  time.Time `json:"createdAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// dialogInput là body của POST /dialogs và PUT /dialogs/{id}
+type dialogInput struct {
+	Lang       string   `json:"lang"`
+	Content    string   `json:"dialog"`
+	Topic      string   `json:"topic"`
+	Setting    string   `json:"setting"`
+	Characters []string `json:"characters"`
+	Level      string   `json:"level"`
+	Register   string   `json:"register"`
+}
+
+// ListDialogsHandler liệt kê hội thoại đã lưu, phân trang bằng cursor (nextCursor của trang trước).
+// Lọc theo lang, topic (chứa chuỗi, không phân biệt hoa thường), level, register, createdBy và
+// from/to (ngày tạo); sort là id, createdAt (mặc định -createdAt), updatedAt hoặc topic.
+func ListDialogsHandler(ctx iris.Context) {
+	page, ok := readPageParams(ctx, dialogSortColumns, "-createdAt")
+	if !ok {
+		return
+	}
+
+	var where sqlWhere
+	if raw := ctx.URLParam("lang"); raw != "" {
+		lang, err := langtag.Normalize(raw)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+			return
+		}
+		where.add("d.lang = %s", lang)
+	}
+	if topic := strings.TrimSpace(ctx.URLParam("topic")); topic != "" {
+		where.add("d.topic ILIKE %s", likePattern(topic))
+	}
+	if raw := ctx.URLParam("level"); raw != "" {
+		level := cleanDifficulty(raw)
+		if level == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid 'level' %q, expected A1–C2", raw)})
+			return
+		}
+		where.add("d.level = %s", level)
+	}
+	if raw := ctx.URLParam("register"); raw != "" {
+		register := strings.ToLower(strings.TrimSpace(raw))
+		if dialogRegisters[register] == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid 'register' %q, expected formal, neutral or informal", raw)})
+			return
+		}
+		where.add("d.register = %s", register)
+	}
+	if ctx.URLParamExists("createdBy") {
+		createdBy, err := ctx.URLParamInt64("createdBy")
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: "Invalid 'createdBy'"})
+			return
+		}
+		where.add("d.created_by = %s", createdBy)
+	}
+	if !readDateRange(ctx, &where, "d.created_at") {
+		return
+	}
+	page.keyset(&where, "d.id")
+
+	dialogs, err := getDialogSummariesFromDB(&where, page)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialogs: %v", err)})
+		return
+	}
+
+	next := ""
+	if len(dialogs) > page.Limit {
+		dialogs = dialogs[:page.Limit]
+		last := dialogs[len(dialogs)-1]
+		next = page.nextCursor(dialogCursorValue(page.Sort, last), last.ID)
+	}
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"dialogs": dialogs, "nextCursor": next}})
+}
+
+// CreateDialogHandler lưu một hội thoại nhập tay (không gọi Groq). Nội dung theo định dạng
+// "Người nói: câu thoại" mỗi dòng; characters mặc định là những người nói trong hội thoại.
+func CreateDialogHandler(ctx iris.Context) {
+	dialog, turns, ok := readDialogInput(ctx)
+	if !ok {
+		return
+	}
+	dialog.CreatedBy = currentUserID(ctx)
+
+	id, err := saveDialogToDB(dialog, turns)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save dialog: %v", err)})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	respondDialog(ctx, id)
+}
+
+// UpdateDialogHandler thay toàn bộ nội dung và thông tin của hội thoại. Khi nội dung đổi, các lượt nói
+// và vị trí từ vựng được tính lại; từ vựng đã lưu vẫn gắn với hội thoại.
+func UpdateDialogHandler(ctx iris.Context) {
+	current, ok := loadDialog(ctx)
+	if !ok || !checkDialogOwner(ctx, current) {
+		return
+	}
+	dialog, turns, ok := readDialogInput(ctx)
+	if !ok {
+		return
+	}
+	dialog.ID = current.ID
+
+	if err := updateDialogInDB(dialog, turns, dialog.Content != current.Content); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to update dialog: %v", err)})
+		return
+	}
+
+	respondDialog(ctx, dialog.ID)
+}
+
+// DeleteDialogHandler xoá hội thoại cùng lượt nói, âm thanh và liên kết từ vựng; các từ vẫn được giữ
+func DeleteDialogHandler(ctx iris.Context) {
+	dialog, ok := loadDialog(ctx)
+	if !ok || !checkDialogOwner(ctx, dialog) {
+		return
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM dialog WHERE id = $1", dialog.ID); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to delete dialog: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"id": dialog.ID}})
+}
+
+// DialogWordsHandler trả về các từ vựng đã lưu của hội thoại
+func DialogWordsHandler(ctx iris.Context) {
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	words, err := getDialogWordsFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog words: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"dialogID": dialog.ID, "words": words}})
+}
+
+// AddDialogWordsHandler lưu từ cho hội thoại, giống POST /save-words nhưng lấy dialogID từ đường dẫn.
+// Chỉ người tạo hội thoại được thêm từ, giống khi sửa hay xoá hội thoại.
+func AddDialogWordsHandler(ctx iris.Context) {
+	var request struct {
+		Source          string              `json:"source"`
+		Mode            string              `json:"mode"`
+		TranslatedWords []map[string]string `json:"translatedWords"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	dialog, ok := loadDialog(ctx)
+	if !ok || !checkDialogOwner(ctx, dialog) {
+		return
+	}
+
+	respondSaveWords(ctx, dialog.ID, request.Source, request.Mode, request.TranslatedWords)
+}
+
+// RemoveDialogWordHandler bỏ liên kết giữa từ và hội thoại; từ vẫn được giữ trong bảng word.
+// Chỉ người tạo hội thoại được bỏ từ.
+func RemoveDialogWordHandler(ctx iris.Context) {
+	dialog, ok := loadDialog(ctx)
+	if !ok || !checkDialogOwner(ctx, dialog) {
+		return
+	}
+	wordID, err := ctx.Params().GetInt64("wordID")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid word id"})
+		return
+	}
+
+	removed, err := removeDialogWordFromDB(dialog.ID, wordID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to remove word: %v", err)})
+		return
+	}
+	if !removed {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d is not linked to dialog %d", wordID, dialog.ID)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success"})
+}
+
+// readDialogInput đọc và kiểm tra body của hội thoại nhập tay, tự trả 400/422 nếu không hợp lệ
+func readDialogInput(ctx iris.Context) (models.Dialog, []dialogue.Turn, bool) {
+	var input dialogInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return models.Dialog{}, nil, false
+	}
+
+	dialog, err := input.dialog()
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid dialog: %v", err)})
+		return dialog, nil, false
+	}
+
+	parsed := dialogue.Parse(dialog.Content)
+	if len(parsed.Turns) == 0 {
+		ctx.StatusCode(iris.StatusUnprocessableEntity)
+		ctx.JSON(APIResponse{Status: "error", Error: "Dialog has no lines with a speaker"})
+		return dialog, nil, false
+	}
+	dialog.Turns = len(parsed.Turns)
+	if len(dialog.Characters) == 0 {
+		dialog.Characters = dialogue.Speakers(parsed.Turns)
+	}
+	return dialog, parsed.Turns, true
+}
+
+// dialog chuẩn hoá và kiểm tra các trường; level và register có thể trống
+func (in dialogInput) dialog() (models.Dialog, error) {
+	lang, err := langtag.NormalizeDefault(in.Lang, langtag.DefaultSource)
+	if err != nil {
+		return models.Dialog{}, err
+	}
+	dialog := models.Dialog{
+		Lang:     lang,
+		Content:  strings.TrimSpace(in.Content),
+		Topic:    strings.TrimSpace(in.Topic),
+		Setting:  strings.TrimSpace(in.Setting),
+		Level:    strings.ToUpper(strings.TrimSpace(in.Level)),
+		Register: strings.ToLower(strings.TrimSpace(in.Register)),
+	}
+
+	switch {
+	case dialog.Content == "":
+		return dialog, fmt.Errorf("missing 'dialog'")
+	case utf8.RuneCountInString(dialog.Content) > maxDialogContentLen:
+		return dialog, fmt.Errorf("'dialog' must be at most %d characters", maxDialogContentLen)
+	case utf8.RuneCountInString(dialog.Topic) > maxDialogTopicLen:
+		return dialog, fmt.Errorf("'topic' must be at most %d characters", maxDialogTopicLen)
+	case utf8.RuneCountInString(dialog.Setting) > maxDialogTopicLen:
+		return dialog, fmt.Errorf("'setting' must be at most %d characters", maxDialogTopicLen)
+	case dialog.Level != "" && dialogLevels[dialog.Level] == "":
+		return dialog, fmt.Errorf("unsupported level %q, expected A1–C2", in.Level)
+	case dialog.Register != "" && dialogRegisters[dialog.Register] == "":
+		return dialog, fmt.Errorf("unsupported register %q, expected formal, neutral or informal", in.Register)
+	}
+
+	for _, name := range in.Characters {
+		if name = strings.TrimSpace(name); name != "" {
+			dialog.Characters = append(dialog.Characters, name)
+		}
+	}
+	if len(dialog.Characters) > maxDialogCharacters {
+		return dialog, fmt.Errorf("at most %d characters are allowed", maxDialogCharacters)
+	}
+	return dialog, nil
+}
+
+// checkDialogOwner chỉ cho người tạo sửa hoặc xoá hội thoại; hội thoại không rõ người tạo
+// (tạo trước khi có tài khoản) thì người dùng đã đăng nhập nào cũng sửa được. Tự trả 403.
+func checkDialogOwner(ctx iris.Context, dialog models.Dialog) bool {
+	if dialog.CreatedBy != 0 && dialog.CreatedBy != currentUserID(ctx) {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Dialog %d belongs to another user", dialog.ID)})
+		return false
+	}
+	return true
+}
+
+// respondDialog đọc lại hội thoại vừa ghi và trả về theo dạng của GET /dialogs/{id}
+func respondDialog(ctx iris.Context, id int64) {
+	dialog, err := getDialogFromDB(id)
+	if err == nil {
+		var data map[string]interface{}
+		if data, err = dialogData(dialog); err == nil {
+			ctx.JSON(APIResponse{Status: "success", Data: data})
+			return
+		}
+	}
+	ctx.StatusCode(iris.StatusInternalServerError)
+	ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog: %v", err)})
+}
+
+// dialogCursorValue trả về giá trị của cột sắp xếp dùng cho cursor
+func dialogCursorValue(sort string, d dialogSummary) string {
+	switch strings.TrimPrefix(sort, "-") {
+	case "createdAt":
+		return cursorTime(d.CreatedAt)
+	case "updatedAt":
+		return cursorTime(d.UpdatedAt)
+	case "topic":
+		return d.Topic
+	}
+	return ""
+}
+
+func getDialogSummariesFromDB(where *sqlWhere, page pageParams) ([]dialogSummary, error) {
+	rows, err := database.DB.Query(`SELECT d.id, d.lang, d.topic, d.setting, d.characters, d.turns, d.level, d.register,
+			COALESCE(d.created_by, 0), d.created_at, d.updated_at,
+			(SELECT COUNT(*) FROM word_dialog wd WHERE wd.dialog_id = d.id)
+		FROM dialog d `+where.String()+" "+page.orderBy("d.id"), where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dialogs := []dialogSummary{}
+	for rows.Next() {
+		var d dialogSummary
+		if err := rows.Scan(&d.ID, &d.Lang, &d.Topic, &d.Setting, pq.Array(&d.Characters), &d.Turns, &d.Level, &d.Register,
+			&d.CreatedBy, &d.CreatedAt, &d.UpdatedAt, &d.WordCount); err != nil {
+			return nil, err
+		}
+		dialogs = append(dialogs, d)
+	}
+	return dialogs, rows.Err()
+}
+
+// updateDialogInDB ghi đè hội thoại. Khi nội dung đổi, lượt nói được tách lại, vị trí từ vựng được
+// tính lại, bản dịch từng câu bị xoá và âm thanh của các câu không còn tồn tại bị xoá
+// (câu còn lại được tổng hợp lại khi gọi POST /dialogs/{id}/audio vì text đã khác).
+func updateDialogInDB(dialog models.Dialog, turns []dialogue.Turn, contentChanged bool) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE dialog SET lang = $2, content = $3, topic = $4, setting = $5, characters = $6, turns = $7,
+		level = $8, register = $9, updated_at = NOW() WHERE id = $1`,
+		dialog.ID, dialog.Lang, dialog.Content, dialog.Topic, dialog.Setting, pq.Array(dialog.Characters), dialog.Turns,
+		dialog.Level, dialog.Register)
+	if err != nil {
+		return err
+	}
+	if !contentChanged {
+		return tx.Commit()
+	}
+
+	steps := []struct {
+		query string
+		args  []interface{}
+	}{
+		{"DELETE FROM dialog_turn WHERE dialog_id = $1", []interface{}{dialog.ID}},
+		{"DELETE FROM dialog_line_translation WHERE dialog_id = $1", []interface{}{dialog.ID}},
+		{"DELETE FROM dialog_audio WHERE dialog_id = $1 AND ordinal > $2", []interface{}{dialog.ID, len(turns)}},
+	}
+	for _, step := range steps {
+		if _, err := tx.Exec(step.query, step.args...); err != nil {
+			return err
+		}
+	}
+	if err := saveDialogTurns(tx, dialog.ID, turns); err != nil {
+		return err
+	}
+	if _, err := refreshWordOccurrences(tx, dialog.ID); err != nil {
+		return fmt.Errorf("locate words in dialog: %w", err)
+	}
+	return tx.Commit()
+}
+
+func removeDialogWordFromDB(dialogID, wordID int64) (bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec("DELETE FROM word_dialog WHERE dialog_id = $1 AND word_id = $2", dialogID, wordID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec("DELETE FROM word_occurrence WHERE dialog_id = $1 AND word_id = $2", dialogID, wordID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"vocabulary/database"
+	"vocabulary/exercise"
+	"vocabulary/langtag"
+	"vocabulary/models"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+const (
+	maxExerciseCount = 50  // số câu tối đa cho mỗi loại choice và cloze
+	distractorPool   = 100 // số từ khác được lấy làm nguồn phương án nhiễu
+	maxExerciseSeed  = 1 << 53
+)
+
+// ExerciseRequest là body của POST /dialogs/{id}/exercises; mọi trường đều không bắt buộc
+type ExerciseRequest struct {
+	Seed  *int64   `json:"seed"`  // cùng seed và cùng dữ liệu cho cùng bộ bài tập; bỏ trống để sinh ngẫu nhiên
+	Types []string `json:"types"` // choice, cloze, matching; mặc định tất cả
+	Count int      `json:"count"` // số câu tối đa cho mỗi loại choice và cloze, 0 hoặc bỏ trống là mặc định 10
+	Lang  string   `json:"lang"`  // ngôn ngữ của bản dịch, mặc định en
+}
+
+// exerciseSet là một bộ bài tập đã lưu
+type exerciseSet struct {
+	ID        int64           `json:"id"`
+	DialogID  int64           `json:"dialogID"`
+	Seed      int64           `json:"seed"`
+	Lang      string          `json:"lang"`
+	Types     []string        `json:"types"`
+	Items     []exercise.Item `json:"items"`
+	CreatedAt time.Time       `json:"createdAt"`
+}
+
+// public trả về bộ bài tập không kèm đáp án
+func (set exerciseSet) public() exerciseSet {
+	items := make([]exercise.Item, len(set.Items))
+	for i, item := range set.Items {
+		items[i] = item.Public()
+	}
+	set.Items = items
+	return set
+}
+
+// CreateExercisesHandler sinh bài tập trắc nghiệm bản dịch, điền từ (cloze) và nối từ cho một hội thoại
+// từ các từ vựng đã lưu của nó. Bộ bài tập được lưu lại (không kèm đáp án trong phản hồi) để cả lớp
+// dùng chung qua GET /exercises/{id}; gửi lại cùng seed cũng cho cùng bộ câu hỏi.
+func CreateExercisesHandler(ctx iris.Context) {
+	var request ExerciseRequest
+	if ctx.GetContentLength() > 0 {
+		if err := ctx.ReadJSON(&request); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+			return
+		}
+	}
+
+	opts := exercise.Options{Count: request.Count}
+	if request.Count < 0 || request.Count > maxExerciseCount {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("'count' must be between 1 and %d, or 0 for the default of %d", maxExerciseCount, exercise.DefaultCount)})
+		return
+	}
+	seen := make(map[exercise.Kind]bool)
+	for _, t := range request.Types {
+		kind, err := exercise.ParseKind(t)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid 'types': %v", err)})
+			return
+		}
+		if !seen[kind] {
+			seen[kind] = true
+			opts.Kinds = append(opts.Kinds, kind)
+		}
+	}
+	if len(opts.Kinds) == 0 {
+		opts.Kinds = exercise.Kinds
+	}
+	if request.Seed != nil {
+		opts.Seed = *request.Seed
+	} else {
+		// Giữ seed trong phạm vi số nguyên chính xác của JavaScript
+		opts.Seed = rand.Int63n(maxExerciseSeed)
+	}
+	lang, err := langtag.NormalizeDefault(request.Lang, langtag.DefaultTarget)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+		return
+	}
+
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	input, err := exerciseInput(dialog, lang, opts.Seed)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog words: %v", err)})
+		return
+	}
+	items := exercise.Generate(input, opts)
+	if len(items) == 0 {
+		ctx.StatusCode(iris.StatusUnprocessableEntity)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Dialog %d has no saved words with a %q translation to build exercises from", dialog.ID, lang)})
+		return
+	}
+
+	set := exerciseSet{DialogID: dialog.ID, Seed: opts.Seed, Lang: lang, Items: items}
+	for _, kind := range opts.Kinds {
+		set.Types = append(set.Types, string(kind))
+	}
+	if err := saveExerciseSetToDB(&set, currentUserID(ctx)); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save exercises: %v", err)})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(APIResponse{Status: "success", Data: set.public()})
+}
+
+// GetExercisesHandler trả về một bộ bài tập đã lưu, không kèm đáp án
+func GetExercisesHandler(ctx iris.Context) {
+	set, ok := loadExerciseSet(ctx)
+	if !ok {
+		return
+	}
+	ctx.JSON(APIResponse{Status: "success", Data: set.public()})
+}
+
+// GradeExercisesHandler chấm bài từ {"answers": [{"item", "answer"} | {"item", "pairs"}]} và trả về
+// điểm từng câu kèm đáp án đúng. Kết quả không được lưu lại.
+func GradeExercisesHandler(ctx iris.Context) {
+	var request struct {
+		Answers []exercise.Response `json:"answers"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+
+	set, ok := loadExerciseSet(ctx)
+	if !ok {
+		return
+	}
+
+	result, err := exercise.Grade(set.Items, request.Answers)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid answers: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: result})
+}
+
+// loadExerciseSet đọc bộ bài tập theo tham số {id}, tự trả 400/404/500 nếu lỗi
+func loadExerciseSet(ctx iris.Context) (exerciseSet, bool) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid exercise set id"})
+		return exerciseSet{}, false
+	}
+
+	set, err := getExerciseSetFromDB(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Exercise set %d not found", id)})
+		return exerciseSet{}, false
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load exercise set: %v", err)})
+		return exerciseSet{}, false
+	}
+	return set, true
+}
+
+// exerciseInput gom các lượt nói, vị trí từ vựng, bản dịch sang lang và phương án nhiễu của hội thoại
+func exerciseInput(dialog models.Dialog, lang string, seed int64) (exercise.Input, error) {
+	var input exercise.Input
+
+	parsed, err := parseDialog(dialog)
+	if err != nil {
+		return input, err
+	}
+	words, err := getDialogWordsFromDB(dialog.ID)
+	if err != nil {
+		return input, err
+	}
+	occurrences, err := getWordOccurrencesFromDB(dialog.ID)
+	if err == nil && len(occurrences) == 0 && len(words) > 0 {
+		occurrences, err = backfillWordOccurrences(dialog.ID)
+	}
+	if err != nil {
+		return input, err
+	}
+
+	ids := make([]int64, len(words))
+	for i, w := range words {
+		ids[i] = w.ID
+		input.Words = append(input.Words, exercise.Word{ID: w.ID, Content: w.Content, Translation: w.Translations[lang]})
+	}
+	spans := make(map[int][]exercise.Span)
+	for _, o := range occurrences {
+		spans[o.Ordinal] = append(spans[o.Ordinal], exercise.Span{WordID: o.WordID, Start: o.Start, End: o.End, Surface: o.Surface})
+	}
+	for _, turn := range dialogTurnModels(dialog.ID, parsed.Turns) {
+		input.Lines = append(input.Lines, exercise.Line{Ordinal: turn.Ordinal, Speaker: turn.Speaker, Text: turn.Text, Spans: spans[turn.Ordinal]})
+	}
+
+	input.Distractors, err = getDistractorsFromDB(dialog.Lang, lang, ids, seed)
+	return input, err
+}
+
+// getDistractorsFromDB lấy bản dịch (nghĩa đầu tiên) của các từ cùng ngôn ngữ không thuộc hội thoại.
+// Các từ được chọn theo thứ tự băm với seed nên cùng seed cho cùng nguồn phương án nhiễu.
+func getDistractorsFromDB(wordLang, lang string, exclude []int64, seed int64) ([]exercise.Word, error) {
+	rows, err := database.DB.Query(`SELECT id, content, text FROM (
+			SELECT DISTINCT ON (w.id) w.id, w.content, t.text FROM word w JOIN word_translation t ON t.word_id = w.id
+			WHERE w.lang = $1 AND t.lang = $2 AND t.text <> '' AND NOT (w.id = ANY($3))
+			ORDER BY w.id, t.sense_id
+		) p ORDER BY md5($4::text || ':' || id::text) LIMIT $5`,
+		wordLang, lang, pq.Array(exclude), seed, distractorPool)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var words []exercise.Word
+	for rows.Next() {
+		var w exercise.Word
+		if err := rows.Scan(&w.ID, &w.Content, &w.Translation); err != nil {
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	return words, rows.Err()
+}
+
+func saveExerciseSetToDB(set *exerciseSet, userID int64) error {
+	items, err := json.Marshal(set.Items)
+	if err != nil {
+		return err
+	}
+	return database.DB.QueryRow(`INSERT INTO exercise_set (dialog_id, seed, lang, kinds, items, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6::bigint, 0)) RETURNING id, created_at`,
+		set.DialogID, set.Seed, set.Lang, pq.Array(set.Types), items, userID).Scan(&set.ID, &set.CreatedAt)
+}
+
+func getExerciseSetFromDB(id int64) (exerciseSet, error) {
+	set := exerciseSet{ID: id}
+	var items []byte
+	err := database.DB.QueryRow(`SELECT dialog_id, seed, lang, kinds, items, created_at FROM exercise_set WHERE id = $1`, id).
+		Scan(&set.DialogID, &set.Seed, &set.Lang, pq.Array(&set.Types), &items, &set.CreatedAt)
+	if err != nil {
+		return set, err
+	}
+	if err := json.Unmarshal(items, &set.Items); err != nil {
+		return set, fmt.Errorf("decode exercise items: %w", err)
+	}
+	return set, nil
+}
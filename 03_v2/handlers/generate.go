@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"vocabulary/langtag"
+	"vocabulary/models"
+
+	"github.com/kataras/iris/v12"
+)
+
+// Giới hạn và giá trị mặc định của tham số sinh hội thoại
+const (
+	minDialogTurns      = 2
+	maxDialogTurns      = 30
+	minDialogCharacters = 2
+	maxDialogCharacters = 4
+	maxDialogTopicLen   = 200
+
+	defaultDialogTopic    = "hỏi đường đi đến hồ Hoàn Kiếm"
+	defaultDialogSetting  = "Hà Nội"
+	defaultDialogTurns    = 6
+	defaultDialogLevel    = "A2"
+	defaultDialogRegister = "neutral"
+)
+
+var defaultDialogCharacters = []string{"James", "Lan"}
+
+// dialogLevels mô tả độ khó của hội thoại theo khung CEFR
+var dialogLevels = map[string]string{
+	"A1": "người mới bắt đầu: câu rất ngắn, từ vựng cơ bản nhất, thì hiện tại",
+	"A2": "sơ cấp: câu ngắn, đơn giản, từ vựng thông dụng hằng ngày",
+	"B1": "trung cấp: câu ghép đơn giản, có thể diễn đạt ý kiến và lý do",
+	"B2": "trung cao cấp: câu dài hơn, từ vựng phong phú, diễn đạt tự nhiên",
+	"C1": "cao cấp: câu phức, thành ngữ thông dụng, diễn đạt linh hoạt",
+	"C2": "thành thạo: ngôn ngữ như người bản xứ, sắc thái tinh tế",
+}
+
+// dialogRegisters mô tả phong cách ngôn ngữ của hội thoại
+var dialogRegisters = map[string]string{
+	"formal":   "trang trọng, lịch sự, dùng kính ngữ",
+	"neutral":  "tự nhiên, thân thiện",
+	"informal": "thân mật, dùng khẩu ngữ hằng ngày",
+}
+
+// DialogRequest là các tham số sinh hội thoại, nhận từ query (GET) hoặc JSON body (POST)
+type DialogRequest struct {
+	Lang       string   `json:"lang"`
+	Topic      string   `json:"topic"`
+	Setting    string   `json:"setting"`
+	Characters []string `json:"characters"`
+	Turns      int      `json:"turns"`
+	Level      string   `json:"level"`
+	Register   string   `json:"register"`
+}
+
+// readDialogRequest đọc tham số sinh hội thoại, điền giá trị mặc định và kiểm tra,
+// tự trả lỗi nếu không hợp lệ. Không có tham số nào sẽ cho ra kịch bản mặc định.
+func readDialogRequest(ctx iris.Context) (DialogRequest, bool) {
+	var request DialogRequest
+	if ctx.Method() == iris.MethodPost {
+		if err := ctx.ReadJSON(&request); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+			return request, false
+		}
+	} else {
+		request.Lang = ctx.URLParam("lang")
+		request.Topic = ctx.URLParam("topic")
+		request.Setting = ctx.URLParam("setting")
+		for _, value := range ctx.URLParamSlice("characters") {
+			request.Characters = append(request.Characters, strings.Split(value, ",")...)
+		}
+		turns, err := ctx.URLParamInt("turns")
+		if err != nil && ctx.URLParamExists("turns") {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid 'turns' %q", ctx.URLParam("turns"))})
+			return request, false
+		}
+		if err == nil {
+			request.Turns = turns
+		}
+		request.Level = ctx.URLParam("level")
+		request.Register = ctx.URLParam("register")
+	}
+
+	if err := request.normalize(); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid dialog parameters: %v", err)})
+		return request, false
+	}
+	return request, true
+}
+
+// normalize điền giá trị mặc định và kiểm tra các tham số
+func (r *DialogRequest) normalize() error {
+	lang, err := langtag.NormalizeDefault(r.Lang, langtag.DefaultSource)
+	if err != nil {
+		return err
+	}
+	r.Lang = lang
+	r.Topic = strings.TrimSpace(r.Topic)
+	r.Setting = strings.TrimSpace(r.Setting)
+	r.Level = strings.ToUpper(strings.TrimSpace(r.Level))
+	r.Register = strings.ToLower(strings.TrimSpace(r.Register))
+
+	if r.Topic == "" {
+		r.Topic = defaultDialogTopic
+		if r.Setting == "" {
+			r.Setting = defaultDialogSetting
+		}
+	}
+	if r.Turns == 0 {
+		r.Turns = defaultDialogTurns
+	}
+	if r.Level == "" {
+		r.Level = defaultDialogLevel
+	}
+	if r.Register == "" {
+		r.Register = defaultDialogRegister
+	}
+
+	var characters []string
+	seen := make(map[string]bool)
+	for _, name := range r.Characters {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if seen[strings.ToLower(name)] {
+			return fmt.Errorf("character %q is listed more than once", name)
+		}
+		seen[strings.ToLower(name)] = true
+		characters = append(characters, name)
+	}
+	if len(characters) == 0 {
+		characters = append(characters, defaultDialogCharacters...)
+	}
+	r.Characters = characters
+
+	switch {
+	case utf8.RuneCountInString(r.Topic) > maxDialogTopicLen:
+		return fmt.Errorf("'topic' must be at most %d characters", maxDialogTopicLen)
+	case utf8.RuneCountInString(r.Setting) > maxDialogTopicLen:
+		return fmt.Errorf("'setting' must be at most %d characters", maxDialogTopicLen)
+	case len(r.Characters) < minDialogCharacters || len(r.Characters) > maxDialogCharacters:
+		return fmt.Errorf("'characters' must list between %d and %d names", minDialogCharacters, maxDialogCharacters)
+	case r.Turns < minDialogTurns || r.Turns > maxDialogTurns:
+		return fmt.Errorf("'turns' must be between %d and %d", minDialogTurns, maxDialogTurns)
+	case dialogLevels[r.Level] == "":
+		return fmt.Errorf("unsupported level %q, expected A1, A2, B1, B2, C1 or C2", r.Level)
+	case dialogRegisters[r.Register] == "":
+		return fmt.Errorf("unsupported register %q, expected formal, neutral or informal", r.Register)
+	}
+	for _, name := range r.Characters {
+		if utf8.RuneCountInString(name) > 50 || strings.ContainsAny(name, ":\n") {
+			return fmt.Errorf("invalid character name %q", name)
+		}
+	}
+	return nil
+}
+
+// dialog trả về bản ghi hội thoại mang theo các tham số đã dùng để sinh
+func (r DialogRequest) dialog(content, raw string) models.Dialog {
+	return models.Dialog{
+		Lang:       r.Lang,
+		Content:    content,
+		Raw:        raw,
+		Topic:      r.Topic,
+		Setting:    r.Setting,
+		Characters: r.Characters,
+		Turns:      r.Turns,
+		Level:      r.Level,
+		Register:   r.Register,
+	}
+}
+
+// buildDialogPrompt tạo prompt sinh hội thoại; profiles là hồ sơ của những nhân vật đã có trong danh mục
+func buildDialogPrompt(r DialogRequest, profiles []models.Character) string {
+	byName := make(map[string]models.Character)
+	for _, c := range profiles {
+		byName[strings.ToLower(c.Name)] = c
+	}
+	characters := make([]models.Character, len(r.Characters))
+	for i, name := range r.Characters {
+		if c, ok := byName[strings.ToLower(name)]; ok {
+			characters[i] = c
+		} else {
+			characters[i] = models.Character{Name: name}
+		}
+	}
+
+	scenario := r.Topic
+	if r.Setting != "" {
+		scenario += " ở " + r.Setting
+	}
+	return fmt.Sprintf(`Tạo một hội thoại bằng %s, gồm %d câu, chủ đề: %s.
+Các nhân vật tham gia:
+%s
+Trình độ người học: %s (%s).
+Phong cách: %s.
+Mỗi câu bắt đầu bằng tên người nói và dấu hai chấm. Chỉ xuất ra hội thoại không cần giải thích.`,
+		langtag.Name(r.Lang), r.Turns, scenario, describeCharacters(characters), r.Level, dialogLevels[r.Level], dialogRegisters[r.Register])
+}
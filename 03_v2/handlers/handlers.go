@@ -2,18 +2,24 @@ package handlers
 
 import (
 	"bytes"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
+	"sort"
 	"strings"
 
 	"vocabulary/config"
 	"vocabulary/database"
+	"vocabulary/dialogue"
+	"vocabulary/langtag"
 	"vocabulary/models"
+	"vocabulary/textnorm"
 
 	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
 )
 
 // GroqRequest struct for the API call
@@ -53,7 +59,9 @@ func IndexHandler(ctx iris.Context) {
 	})
 }
 
-// GenerateDialogHandler generates a Vietnamese dialog
+// GenerateDialogHandler generates a Vietnamese dialog.
+// Topic, setting, characters, turns, level and register come from query params (GET)
+// or a JSON body (POST); without them the default scenario is generated.
 func GenerateDialogHandler(ctx iris.Context) {
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -62,40 +70,32 @@ func GenerateDialogHandler(ctx iris.Context) {
 		return
 	}
 
-	dialogPrompt := `Tạo một hội thoại bằng tiếng Việt, gồm 6 câu, ngắn gọn, đơn giản, hỏi đường đi đến hồ Hoàn Kiếm ở Hà Nội giữa một người Mỹ tên James và người Việt Nam tên Lan. Chỉ xuất ra hội thoại không cần giải thích.`
-	dialogRaw, err := callGroqAPI(cfg.GroqAPIKey, dialogPrompt, nil)
-	if err != nil {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to generate dialog: %v", err)})
-		return
-	}
-
-	dialog := extractDialog(dialogRaw)
-	if dialog == "" {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("No valid dialog found in response: %s", dialogRaw)})
+	request, ok := readDialogRequest(ctx)
+	if !ok {
 		return
 	}
 
-	// Save to database
-	dialogModel := models.Dialog{Lang: "vi", Content: dialog}
-	dialogID, err := saveDialogToDB(dialogModel)
+	dialog, parsed, err := generateDialog(cfg.GroqAPIKey, currentUserID(ctx), request)
 	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save dialog to DB: %v", err)})
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to generate dialog: %v", err)})
 		return
 	}
 
 	ctx.JSON(APIResponse{
 		Status: "success",
 		Data: map[string]interface{}{
-			"dialog":   dialog,
-			"dialogID": dialogID,
+			"dialog":         dialog.Content,
+			"dialogID":       dialog.ID,
+			"params":         request,
+			"turns":          dialogTurnModels(dialog.ID, parsed.Turns),
+			"unmatchedLines": parsed.Unmatched,
 		},
 	})
 }
 
-// ExtractWordsHandler extracts important words from a dialog
+// ExtractWordsHandler extracts important words from a dialog written in 'lang' (default vi).
+// Extracted words that do not occur in the dialog are flagged with inDialog=false and listed in 'notInDialog'.
 func ExtractWordsHandler(ctx iris.Context) {
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -110,34 +110,43 @@ func ExtractWordsHandler(ctx iris.Context) {
 		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'dialog' parameter"})
 		return
 	}
+	lang, err := langtag.NormalizeDefault(ctx.URLParam("lang"), langtag.DefaultSource)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+		return
+	}
 
-	wordsPrompt := fmt.Sprintf(`Từ hội thoại sau, hãy lọc ra danh sách các từ và cụm từ quan trọng, bỏ qua danh từ tên riêng (như James, Lan, Hà Nội, Hoàn Kiếm). Trả về kết quả dưới dạng JSON với cấu trúc {"words": ["word1", "word2", ...]}.
-%s`, dialog)
-	wordsRaw, err := callGroqAPI(cfg.GroqAPIKey, wordsPrompt, map[string]string{"type": "json_object"})
+	details, err := extractWords(cfg.GroqAPIKey, dialog, lang)
 	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
 		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to extract words: %v", err)})
 		return
 	}
 
-	var wordsData struct {
-		Words []string `json:"words"`
-	}
-	if err := json.Unmarshal([]byte(wordsRaw), &wordsData); err != nil {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to unmarshal words JSON: %v (raw data: %s)", err, wordsRaw)})
-		return
+	notInDialog := []string{}
+	for _, d := range details {
+		if !d.InDialog {
+			notInDialog = append(notInDialog, d.Word)
+		}
 	}
 
 	ctx.JSON(APIResponse{
 		Status: "success",
 		Data: map[string]interface{}{
-			"extractedWords": wordsData.Words,
+			"extractedWords": wordList(details),
+			"details":        details,
+			"notInDialog":    notInDialog,
+			"lang":           lang,
 		},
 	})
 }
 
-// TranslateWordsHandler translates words from Vietnamese to English
+// TranslateWordsHandler translates words from the source language (default vi) to one or more
+// target languages (default en). Each translated word is an object keyed by language tag,
+// e.g. {"vi": "hồ", "en": "lake", "fr": "lac"}. 'details' (the extraction output) may be sent instead
+// of 'words'; each translated word then also carries "pos", "example", "pronunciation" and
+// "difficulty" when known, plus a short explanation per target under "gloss:<tag>".
 func TranslateWordsHandler(ctx iris.Context) {
 	cfg, err := config.LoadConfig()
 	if err != nil {
@@ -147,7 +156,11 @@ func TranslateWordsHandler(ctx iris.Context) {
 	}
 
 	var request struct {
-		Words []string `json:"words"`
+		Words   []string      `json:"words"`
+		Details []wordDetails `json:"details"`
+		Source  string        `json:"source"`
+		Target  string        `json:"target"`
+		Targets []string      `json:"targets"`
 	}
 	if err := ctx.ReadJSON(&request); err != nil {
 		ctx.StatusCode(iris.StatusBadRequest)
@@ -155,47 +168,50 @@ func TranslateWordsHandler(ctx iris.Context) {
 		return
 	}
 
-	if len(request.Words) == 0 {
+	if len(request.Details) == 0 {
+		request.Details = detailsFromWords(request.Words)
+	}
+	if len(request.Details) == 0 {
 		ctx.StatusCode(iris.StatusBadRequest)
 		ctx.JSON(APIResponse{Status: "error", Error: "No words provided for translation"})
 		return
 	}
 
-	var wordsToTranslate []string
-	for _, word := range request.Words {
-		wordsToTranslate = append(wordsToTranslate, fmt.Sprintf(`{"vi": "%s"}`, word))
-	}
-
-	translatePrompt := fmt.Sprintf(`Dịch từng từ hoặc cụm từ trong danh sách dưới sang tiếng Anh, trả về JSON với cấu trúc {"translated_words": [{"vi": "word", "en": "translation"}, ...]}.
-[%s]`, strings.Join(wordsToTranslate, ","))
-	translatedRaw, err := callGroqAPI(cfg.GroqAPIKey, translatePrompt, map[string]string{"type": "json_object"})
+	source, targets, err := translationLangs(request.Source, append([]string{request.Target}, request.Targets...))
 	if err != nil {
-		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to translate words: %v", err)})
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
 		return
 	}
 
-	var translatedData struct {
-		TranslatedWords []map[string]string `json:"translated_words"`
-	}
-	if err := json.Unmarshal([]byte(translatedRaw), &translatedData); err != nil {
+	translated, err := translateWords(cfg.GroqAPIKey, request.Details, source, targets)
+	if err != nil {
 		ctx.StatusCode(iris.StatusInternalServerError)
-		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to unmarshal translated JSON: %v (raw data: %s)", err, translatedRaw)})
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to translate words: %v", err)})
 		return
 	}
 
 	ctx.JSON(APIResponse{
 		Status: "success",
 		Data: map[string]interface{}{
-			"translatedWords": translatedData.TranslatedWords,
+			"translatedWords": translated,
+			"source":          source,
+			"targets":         targets,
 		},
 	})
 }
 
 // SaveWordsHandler saves words and their translations to the database with dialog relation
+// and adds them to the signed-in user's vocabulary.
+// Each translated word is keyed by language tag; the 'source' key (default vi) is the word itself
+// and every other key is stored as a translation in word_translation.
+// 'mode' is atomic (default: all words or none, 422 on failure) or best_effort (failed words
+// are skipped, 207 with status "partial"). 'results' reports created, reused or failed per word.
 func SaveWordsHandler(ctx iris.Context) {
 	var request struct {
 		DialogID        int64               `json:"dialogID"`
+		Source          string              `json:"source"`
+		Mode            string              `json:"mode"`
 		TranslatedWords []map[string]string `json:"translatedWords"`
 	}
 	if err := ctx.ReadJSON(&request); err != nil {
@@ -210,43 +226,70 @@ func SaveWordsHandler(ctx iris.Context) {
 		return
 	}
 
-	if len(request.TranslatedWords) == 0 {
+	respondSaveWords(ctx, request.DialogID, request.Source, request.Mode, request.TranslatedWords)
+}
+
+// respondSaveWords kiểm tra, lưu các từ đã dịch cho hội thoại dialogID và trả về báo cáo lưu;
+// dùng chung cho POST /save-words và POST /dialogs/{id}/words
+func respondSaveWords(ctx iris.Context, dialogID int64, sourceLang, modeName string, translatedWords []map[string]string) {
+	if len(translatedWords) == 0 {
 		ctx.StatusCode(iris.StatusBadRequest)
 		ctx.JSON(APIResponse{Status: "error", Error: "No translated words provided"})
 		return
 	}
 
-	var savedWords []map[string]interface{}
-	for _, translatedWord := range request.TranslatedWords {
-		viWord := translatedWord["vi"]
-		enWord := translatedWord["en"]
+	source, err := langtag.NormalizeDefault(sourceLang, langtag.DefaultSource)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+		return
+	}
 
-		wordModel := models.Word{Lang: "vi", Content: viWord, Translate: enWord}
-		wordID, err := saveWordToDB(wordModel)
-		if err != nil {
-			log.Printf("Failed to save word '%s' to DB: %v", viWord, err)
-			continue
-		}
+	mode, err := saveWordsMode(modeName)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid 'mode': " + err.Error()})
+		return
+	}
 
-		if err := createWordDialogRelation(request.DialogID, wordID); err != nil {
-			log.Printf("Failed to create relation between dialog %d and word %d: %v", request.DialogID, wordID, err)
-			continue
-		}
+	if _, err := getDialogFromDB(dialogID); errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Dialog %d not found", dialogID)})
+		return
+	} else if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog: %v", err)})
+		return
+	}
 
-		savedWords = append(savedWords, map[string]interface{}{
-			"vi":     viWord,
-			"en":     enWord,
-			"wordID": wordID,
-		})
+	report, err := saveWords(currentUserID(ctx), dialogID, source, mode, translatedWords)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save words: %v", err)})
+		return
 	}
 
-	ctx.JSON(APIResponse{
-		Status: "success",
-		Data: map[string]interface{}{
-			"savedWords": savedWords,
-			"dialogID":   request.DialogID,
-		},
-	})
+	data := map[string]interface{}{
+		"dialogID":    dialogID,
+		"mode":        report.Mode,
+		"savedWords":  report.SavedWords,
+		"results":     report.Results,
+		"created":     report.Created,
+		"reused":      report.Reused,
+		"failed":      report.Failed,
+		"notInDialog": report.NotInDialog,
+	}
+	switch {
+	case report.Failed == 0:
+		ctx.JSON(APIResponse{Status: "success", Data: data})
+	case mode == saveAtomic:
+		// Không từ nào được lưu
+		ctx.StatusCode(iris.StatusUnprocessableEntity)
+		ctx.JSON(APIResponse{Status: "error", Data: data, Error: "No words were saved because at least one word failed"})
+	default:
+		ctx.StatusCode(iris.StatusMultiStatus)
+		ctx.JSON(APIResponse{Status: "partial", Data: data, Error: fmt.Sprintf("%d of %d words failed", report.Failed, len(report.Results))})
+	}
 }
 
 // Helper functions remain unchanged
@@ -300,23 +343,106 @@ func extractDialog(raw string) string {
 	return strings.TrimSpace(raw)
 }
 
-func saveDialogToDB(dialog models.Dialog) (int64, error) {
-	var id int64
-	err := database.DB.QueryRow("INSERT INTO dialog (lang, content) VALUES ($1, $2) RETURNING id", dialog.Lang, dialog.Content).Scan(&id)
-	return id, err
+// generateDialog sinh hội thoại theo tham số, lưu hội thoại cùng các lượt nói và trả về bản ghi đã lưu.
+// userID là người tạo, 0 nếu không rõ.
+func generateDialog(apiKey string, userID int64, request DialogRequest) (models.Dialog, dialogue.Result, error) {
+	dialog, parsed, err := composeDialog(apiKey, userID, request)
+	if err != nil {
+		return models.Dialog{}, dialogue.Result{}, err
+	}
+	dialog.ID, err = saveDialogToDB(dialog, parsed.Turns)
+	if err != nil {
+		return models.Dialog{}, dialogue.Result{}, fmt.Errorf("failed to save dialog to DB: %w", err)
+	}
+	return dialog, parsed, nil
 }
 
-func saveWordToDB(word models.Word) (int64, error) {
-	var id int64
-	err := database.DB.QueryRow("SELECT id FROM word WHERE content = $1 AND lang = $2", word.Content, word.Lang).Scan(&id)
-	if err == nil {
-		return id, nil
+// composeDialog gọi Groq sinh hội thoại và tách lượt nói nhưng chưa lưu vào DB
+func composeDialog(apiKey string, userID int64, request DialogRequest) (models.Dialog, dialogue.Result, error) {
+	characters, err := getCharactersByNameFromDB(request.Characters)
+	if err != nil {
+		return models.Dialog{}, dialogue.Result{}, fmt.Errorf("failed to load characters: %w", err)
+	}
+
+	dialogRaw, err := callGroqAPI(apiKey, buildDialogPrompt(request, characters), nil)
+	if err != nil {
+		return models.Dialog{}, dialogue.Result{}, err
+	}
+
+	content := extractDialog(dialogRaw)
+	if content == "" {
+		return models.Dialog{}, dialogue.Result{}, fmt.Errorf("no valid dialog found in response: %s", dialogRaw)
 	}
-	err = database.DB.QueryRow("INSERT INTO word (lang, content, translate) VALUES ($1, $2, $3) RETURNING id", word.Lang, word.Content, word.Translate).Scan(&id)
-	return id, err
+
+	dialog := request.dialog(content, dialogRaw)
+	dialog.CreatedBy = userID
+	return dialog, dialogue.Parse(content), nil
 }
 
-func createWordDialogRelation(dialogID, wordID int64) error {
-	_, err := database.DB.Exec("INSERT INTO word_dialog (dialog_id, word_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", dialogID, wordID)
-	return err
+// extractWords lọc các từ và cụm từ quan trọng của một hội thoại viết bằng lang, kèm từ loại,
+// câu ví dụ trong hội thoại, cách phát âm và cấp độ nếu mô hình trả về
+func extractWords(apiKey, dialog, lang string) ([]wordDetails, error) {
+	partNames := make([]string, 0, len(partsOfSpeech))
+	for pos := range partsOfSpeech {
+		partNames = append(partNames, pos)
+	}
+	sort.Strings(partNames)
+
+	wordsPrompt := fmt.Sprintf(`Từ hội thoại sau (viết bằng %s), hãy lọc ra danh sách các từ và cụm từ quan trọng, giữ nguyên ngôn ngữ gốc, bỏ qua danh từ tên riêng (như James, Lan, Hà Nội, Hoàn Kiếm). Trả về kết quả dưới dạng JSON với cấu trúc {"words": [{"word": "từ", "pos": "từ loại", "example": "câu trong hội thoại có chứa từ", "pronunciation": "phiên âm IPA", "difficulty": "cấp độ CEFR"}, ...]}.
+"pos" là một trong: %s. "example" chép nguyên văn một câu của hội thoại. "difficulty" là A1, A2, B1, B2, C1 hoặc C2. Bỏ trống trường nào không chắc chắn, trừ "word".
+%s`, langtag.Name(lang), strings.Join(partNames, ", "), dialog)
+	wordsRaw, err := callGroqAPI(apiKey, wordsPrompt, map[string]string{"type": "json_object"})
+	if err != nil {
+		return nil, err
+	}
+
+	var wordsData struct {
+		Words []wordDetails `json:"words"`
+	}
+	if err := json.Unmarshal([]byte(wordsRaw), &wordsData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal words JSON: %v (raw data: %s)", err, wordsRaw)
+	}
+
+	words := []wordDetails{}
+	seen := make(map[string]bool)
+	tokens := textnorm.Locate(dialog)
+	for _, d := range wordsData.Words {
+		d = d.clean(dialog)
+		key := textnorm.Normalize(d.Word)
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		d.InDialog = phraseOccurs(tokens, d.Word)
+		words = append(words, d)
+	}
+	return words, nil
+}
+
+// saveDialogToDB lưu hội thoại cùng các lượt nói đã tách trong một transaction
+func saveDialogToDB(dialog models.Dialog, turns []dialogue.Turn) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	id, err := saveDialogInTx(tx, dialog, turns)
+	if err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
+// saveDialogInTx thêm hội thoại và các lượt nói trong tx
+func saveDialogInTx(tx *sql.Tx, dialog models.Dialog, turns []dialogue.Turn) (int64, error) {
+	var id int64
+	err := tx.QueryRow(`INSERT INTO dialog (lang, content, raw, topic, setting, characters, turns, level, register, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10::bigint, 0)) RETURNING id`,
+		dialog.Lang, dialog.Content, dialog.Raw, dialog.Topic, dialog.Setting, pq.Array(dialog.Characters), dialog.Turns, dialog.Level, dialog.Register,
+		dialog.CreatedBy).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	return id, saveDialogTurns(tx, id, turns)
 }
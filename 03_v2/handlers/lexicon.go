@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+
+	"vocabulary/database"
+	"vocabulary/models"
+	"vocabulary/pls"
+	"vocabulary/ssml"
+	"vocabulary/textnorm"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// LexiconHandler sinh file PLS từ bảng word (các từ có phiên âm) và bảng lexicon_override.
+// Mục nhập tay được ưu tiên hơn phiên âm trong bảng word khi trùng cách viết.
+func LexiconHandler(ctx iris.Context) {
+	lang := lexiconLang(ctx.URLParamDefault("lang", "vi"))
+
+	lexemes, err := getLexiconEntriesFromDB(lang)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load lexicon: %v", err)})
+		return
+	}
+
+	xmlLang, err := ssml.NormalizeLang(lang)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := (pls.Lexicon{Lang: xmlLang, Alphabet: "ipa", Lexemes: lexemes}).Write(&buf); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to write lexicon: %v", err)})
+		return
+	}
+
+	ctx.ContentType(pls.ContentType)
+	ctx.Write(buf.Bytes())
+}
+
+// ListLexiconOverridesHandler liệt kê các cách phát âm nhập tay, lọc theo lang nếu có
+func ListLexiconOverridesHandler(ctx iris.Context) {
+	overrides, err := getLexiconOverridesFromDB(lexiconLang(ctx.URLParam("lang")))
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load lexicon overrides: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"overrides": overrides,
+		},
+	})
+}
+
+// CreateLexiconOverrideHandler thêm một cách phát âm nhập tay
+func CreateLexiconOverrideHandler(ctx iris.Context) {
+	override, ok := readLexiconOverride(ctx)
+	if !ok {
+		return
+	}
+
+	err := database.DB.QueryRow("INSERT INTO lexicon_override (lang, grapheme, alias, phoneme) VALUES ($1, $2, $3, $4) RETURNING id",
+		override.Lang, override.Grapheme, override.Alias, override.Phoneme).Scan(&override.ID)
+	if isUniqueViolation(err) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("An override for %q already exists", override.Grapheme)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save lexicon override: %v", err)})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	ctx.JSON(APIResponse{Status: "success", Data: override})
+}
+
+// UpdateLexiconOverrideHandler sửa một cách phát âm nhập tay
+func UpdateLexiconOverrideHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid override id"})
+		return
+	}
+
+	override, ok := readLexiconOverride(ctx)
+	if !ok {
+		return
+	}
+	override.ID = id
+
+	res, err := database.DB.Exec("UPDATE lexicon_override SET lang = $2, grapheme = $3, alias = $4, phoneme = $5 WHERE id = $1",
+		override.ID, override.Lang, override.Grapheme, override.Alias, override.Phoneme)
+	if isUniqueViolation(err) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("An override for %q already exists", override.Grapheme)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to update lexicon override: %v", err)})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Lexicon override %d not found", id)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: override})
+}
+
+// DeleteLexiconOverrideHandler xoá một cách phát âm nhập tay
+func DeleteLexiconOverrideHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid override id"})
+		return
+	}
+
+	res, err := database.DB.Exec("DELETE FROM lexicon_override WHERE id = $1", id)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to delete lexicon override: %v", err)})
+		return
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Lexicon override %d not found", id)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"id": id}})
+}
+
+// readLexiconOverride đọc và kiểm tra body của yêu cầu tạo/sửa, tự trả lỗi nếu không hợp lệ
+func readLexiconOverride(ctx iris.Context) (models.LexiconOverride, bool) {
+	var override models.LexiconOverride
+	if err := ctx.ReadJSON(&override); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return override, false
+	}
+
+	override.Lang = lexiconLang(override.Lang)
+	if override.Lang == "" {
+		override.Lang = "vi"
+	}
+	override.Grapheme = strings.TrimSpace(override.Grapheme)
+	override.Alias = strings.TrimSpace(override.Alias)
+	override.Phoneme = strings.TrimSpace(override.Phoneme)
+
+	switch {
+	case override.Grapheme == "":
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'grapheme'"})
+		return override, false
+	case override.Alias == "" && override.Phoneme == "":
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Either 'alias' or 'phoneme' is required"})
+		return override, false
+	}
+	if override.Phoneme != "" {
+		phoneme, ok := pls.CleanIPA(override.Phoneme)
+		if !ok {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: "Invalid 'phoneme', expected IPA"})
+			return override, false
+		}
+		override.Phoneme = phoneme
+	}
+	return override, true
+}
+
+// lexiconLang lấy phần ngôn ngữ chính của mã ngôn ngữ ("vi-VN" -> "vi") để khớp cột lang
+func lexiconLang(lang string) string {
+	lang = strings.ToLower(strings.TrimSpace(lang))
+	if base, _, ok := strings.Cut(strings.ReplaceAll(lang, "_", "-"), "-"); ok {
+		return base
+	}
+	return lang
+}
+
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
+func getLexiconOverridesFromDB(lang string) ([]models.LexiconOverride, error) {
+	rows, err := database.DB.Query(`SELECT id, lang, grapheme, alias, phoneme FROM lexicon_override
+		WHERE $1::text = '' OR lang = $1::text ORDER BY lang, grapheme`, lang)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overrides := []models.LexiconOverride{}
+	for rows.Next() {
+		var o models.LexiconOverride
+		if err := rows.Scan(&o.ID, &o.Lang, &o.Grapheme, &o.Alias, &o.Phoneme); err != nil {
+			return nil, err
+		}
+		overrides = append(overrides, o)
+	}
+	return overrides, rows.Err()
+}
+
+// getLexiconEntriesFromDB gộp phiên âm từ bảng word với các mục nhập tay
+func getLexiconEntriesFromDB(lang string) ([]pls.Lexeme, error) {
+	overrides, err := getLexiconOverridesFromDB(lang)
+	if err != nil {
+		return nil, err
+	}
+
+	byKey := make(map[string]pls.Lexeme)
+	rows, err := database.DB.Query(`SELECT content, pronunciation FROM word
+		WHERE (lang = $1::text OR lang LIKE $1::text || '-%') AND pronunciation <> ''`, lang)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var content, pronunciation string
+		if err := rows.Scan(&content, &pronunciation); err != nil {
+			return nil, err
+		}
+		// Phiên âm lưu trước khi có kiểm tra IPA có thể không hợp lệ
+		phoneme, ok := pls.CleanIPA(pronunciation)
+		if !ok {
+			continue
+		}
+		key := textnorm.Normalize(content)
+		if _, exists := byKey[key]; !exists {
+			byKey[key] = pls.Lexeme{Graphemes: []string{content}, Phoneme: phoneme}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, o := range overrides {
+		byKey[textnorm.Normalize(o.Grapheme)] = pls.Lexeme{Graphemes: []string{o.Grapheme}, Alias: o.Alias, Phoneme: o.Phoneme}
+	}
+
+	lexemes := make([]pls.Lexeme, 0, len(byKey))
+	for _, lexeme := range byKey {
+		lexemes = append(lexemes, lexeme)
+	}
+	return lexemes, nil
+}
+
+// lexiconURI trả về địa chỉ công khai của lexicon cho một ngôn ngữ, dùng trong thẻ <lexicon>
+func lexiconURI(publicURL, lang string) string {
+	return fmt.Sprintf("%s/lexicon.pls?lang=%s", publicURL, lexiconLang(lang))
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"encoding/json"
+	"strings"
+	"unicode/utf8"
+
+	"vocabulary/pls"
+	"vocabulary/textnorm"
+)
+
+// Các khoá thông tin thêm trong một từ đã dịch, bên cạnh các khoá mã ngôn ngữ.
+// Giải nghĩa theo từng ngôn ngữ đích dùng khoá "gloss:<mã ngôn ngữ>", ví dụ "gloss:en".
+const (
+	metaPartOfSpeech  = "pos"
+	metaExample       = "example"
+	metaPronunciation = "pronunciation"
+	metaDifficulty    = "difficulty"
+	metaGlossPrefix   = "gloss:"
+)
+
+// Độ dài tối đa của thông tin thêm; giá trị dài hơn bị bỏ
+const (
+	maxExampleLen       = 300
+	maxGlossLen         = 200
+	maxPronunciationLen = 100
+)
+
+// partsOfSpeech là các từ loại được chấp nhận
+var partsOfSpeech = map[string]bool{
+	"noun": true, "verb": true, "adjective": true, "adverb": true, "pronoun": true,
+	"preposition": true, "conjunction": true, "interjection": true, "particle": true,
+	"classifier": true, "numeral": true, "determiner": true, "phrase": true,
+}
+
+// wordDetails là một từ lọc từ hội thoại cùng thông tin cho người học; mọi trường trừ Word có thể trống
+type wordDetails struct {
+	Word          string `json:"word"`
+	PartOfSpeech  string `json:"pos,omitempty"`
+	Example       string `json:"example,omitempty"`
+	Pronunciation string `json:"pronunciation,omitempty"`
+	Difficulty    string `json:"difficulty,omitempty"`
+	InDialog      bool   `json:"inDialog"` // từ có xuất hiện trong hội thoại, do server tính
+}
+
+// UnmarshalJSON nhận cả object lẫn chuỗi (chỉ có từ) như định dạng cũ
+func (d *wordDetails) UnmarshalJSON(data []byte) error {
+	var word string
+	if err := json.Unmarshal(data, &word); err == nil {
+		*d = wordDetails{Word: word}
+		return nil
+	}
+	type plain wordDetails
+	return json.Unmarshal(data, (*plain)(d))
+}
+
+// clean chuẩn hoá các trường và bỏ những giá trị không hợp lệ (kể cả phiên âm không phải IPA). Câu ví dụ phải có trong hội thoại;
+// dialog rỗng thì không kiểm tra.
+func (d wordDetails) clean(dialog string) wordDetails {
+	d.Word = strings.TrimSpace(d.Word)
+	d.PartOfSpeech = cleanPartOfSpeech(d.PartOfSpeech)
+	d.Difficulty = cleanDifficulty(d.Difficulty)
+	// Phiên âm được ghi vào lexicon PLS dưới dạng IPA nên giá trị không phải IPA bị bỏ
+	d.Pronunciation, _ = pls.CleanIPA(cleanMeta(d.Pronunciation, maxPronunciationLen))
+	d.Example = cleanMeta(d.Example, maxExampleLen)
+	if d.Example != "" && dialog != "" && !strings.Contains(textnorm.Normalize(dialog), textnorm.Normalize(d.Example)) {
+		d.Example = ""
+	}
+	return d
+}
+
+// metadata trả về các thông tin thêm theo khoá dùng trong từ đã dịch
+func (d wordDetails) metadata() map[string]string {
+	meta := map[string]string{
+		metaPartOfSpeech:  d.PartOfSpeech,
+		metaExample:       d.Example,
+		metaPronunciation: d.Pronunciation,
+		metaDifficulty:    d.Difficulty,
+	}
+	for key, value := range meta {
+		if value == "" {
+			delete(meta, key)
+		}
+	}
+	return meta
+}
+
+func cleanPartOfSpeech(pos string) string {
+	pos = strings.ToLower(strings.TrimSpace(pos))
+	if partsOfSpeech[pos] {
+		return pos
+	}
+	return ""
+}
+
+// cleanDifficulty chấp nhận cấp độ CEFR A1–C2
+func cleanDifficulty(level string) string {
+	level = strings.ToUpper(strings.TrimSpace(level))
+	if dialogLevels[level] != "" {
+		return level
+	}
+	return ""
+}
+
+func cleanMeta(value string, maxLen int) string {
+	value = textnorm.Clean(value)
+	if utf8.RuneCountInString(value) > maxLen {
+		return ""
+	}
+	return value
+}
+
+// isMetaKey cho biết khoá của từ đã dịch là thông tin thêm, không phải mã ngôn ngữ
+func isMetaKey(key string) bool {
+	switch key {
+	case metaPartOfSpeech, metaExample, metaPronunciation, metaDifficulty:
+		return true
+	}
+	return strings.HasPrefix(key, metaGlossPrefix)
+}
+
+// detailsFromWords tạo danh sách từ khi client chỉ gửi chuỗi
+func detailsFromWords(words []string) []wordDetails {
+	details := make([]wordDetails, len(words))
+	for i, word := range words {
+		details[i] = wordDetails{Word: word}
+	}
+	return details
+}
+
+// wordList trả về các từ của danh sách
+func wordList(details []wordDetails) []string {
+	words := make([]string, len(details))
+	for i, d := range details {
+		words[i] = d.Word
+	}
+	return words
+}
+
+// mergeWordDetails gắn thông tin từ bước lọc từ vào các từ đã dịch (khớp theo khoá chuẩn hoá của từ nguồn)
+// và kiểm tra giải nghĩa mô hình trả về; thông tin trong kết quả dịch được ưu tiên nếu hợp lệ
+func mergeWordDetails(translated []map[string]string, details []wordDetails, source string) {
+	byKey := make(map[string]wordDetails)
+	for _, d := range details {
+		byKey[textnorm.Normalize(d.Word)] = d
+	}
+	for _, item := range translated {
+		merged := wordDetails{
+			PartOfSpeech:  item[metaPartOfSpeech],
+			Example:       item[metaExample],
+			Pronunciation: item[metaPronunciation],
+			Difficulty:    item[metaDifficulty],
+		}.clean("")
+		if d, ok := byKey[textnorm.Normalize(item[source])]; ok {
+			if merged.PartOfSpeech == "" {
+				merged.PartOfSpeech = d.PartOfSpeech
+			}
+			if merged.Pronunciation == "" {
+				merged.Pronunciation = d.Pronunciation
+			}
+			if merged.Difficulty == "" {
+				merged.Difficulty = d.Difficulty
+			}
+			// Câu ví dụ chỉ lấy từ bước lọc từ vì chỉ bước đó thấy hội thoại
+			merged.Example = d.Example
+		} else {
+			merged.Example = ""
+		}
+
+		glosses := make(map[string]string)
+		for key, value := range item {
+			if isMetaKey(key) {
+				delete(item, key)
+				if strings.HasPrefix(key, metaGlossPrefix) {
+					glosses[key] = value
+				}
+			}
+		}
+		for key, value := range glosses {
+			if gloss := cleanMeta(value, maxGlossLen); gloss != "" {
+				item[key] = gloss
+			}
+		}
+		for key, value := range merged.metadata() {
+			item[key] = value
+		}
+	}
+}
+
+// glossKey là khoá giải nghĩa bằng ngôn ngữ lang
+func glossKey(lang string) string {
+	return metaGlossPrefix + lang
+}
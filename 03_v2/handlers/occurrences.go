@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+
+	"vocabulary/database"
+	"vocabulary/dialogue"
+	"vocabulary/models"
+	"vocabulary/textnorm"
+
+	"github.com/kataras/iris/v12"
+)
+
+// phraseMatch là một từ vựng khớp các token [start, end) của một câu
+type phraseMatch struct {
+	wordID     int64
+	start, end int
+}
+
+// matchPhrases tìm các từ vựng trong dãy token đã chuẩn hoá. Từ nhiều âm tiết được so khớp theo
+// chuỗi token liên tiếp, cụm dài hơn được ưu tiên và các kết quả không chồng lên nhau.
+func matchPhrases(normalized []string, words []models.Word) []phraseMatch {
+	type candidate struct {
+		id     int64
+		tokens []string
+	}
+	var candidates []candidate
+	for _, word := range words {
+		if parts := textnorm.Tokens(word.Content); len(parts) > 0 {
+			candidates = append(candidates, candidate{id: word.ID, tokens: parts})
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return len(candidates[i].tokens) > len(candidates[j].tokens) })
+
+	taken := make([]bool, len(normalized))
+	var matches []phraseMatch
+	for _, c := range candidates {
+		for start := 0; start+len(c.tokens) <= len(normalized); start++ {
+			match := true
+			for k, part := range c.tokens {
+				if taken[start+k] || normalized[start+k] != part {
+					match = false
+					break
+				}
+			}
+			if match {
+				for k := range c.tokens {
+					taken[start+k] = true
+				}
+				matches = append(matches, phraseMatch{wordID: c.id, start: start, end: start + len(c.tokens)})
+			}
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool { return matches[i].start < matches[j].start })
+	return matches
+}
+
+// locateWordOccurrences tìm vị trí của các từ vựng trong từng lượt nói của hội thoại
+func locateWordOccurrences(dialogID int64, turns []dialogue.Turn, words []models.Word) []models.WordOccurrence {
+	occurrences := []models.WordOccurrence{}
+	for i, turn := range turns {
+		tokens := textnorm.Locate(turn.Text)
+		normalized := make([]string, len(tokens))
+		for k, token := range tokens {
+			normalized[k] = token.Norm
+		}
+		for _, m := range matchPhrases(normalized, words) {
+			first, last := tokens[m.start], tokens[m.end-1]
+			occurrences = append(occurrences, models.WordOccurrence{
+				DialogID: dialogID,
+				Ordinal:  i + 1,
+				WordID:   m.wordID,
+				Start:    first.Start,
+				End:      last.End,
+				Surface:  string([]rune(turn.Text)[first.Start:last.End]),
+			})
+		}
+	}
+	return occurrences
+}
+
+// phraseOccurs cho biết word có xuất hiện trong văn bản đã tách token không
+func phraseOccurs(tokens []textnorm.Token, word string) bool {
+	normalized := make([]string, len(tokens))
+	for i, token := range tokens {
+		normalized[i] = token.Norm
+	}
+	return len(matchPhrases(normalized, []models.Word{{ID: 1, Content: word}})) > 0
+}
+
+// refreshWordOccurrences tính lại vị trí của mọi từ vựng đã gắn với hội thoại và trả về
+// số lần xuất hiện của từng từ. Nội dung, lượt nói và liên kết đều được đọc trong tx
+// để thấy những gì vừa ghi trong cùng transaction.
+func refreshWordOccurrences(tx *sql.Tx, dialogID int64) (map[int64]int, error) {
+	turns, err := dialogTurnsInTx(tx, dialogID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := tx.Query(`SELECT w.id, w.content FROM word_dialog wd JOIN word w ON w.id = wd.word_id WHERE wd.dialog_id = $1`, dialogID)
+	if err != nil {
+		return nil, err
+	}
+	var words []models.Word
+	for rows.Next() {
+		var w models.Word
+		if err := rows.Scan(&w.ID, &w.Content); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		words = append(words, w)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM word_occurrence WHERE dialog_id = $1", dialogID); err != nil {
+		return nil, err
+	}
+	counts := make(map[int64]int)
+	for _, o := range locateWordOccurrences(dialogID, turns, words) {
+		_, err := tx.Exec(`INSERT INTO word_occurrence (dialog_id, ordinal, start_offset, end_offset, word_id, surface)
+			VALUES ($1, $2, $3, $4, $5, $6)`, o.DialogID, o.Ordinal, o.Start, o.End, o.WordID, o.Surface)
+		if err != nil {
+			return nil, err
+		}
+		counts[o.WordID]++
+	}
+	return counts, nil
+}
+
+// DialogAnnotationsHandler trả về các lượt nói của hội thoại kèm vị trí của từ vựng (spans) để client
+// tô sáng trong câu. start/end tính theo ký tự Unicode (code point) trong text của lượt nói, end không tính.
+// missingWords là các từ đã lưu cho hội thoại nhưng không xuất hiện trong đó.
+func DialogAnnotationsHandler(ctx iris.Context) {
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	parsed, err := parseDialog(dialog)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog turns: %v", err)})
+		return
+	}
+	words, err := getDialogWordsFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog words: %v", err)})
+		return
+	}
+	occurrences, err := getWordOccurrencesFromDB(dialog.ID)
+	if err == nil && len(occurrences) == 0 && len(words) > 0 {
+		// Hội thoại lưu từ trước khi có bảng word_occurrence
+		occurrences, err = backfillWordOccurrences(dialog.ID)
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load word occurrences: %v", err)})
+		return
+	}
+
+	spans := make(map[int][]models.WordOccurrence)
+	found := make(map[int64]bool)
+	for _, o := range occurrences {
+		spans[o.Ordinal] = append(spans[o.Ordinal], o)
+		found[o.WordID] = true
+	}
+	turns := make([]map[string]interface{}, len(parsed.Turns))
+	for i, turn := range dialogTurnModels(dialog.ID, parsed.Turns) {
+		turnSpans := spans[turn.Ordinal]
+		if turnSpans == nil {
+			turnSpans = []models.WordOccurrence{}
+		}
+		turns[i] = map[string]interface{}{
+			"ordinal": turn.Ordinal,
+			"speaker": turn.Speaker,
+			"text":    turn.Text,
+			"spans":   turnSpans,
+		}
+	}
+	missing := []models.Word{}
+	for _, word := range words {
+		if !found[word.ID] {
+			missing = append(missing, word)
+		}
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"dialogID":     dialog.ID,
+			"turns":        turns,
+			"words":        words,
+			"missingWords": missing,
+		},
+	})
+}
+
+func backfillWordOccurrences(dialogID int64) ([]models.WordOccurrence, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	if _, err := refreshWordOccurrences(tx, dialogID); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return getWordOccurrencesFromDB(dialogID)
+}
+
+func getWordOccurrencesFromDB(dialogID int64) ([]models.WordOccurrence, error) {
+	rows, err := database.DB.Query(`SELECT ordinal, word_id, start_offset, end_offset, surface FROM word_occurrence
+		WHERE dialog_id = $1 ORDER BY ordinal, start_offset`, dialogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	occurrences := []models.WordOccurrence{}
+	for rows.Next() {
+		o := models.WordOccurrence{DialogID: dialogID}
+		if err := rows.Scan(&o.Ordinal, &o.WordID, &o.Start, &o.End, &o.Surface); err != nil {
+			return nil, err
+		}
+		occurrences = append(occurrences, o)
+	}
+	return occurrences, rows.Err()
+}
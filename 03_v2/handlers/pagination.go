@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// Giới hạn số bản ghi của một trang danh sách
+const (
+	defaultPageLimit = 20
+	maxPageLimit     = 100
+)
+
+// sortColumn là một cột được phép sắp xếp: biểu thức SQL và kiểu để ép giá trị trong cursor.
+// Cast rỗng nghĩa là cột chính là id nên cursor chỉ cần id.
+type sortColumn struct {
+	Expr string
+	Cast string
+}
+
+// pageCursor là vị trí của bản ghi cuối cùng trong trang trước. Sort được ghi lại để cursor
+// không bị dùng với cách sắp xếp khác.
+type pageCursor struct {
+	Sort  string `json:"s"`
+	Value string `json:"v,omitempty"`
+	ID    int64  `json:"id"`
+}
+
+// pageParams là tham số phân trang đã kiểm tra: sort=<cột> tăng dần, sort=-<cột> giảm dần,
+// limit và cursor lấy từ nextCursor của trang trước
+type pageParams struct {
+	Sort   string
+	Column sortColumn
+	Desc   bool
+	Limit  int
+	After  *pageCursor
+}
+
+// readPageParams đọc sort, limit và cursor, tự trả 400 nếu không hợp lệ
+func readPageParams(ctx iris.Context, columns map[string]sortColumn, defaultSort string) (pageParams, bool) {
+	params := pageParams{Sort: ctx.URLParamDefault("sort", defaultSort), Limit: ctx.URLParamIntDefault("limit", defaultPageLimit)}
+
+	name := strings.TrimPrefix(params.Sort, "-")
+	column, ok := columns[name]
+	if !ok {
+		names := make([]string, 0, len(columns))
+		for n := range columns {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Unsupported sort %q, expected one of %s (prefix '-' for descending)", params.Sort, strings.Join(names, ", "))})
+		return params, false
+	}
+	params.Column = column
+	params.Desc = strings.HasPrefix(params.Sort, "-")
+
+	if params.Limit < 1 || params.Limit > maxPageLimit {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("'limit' must be between 1 and %d", maxPageLimit)})
+		return params, false
+	}
+
+	if raw := ctx.URLParam("cursor"); raw != "" {
+		cursor, err := decodePageCursor(raw)
+		if err != nil || cursor.Sort != params.Sort {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: "Invalid 'cursor' for this sort order"})
+			return params, false
+		}
+		params.After = &cursor
+	}
+	return params, true
+}
+
+// keyset thêm điều kiện lấy các bản ghi sau cursor vào where
+func (p pageParams) keyset(where *sqlWhere, idExpr string) {
+	if p.After == nil {
+		return
+	}
+	op := ">"
+	if p.Desc {
+		op = "<"
+	}
+	if p.Column.Cast == "" {
+		where.add(fmt.Sprintf("%s %s %%s", idExpr, op), p.After.ID)
+		return
+	}
+	where.add(fmt.Sprintf("(%s, %s) %s (%%s::%s, %%s)", p.Column.Expr, idExpr, op, p.Column.Cast), p.After.Value, p.After.ID)
+}
+
+// orderBy trả về mệnh đề ORDER BY và LIMIT; lấy thêm một bản ghi để biết còn trang sau hay không
+func (p pageParams) orderBy(idExpr string) string {
+	dir := "ASC"
+	if p.Desc {
+		dir = "DESC"
+	}
+	if p.Column.Cast == "" {
+		return fmt.Sprintf("ORDER BY %s %s LIMIT %d", idExpr, dir, p.Limit+1)
+	}
+	return fmt.Sprintf("ORDER BY %s %s, %s %s LIMIT %d", p.Column.Expr, dir, idExpr, dir, p.Limit+1)
+}
+
+// nextCursor trả về cursor của trang sau từ bản ghi cuối cùng của trang này
+func (p pageParams) nextCursor(value string, id int64) string {
+	data, _ := json.Marshal(pageCursor{Sort: p.Sort, Value: value, ID: id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodePageCursor(raw string) (pageCursor, error) {
+	var cursor pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(raw)
+	if err != nil {
+		return cursor, err
+	}
+	err = json.Unmarshal(data, &cursor)
+	return cursor, err
+}
+
+// cursorTime là giá trị cursor của cột thời gian; Postgres lưu tới micro giây nên không mất độ chính xác
+func cursorTime(t time.Time) string {
+	return t.UTC().Format(time.RFC3339Nano)
+}
+
+// sqlWhere gom các điều kiện WHERE và tham số; %s trong điều kiện được thay bằng $n
+type sqlWhere struct {
+	conds []string
+	args  []interface{}
+}
+
+func (w *sqlWhere) add(cond string, args ...interface{}) {
+	placeholders := make([]interface{}, len(args))
+	for i, arg := range args {
+		w.args = append(w.args, arg)
+		placeholders[i] = fmt.Sprintf("$%d", len(w.args))
+	}
+	w.conds = append(w.conds, fmt.Sprintf(cond, placeholders...))
+}
+
+func (w *sqlWhere) String() string {
+	if len(w.conds) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(w.conds, " AND ")
+}
+
+// readDateRange đọc from và to (RFC 3339 hoặc YYYY-MM-DD) để lọc theo cột thời gian. to chỉ có
+// ngày thì tính hết ngày đó. Tự trả 400 nếu không hợp lệ.
+func readDateRange(ctx iris.Context, where *sqlWhere, column string) bool {
+	for _, param := range []string{"from", "to"} {
+		raw := strings.TrimSpace(ctx.URLParam(param))
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		dateOnly := false
+		if err != nil {
+			t, err = time.Parse(time.DateOnly, raw)
+			dateOnly = true
+		}
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid '%s' %q, expected YYYY-MM-DD or RFC 3339", param, raw)})
+			return false
+		}
+		if param == "from" {
+			where.add(column+" >= %s", t)
+		} else if dateOnly {
+			where.add(column+" < %s", t.AddDate(0, 0, 1))
+		} else {
+			where.add(column+" <= %s", t)
+		}
+	}
+	return true
+}
+
+// likePattern escape ký tự đặc biệt của LIKE để tìm chuỗi con
+func likePattern(s string) string {
+	s = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+	return "%" + s + "%"
+}
@@ -0,0 +1,523 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"vocabulary/config"
+	"vocabulary/database"
+	"vocabulary/dialogue"
+	"vocabulary/models"
+
+	"github.com/kataras/iris/v12"
+)
+
+// Trạng thái của một pipeline và của từng bước
+const (
+	pipelinePending   = "pending"
+	pipelineRunning   = "running"
+	pipelineSucceeded = "succeeded"
+	pipelineFailed    = "failed"
+)
+
+// Các bước của pipeline theo thứ tự chạy
+const (
+	stageGenerate  = "generate"
+	stageExtract   = "extract"
+	stageTranslate = "translate"
+	stageSave      = "save"
+)
+
+var pipelineStages = []string{stageGenerate, stageExtract, stageTranslate, stageSave}
+
+// pipelinePollInterval là chu kỳ worker kiểm tra job mới khi không được đánh thức
+const pipelinePollInterval = 2 * time.Second
+
+// Worker đang chạy job cập nhật updated_at mỗi pipelineHeartbeatInterval. Job đang chạy mà quá
+// pipelineLeaseTimeout không được cập nhật coi như worker đã dừng và được worker khác (kể cả
+// của instance khác) nhận lại.
+const (
+	pipelineHeartbeatInterval = 30 * time.Second
+	pipelineLeaseTimeout      = 2 * time.Minute
+)
+
+// pipelineWake đánh thức một worker đang chờ khi có job mới
+var pipelineWake = make(chan struct{}, 1)
+
+// PipelineRequest là tham số của một lần chạy pipeline: tham số sinh hội thoại và ngôn ngữ đích
+type PipelineRequest struct {
+	DialogRequest
+	Targets []string `json:"targets"`
+	// UserID là người tạo job, lưu ở cột pipeline_job.created_by chứ không nằm trong params
+	UserID int64 `json:"-"`
+	// Attempt là lần chạy hiện tại của job (pipeline_job.attempts), gắn vào sự kiện SSE
+	Attempt int `json:"-"`
+}
+
+// Kết quả của từng bước, lưu dạng JSON để chạy tiếp sau khi khởi động lại
+type (
+	generateOutput struct {
+		DialogID int64               `json:"dialogID"`
+		Dialog   string              `json:"dialog"`
+		Turns    []models.DialogTurn `json:"turns"`
+	}
+	extractOutput struct {
+		Words   []string      `json:"words"`
+		Details []wordDetails `json:"details"`
+	}
+	translateOutput struct {
+		TranslatedWords []map[string]string `json:"translatedWords"`
+	}
+	saveOutput = wordSaveReport
+)
+
+// CreatePipelineHandler đưa một lần chạy generate → extract → translate → save vào hàng đợi
+// và trả về 202 cùng id của job. Body giống POST /dialog, thêm "targets" (mặc định ["en"]).
+func CreatePipelineHandler(ctx iris.Context) {
+	var request PipelineRequest
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	if err := request.DialogRequest.normalize(); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid dialog parameters: %v", err)})
+		return
+	}
+	_, targets, err := translationLangs(request.Lang, request.Targets)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+		return
+	}
+	request.Targets = targets
+	request.UserID = currentUserID(ctx)
+
+	job, err := createPipelineJobInDB(request)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to enqueue pipeline: %v", err)})
+		return
+	}
+
+	select {
+	case pipelineWake <- struct{}{}:
+	default:
+	}
+
+	ctx.StatusCode(iris.StatusAccepted)
+	ctx.JSON(APIResponse{Status: "success", Data: job})
+}
+
+// GetPipelineHandler trả về trạng thái của job cùng kết quả và lỗi của từng bước
+func GetPipelineHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid pipeline id"})
+		return
+	}
+
+	job, ok := loadPipelineJob(ctx, id)
+	if !ok {
+		return
+	}
+	ctx.JSON(APIResponse{Status: "success", Data: job})
+}
+
+// loadPipelineJob đọc job và kiểm tra job thuộc người dùng đang đăng nhập, tự trả 403/404/500 nếu lỗi.
+// Job không rõ người tạo thì người dùng đã đăng nhập nào cũng xem được, giống checkDialogOwner.
+func loadPipelineJob(ctx iris.Context, id int64) (pipelineJob, bool) {
+	job, err := getPipelineJobFromDB(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Pipeline %d not found", id)})
+		return job, false
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load pipeline: %v", err)})
+		return job, false
+	}
+	if job.CreatedBy != 0 && job.CreatedBy != currentUserID(ctx) {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Pipeline %d belongs to another user", id)})
+		return job, false
+	}
+	return job, true
+}
+
+// StartPipelineWorkers chạy n worker lấy job từ bảng pipeline_job.
+// Job đang chạy dở khi server dừng được nhận lại sau pipelineLeaseTimeout và chạy tiếp từ bước chưa xong.
+func StartPipelineWorkers(cfg *config.Configuration) error {
+	workers := cfg.PipelineWorkers
+	if workers < 1 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		go pipelineWorker(cfg.GroqAPIKey)
+	}
+	log.Printf("Started %d pipeline workers", workers)
+	return nil
+}
+
+func pipelineWorker(apiKey string) {
+	ticker := time.NewTicker(pipelinePollInterval)
+	defer ticker.Stop()
+
+	for {
+		id, request, err := claimPipelineJobFromDB()
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			log.Printf("Failed to claim pipeline job: %v", err)
+			if id != 0 {
+				if err := finishPipelineJobInDB(id, pipelineFailed, 0, err.Error()); err != nil {
+					log.Printf("Failed to update pipeline %d: %v", id, err)
+				}
+				publishPipelineEvent(pipelineEvent{JobID: id, Attempt: request.Attempt, Stage: "job", Status: pipelineFailed, Error: err.Error()})
+				continue
+			}
+		}
+		if err != nil {
+			select {
+			case <-pipelineWake:
+			case <-ticker.C:
+			}
+			continue
+		}
+
+		status, jobErr := pipelineSucceeded, ""
+		stop := startPipelineHeartbeat(id)
+		dialogID, err := runPipelineJob(apiKey, id, request)
+		stop()
+		if err != nil {
+			status, jobErr = pipelineFailed, err.Error()
+			log.Printf("Pipeline %d failed: %v", id, err)
+		}
+		if err := finishPipelineJobInDB(id, status, dialogID, jobErr); err != nil {
+			log.Printf("Failed to update pipeline %d: %v", id, err)
+		}
+		publishPipelineEvent(pipelineEvent{JobID: id, Attempt: request.Attempt, Stage: "job", Status: status, Error: jobErr})
+	}
+}
+
+// startPipelineHeartbeat gia hạn job đang chạy cho tới khi hàm trả về được gọi
+func startPipelineHeartbeat(jobID int64) func() {
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(pipelineHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				_, err := database.DB.Exec("UPDATE pipeline_job SET updated_at = NOW() WHERE id = $1 AND status = $2", jobID, pipelineRunning)
+				if err != nil {
+					log.Printf("Failed to extend lease of pipeline %d: %v", jobID, err)
+				}
+			}
+		}
+	}()
+	return func() { close(done) }
+}
+
+// runPipelineJob chạy các bước chưa hoàn thành của job, dùng lại kết quả của các bước đã xong
+func runPipelineJob(apiKey string, jobID int64, request PipelineRequest) (int64, error) {
+	stages, err := getPipelineStagesFromDB(jobID)
+	if err != nil {
+		return 0, err
+	}
+
+	var (
+		generated  generateOutput
+		extracted  extractOutput
+		translated translateOutput
+	)
+	for _, stage := range stages {
+		var output interface{}
+		switch stage.Name {
+		case stageGenerate:
+			output = &generated
+		case stageExtract:
+			output = &extracted
+		case stageTranslate:
+			output = &translated
+		default:
+			output = &saveOutput{}
+		}
+
+		if stage.Status == pipelineSucceeded {
+			if err := json.Unmarshal(stage.Output, output); err != nil {
+				return generated.DialogID, fmt.Errorf("failed to read %s output: %w", stage.Name, err)
+			}
+			continue
+		}
+
+		if err := updatePipelineStageInDB(jobID, stage.Name, pipelineRunning, nil, ""); err != nil {
+			return generated.DialogID, err
+		}
+		publishPipelineEvent(pipelineEvent{JobID: jobID, Attempt: request.Attempt, Stage: stage.Name, Status: pipelineRunning})
+
+		err := runPipelineStage(apiKey, jobID, stage.Name, request, &generated, &extracted, &translated, output)
+		if err != nil {
+			if updateErr := updatePipelineStageInDB(jobID, stage.Name, pipelineFailed, nil, err.Error()); updateErr != nil {
+				log.Printf("Failed to update stage %s of pipeline %d: %v", stage.Name, jobID, updateErr)
+			}
+			publishPipelineEvent(pipelineEvent{JobID: jobID, Attempt: request.Attempt, Stage: stage.Name, Status: pipelineFailed, Error: err.Error()})
+			return generated.DialogID, fmt.Errorf("%s: %w", stage.Name, err)
+		}
+
+		data, err := json.Marshal(output)
+		if err != nil {
+			return generated.DialogID, err
+		}
+		if err := updatePipelineStageInDB(jobID, stage.Name, pipelineSucceeded, data, ""); err != nil {
+			return generated.DialogID, err
+		}
+		publishPipelineEvent(pipelineEvent{JobID: jobID, Attempt: request.Attempt, Stage: stage.Name, Status: pipelineSucceeded, Output: data})
+	}
+	return generated.DialogID, nil
+}
+
+func runPipelineStage(apiKey string, jobID int64, name string, request PipelineRequest, generated *generateOutput, extracted *extractOutput, translated *translateOutput, output interface{}) error {
+	switch name {
+	case stageGenerate:
+		dialog, parsed, err := generatePipelineDialog(apiKey, jobID, request)
+		if err != nil {
+			return err
+		}
+		*generated = generateOutput{DialogID: dialog.ID, Dialog: dialog.Content, Turns: dialogTurnModels(dialog.ID, parsed.Turns)}
+	case stageExtract:
+		words, err := extractWords(apiKey, generated.Dialog, request.Lang)
+		if err != nil {
+			return err
+		}
+		*extracted = extractOutput{Words: wordList(words), Details: words}
+	case stageTranslate:
+		if len(extracted.Words) == 0 {
+			*translated = translateOutput{TranslatedWords: []map[string]string{}}
+			return nil
+		}
+		details := extracted.Details
+		if len(details) == 0 {
+			// Kết quả lọc từ lưu trước khi có thông tin thêm chỉ có danh sách từ
+			details = detailsFromWords(extracted.Words)
+		}
+		words, err := translateWords(apiKey, details, request.Lang, request.Targets)
+		if err != nil {
+			return err
+		}
+		*translated = translateOutput{TranslatedWords: words}
+	case stageSave:
+		report, err := saveWords(request.UserID, generated.DialogID, request.Lang, saveBestEffort, translated.TranslatedWords)
+		if err != nil {
+			return err
+		}
+		*output.(*saveOutput) = report
+	default:
+		return fmt.Errorf("unknown stage %q", name)
+	}
+	return nil
+}
+
+// generatePipelineDialog sinh và lưu hội thoại của job. Hội thoại được gắn vào job trong cùng
+// transaction, nên khi bước generate chạy lại sau khi server dừng thì hội thoại đã lưu được dùng lại.
+func generatePipelineDialog(apiKey string, jobID int64, request PipelineRequest) (models.Dialog, dialogue.Result, error) {
+	var dialogID sql.NullInt64
+	if err := database.DB.QueryRow("SELECT dialog_id FROM pipeline_job WHERE id = $1", jobID).Scan(&dialogID); err != nil {
+		return models.Dialog{}, dialogue.Result{}, err
+	}
+	if dialogID.Valid {
+		dialog, err := getDialogFromDB(dialogID.Int64)
+		if err != nil {
+			return dialog, dialogue.Result{}, err
+		}
+		parsed, err := parseDialog(dialog)
+		return dialog, parsed, err
+	}
+
+	dialog, parsed, err := composeDialog(apiKey, request.UserID, request.DialogRequest)
+	if err != nil {
+		return dialog, parsed, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return dialog, parsed, err
+	}
+	defer tx.Rollback()
+	if dialog.ID, err = saveDialogInTx(tx, dialog, parsed.Turns); err != nil {
+		return dialog, parsed, fmt.Errorf("failed to save dialog to DB: %w", err)
+	}
+	if _, err := tx.Exec("UPDATE pipeline_job SET dialog_id = $2, updated_at = NOW() WHERE id = $1", jobID, dialog.ID); err != nil {
+		return dialog, parsed, err
+	}
+	return dialog, parsed, tx.Commit()
+}
+
+// pipelineJob là trạng thái của một job trả về cho client
+type pipelineJob struct {
+	ID         int64           `json:"id"`
+	Status     string          `json:"status"`
+	Params     json.RawMessage `json:"params"`
+	DialogID   *int64          `json:"dialogID"`
+	Attempts   int             `json:"attempts"`
+	CreatedBy  int64           `json:"createdBy"`
+	Error      string          `json:"error,omitempty"`
+	CreatedAt  time.Time       `json:"createdAt"`
+	UpdatedAt  time.Time       `json:"updatedAt"`
+	StartedAt  *time.Time      `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt"`
+	Stages     []pipelineStage `json:"stages"`
+}
+
+// pipelineStage là trạng thái của một bước
+type pipelineStage struct {
+	Name       string          `json:"name"`
+	Status     string          `json:"status"`
+	Output     json.RawMessage `json:"output,omitempty"`
+	Error      string          `json:"error,omitempty"`
+	StartedAt  *time.Time      `json:"startedAt"`
+	FinishedAt *time.Time      `json:"finishedAt"`
+}
+
+func createPipelineJobInDB(request PipelineRequest) (pipelineJob, error) {
+	params, err := json.Marshal(request)
+	if err != nil {
+		return pipelineJob{}, err
+	}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return pipelineJob{}, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow("INSERT INTO pipeline_job (status, params, created_by) VALUES ($1, $2, NULLIF($3::bigint, 0)) RETURNING id",
+		pipelinePending, params, request.UserID).Scan(&id)
+	if err != nil {
+		return pipelineJob{}, err
+	}
+	for i, name := range pipelineStages {
+		_, err := tx.Exec("INSERT INTO pipeline_stage (job_id, ordinal, name, status) VALUES ($1, $2, $3, $4)", id, i+1, name, pipelinePending)
+		if err != nil {
+			return pipelineJob{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return pipelineJob{}, err
+	}
+	return getPipelineJobFromDB(id)
+}
+
+// claimPipelineJobFromDB lấy job chờ lâu nhất, hoặc job đang chạy đã hết hạn (worker giữ nó đã dừng),
+// và đánh dấu đang chạy; trả về sql.ErrNoRows nếu không có job
+func claimPipelineJobFromDB() (int64, PipelineRequest, error) {
+	var id int64
+	var params []byte
+	var createdBy sql.NullInt64
+	var attempt int
+	var request PipelineRequest
+	err := database.DB.QueryRow(`UPDATE pipeline_job SET status = $1, attempts = attempts + 1,
+		started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+		WHERE id = (SELECT id FROM pipeline_job
+			WHERE status = $2 OR (status = $1 AND updated_at < NOW() - $3 * INTERVAL '1 second')
+			ORDER BY id FOR UPDATE SKIP LOCKED LIMIT 1)
+		RETURNING id, params, created_by, attempts`, pipelineRunning, pipelinePending, pipelineLeaseTimeout.Seconds()).
+		Scan(&id, &params, &createdBy, &attempt)
+	if err != nil {
+		return 0, request, err
+	}
+	err = json.Unmarshal(params, &request)
+	request.UserID = createdBy.Int64
+	request.Attempt = attempt
+	if err != nil {
+		return id, request, fmt.Errorf("invalid params of pipeline %d: %w", id, err)
+	}
+	return id, request, nil
+}
+
+func finishPipelineJobInDB(id int64, status string, dialogID int64, jobErr string) error {
+	_, err := database.DB.Exec(`UPDATE pipeline_job SET status = $2, dialog_id = COALESCE(NULLIF($3, 0), dialog_id), error = $4,
+		finished_at = NOW(), updated_at = NOW() WHERE id = $1`, id, status, dialogID, jobErr)
+	return err
+}
+
+func updatePipelineStageInDB(jobID int64, name, status string, output []byte, stageErr string) error {
+	_, err := database.DB.Exec(`UPDATE pipeline_stage SET status = $3::text, output = COALESCE($4::jsonb, output), error = $5,
+		started_at = CASE WHEN $3::text = 'running' THEN NOW() ELSE started_at END,
+		finished_at = CASE WHEN $3::text IN ('succeeded', 'failed') THEN NOW() ELSE NULL END
+		WHERE job_id = $1 AND name = $2`, jobID, name, status, nullableJSON(output), stageErr)
+	if err != nil {
+		return err
+	}
+	_, err = database.DB.Exec("UPDATE pipeline_job SET updated_at = NOW() WHERE id = $1", jobID)
+	return err
+}
+
+func getPipelineJobFromDB(id int64) (pipelineJob, error) {
+	job := pipelineJob{ID: id}
+	var dialogID sql.NullInt64
+	var startedAt, finishedAt sql.NullTime
+	err := database.DB.QueryRow(`SELECT status, params, dialog_id, attempts, COALESCE(created_by, 0), error, created_at, updated_at,
+			started_at, finished_at
+		FROM pipeline_job WHERE id = $1`, id).Scan(&job.Status, &job.Params, &dialogID, &job.Attempts, &job.CreatedBy, &job.Error,
+		&job.CreatedAt, &job.UpdatedAt, &startedAt, &finishedAt)
+	if err != nil {
+		return job, err
+	}
+	if dialogID.Valid {
+		job.DialogID = &dialogID.Int64
+	}
+	job.StartedAt = nullTime(startedAt)
+	job.FinishedAt = nullTime(finishedAt)
+
+	job.Stages, err = getPipelineStagesFromDB(id)
+	return job, err
+}
+
+func getPipelineStagesFromDB(jobID int64) ([]pipelineStage, error) {
+	rows, err := database.DB.Query(`SELECT name, status, output, error, started_at, finished_at
+		FROM pipeline_stage WHERE job_id = $1 ORDER BY ordinal`, jobID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stages := []pipelineStage{}
+	for rows.Next() {
+		var s pipelineStage
+		var output []byte
+		var startedAt, finishedAt sql.NullTime
+		if err := rows.Scan(&s.Name, &s.Status, &output, &s.Error, &startedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		if output != nil {
+			s.Output = output
+		}
+		s.StartedAt = nullTime(startedAt)
+		s.FinishedAt = nullTime(finishedAt)
+		stages = append(stages, s)
+	}
+	return stages, rows.Err()
+}
+
+func nullableJSON(data []byte) interface{} {
+	if data == nil {
+		return nil
+	}
+	return string(data)
+}
+
+func nullTime(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
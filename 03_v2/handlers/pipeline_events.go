@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kataras/iris/v12"
+)
+
+// pipelineKeepAlive là chu kỳ gửi comment giữ kết nối SSE khi chưa có sự kiện
+const pipelineKeepAlive = 15 * time.Second
+
+// pipelineEvent là một thay đổi trạng thái của job hoặc của một bước.
+// Stage là "job" với sự kiện kết thúc job; Attempt là lần chạy của job phát ra sự kiện.
+type pipelineEvent struct {
+	JobID   int64           `json:"jobID"`
+	Attempt int             `json:"attempt"`
+	Stage   string          `json:"stage"`
+	Status  string          `json:"status"`
+	Output  json.RawMessage `json:"output,omitempty"`
+	Error   string          `json:"error,omitempty"`
+}
+
+// name là tên sự kiện SSE, ví dụ "generate.succeeded" hoặc "job.failed"
+func (e pipelineEvent) name() string {
+	return e.Stage + "." + e.Status
+}
+
+// key phân biệt sự kiện đã gửi; bước chạy lại sau khi job được nhận lại có attempt mới nên vẫn được gửi
+func (e pipelineEvent) key() string {
+	return fmt.Sprintf("%d:%s", e.Attempt, e.name())
+}
+
+// pipelineBroker phát sự kiện của job đến các client đang theo dõi trong tiến trình này
+var pipelineBroker = struct {
+	sync.Mutex
+	subscribers map[int64]map[chan pipelineEvent]struct{}
+}{subscribers: make(map[int64]map[chan pipelineEvent]struct{})}
+
+func subscribePipeline(jobID int64) (chan pipelineEvent, func()) {
+	ch := make(chan pipelineEvent, 16)
+	pipelineBroker.Lock()
+	if pipelineBroker.subscribers[jobID] == nil {
+		pipelineBroker.subscribers[jobID] = make(map[chan pipelineEvent]struct{})
+	}
+	pipelineBroker.subscribers[jobID][ch] = struct{}{}
+	pipelineBroker.Unlock()
+
+	return ch, func() {
+		pipelineBroker.Lock()
+		delete(pipelineBroker.subscribers[jobID], ch)
+		if len(pipelineBroker.subscribers[jobID]) == 0 {
+			delete(pipelineBroker.subscribers, jobID)
+		}
+		pipelineBroker.Unlock()
+	}
+}
+
+// publishPipelineEvent gửi sự kiện mà không chờ; client chậm bị bỏ lỡ sự kiện
+// có thể kết nối lại để nhận lại trạng thái từ cơ sở dữ liệu
+func publishPipelineEvent(event pipelineEvent) {
+	pipelineBroker.Lock()
+	defer pipelineBroker.Unlock()
+	for ch := range pipelineBroker.subscribers[event.JobID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// PipelineEventsHandler truyền các thay đổi trạng thái của job qua Server-Sent Events.
+// Sự kiện có tên "<bước>.<trạng thái>" (generate.succeeded: đã sinh hội thoại, extract.succeeded:
+// đã lọc từ, translate.succeeded: đã dịch, save.succeeded: đã lưu, <bước>.failed: lỗi) và mang
+// kết quả của bước. Khi kết nối, các bước đã chạy được gửi lại trước; luồng kết thúc bằng
+// sự kiện job.succeeded hoặc job.failed.
+func PipelineEventsHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid pipeline id"})
+		return
+	}
+
+	// Đăng ký trước khi đọc trạng thái để không bỏ lỡ sự kiện xảy ra ở giữa
+	events, unsubscribe := subscribePipeline(id)
+	defer unsubscribe()
+
+	job, ok := loadPipelineJob(ctx, id)
+	if !ok {
+		return
+	}
+
+	ctx.ContentType("text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	ctx.Header("X-Accel-Buffering", "no")
+
+	sent := make(map[string]bool)
+	send := func(event pipelineEvent) error {
+		sent[event.key()] = true
+		data, err := json.Marshal(event)
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintf(ctx.ResponseWriter(), "event: %s\ndata: %s\n\n", event.name(), data); err != nil {
+			return err
+		}
+		ctx.ResponseWriter().Flush()
+		return nil
+	}
+
+	for _, stage := range job.Stages {
+		if stage.Status == pipelinePending {
+			continue
+		}
+		if err := send(pipelineEvent{JobID: id, Attempt: job.Attempts, Stage: stage.Name, Status: stage.Status, Output: stage.Output, Error: stage.Error}); err != nil {
+			return
+		}
+	}
+	if job.Status == pipelineSucceeded || job.Status == pipelineFailed {
+		send(pipelineEvent{JobID: id, Attempt: job.Attempts, Stage: "job", Status: job.Status, Error: job.Error})
+		return
+	}
+	ctx.ResponseWriter().Flush()
+
+	keepAlive := time.NewTicker(pipelineKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-ctx.Request().Context().Done():
+			return
+		case <-keepAlive.C:
+			if _, err := fmt.Fprint(ctx.ResponseWriter(), ": keep-alive\n\n"); err != nil {
+				return
+			}
+			ctx.ResponseWriter().Flush()
+		case event := <-events:
+			if sent[event.key()] {
+				continue
+			}
+			if err := send(event); err != nil || event.Stage == "job" {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,372 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"vocabulary/database"
+	"vocabulary/models"
+	"vocabulary/srs"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// Giới hạn số thẻ trả về một lần
+const (
+	defaultReviewLimit = 20
+	maxReviewLimit     = 100
+	defaultNewCards    = 10
+)
+
+// reviewSchedule là lịch ôn tiếp theo nếu người học chọn điểm Grade
+type reviewSchedule struct {
+	Grade    srs.Grade `json:"grade"`
+	Interval int       `json:"intervalDays"`
+	DueAt    time.Time `json:"dueAt"`
+}
+
+// reviewItem là một thẻ cần ôn cùng từ vựng và lịch ôn của từng lựa chọn
+type reviewItem struct {
+	Card  models.ReviewCard `json:"card"`
+	Word  models.Word       `json:"word"`
+	IsNew bool              `json:"isNew"`
+	Next  []reviewSchedule  `json:"next"`
+}
+
+// learnerID là khoá người học trong review_card và review_log: id của người dùng đã đăng nhập
+func learnerID(userID int64) string {
+	return strconv.FormatInt(userID, 10)
+}
+
+// DueReviewsHandler trả về các thẻ đã đến hạn ôn của người dùng, sớm nhất trước, rồi tới các từ trong
+// từ vựng của người dùng chưa ôn lần nào (tối đa 'new', mặc định 10). 'dialog' giới hạn trong từ vựng của một hội thoại; 'limit' mặc định 20.
+func DueReviewsHandler(ctx iris.Context) {
+	learner := learnerID(currentUserID(ctx))
+	dialogID := ctx.URLParamInt64Default("dialog", 0)
+	limit := ctx.URLParamIntDefault("limit", defaultReviewLimit)
+	newLimit := ctx.URLParamIntDefault("new", defaultNewCards)
+	if limit < 1 || limit > maxReviewLimit || newLimit < 0 || newLimit > maxReviewLimit {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("'limit' must be between 1 and %d and 'new' between 0 and %d", maxReviewLimit, maxReviewLimit)})
+		return
+	}
+
+	now := time.Now()
+	cards, err := getDueReviewCardsFromDB(learner, dialogID, now, limit)
+	if err == nil && len(cards) < limit && newLimit > 0 {
+		var fresh []models.ReviewCard
+		fresh, err = getNewReviewCardsFromDB(currentUserID(ctx), dialogID, now, min(newLimit, limit-len(cards)))
+		cards = append(cards, fresh...)
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load review cards: %v", err)})
+		return
+	}
+
+	items := []reviewItem{}
+	for _, card := range cards {
+		word, err := getReviewWord(card.WordID, dialogID)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load word %d: %v", card.WordID, err)})
+			return
+		}
+		items = append(items, reviewItem{Card: card, Word: word, IsNew: card.LastReviewedAt == nil, Next: reviewSchedules(card, now)})
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"learner": learner, "cards": items}})
+}
+
+// SubmitReviewHandler ghi điểm một lần ôn ({"wordID": 1, "grade": 0–5}) và trả về trạng thái mới của thẻ
+// cùng lịch ôn của từng lựa chọn cho lần sau
+func SubmitReviewHandler(ctx iris.Context) {
+	var request struct {
+		WordID int64      `json:"wordID"`
+		Grade  *srs.Grade `json:"grade"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	if request.WordID == 0 || request.Grade == nil || !request.Grade.Valid() {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Both 'wordID' and 'grade' (0-5) are required"})
+		return
+	}
+
+	card, err := submitReviewInDB(currentUserID(ctx), request.WordID, *request.Grade, time.Now())
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23503" {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d not found", request.WordID)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save review: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{
+		"card": card,
+		"next": reviewSchedules(card, card.DueAt),
+	}})
+}
+
+// ReviewHistoryHandler trả về các lần ôn gần nhất của người học, mới nhất trước; 'word' lọc theo một từ
+func ReviewHistoryHandler(ctx iris.Context) {
+	learner := learnerID(currentUserID(ctx))
+	wordID := ctx.URLParamInt64Default("word", 0)
+	limit := ctx.URLParamIntDefault("limit", 50)
+	if limit < 1 || limit > 500 {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "'limit' must be between 1 and 500"})
+		return
+	}
+
+	rows, err := database.DB.Query(`SELECT id, word_id, grade, ease, interval_days, due_at, reviewed_at FROM review_log
+		WHERE learner = $1 AND ($2::bigint = 0 OR word_id = $2::bigint) ORDER BY reviewed_at DESC, id DESC LIMIT $3`,
+		learner, wordID, limit)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load review history: %v", err)})
+		return
+	}
+	defer rows.Close()
+
+	history := []models.ReviewLog{}
+	for rows.Next() {
+		l := models.ReviewLog{Learner: learner}
+		if err := rows.Scan(&l.ID, &l.WordID, &l.Grade, &l.Ease, &l.Interval, &l.DueAt, &l.ReviewedAt); err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load review history: %v", err)})
+			return
+		}
+		history = append(history, l)
+	}
+	if err := rows.Err(); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load review history: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: history})
+}
+
+// ClaimReviewsHandler chuyển thẻ và lịch sử ôn tập lưu theo header X-Learner-ID (trước khi có tài khoản)
+// sang người dùng đang đăng nhập, từ {"learner": "<giá trị X-Learner-ID cũ>"}. Từ mà người dùng đã có
+// thẻ thì giữ thẻ hiện tại; lịch sử luôn được chuyển. Khoá toàn chữ số không chuyển được vì trùng với id người dùng.
+func ClaimReviewsHandler(ctx iris.Context) {
+	var request struct {
+		Learner string `json:"learner"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	if request.Learner == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'learner'"})
+		return
+	}
+	if _, err := strconv.ParseInt(request.Learner, 10, 64); err == nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Numeric learner IDs are account IDs and cannot be claimed"})
+		return
+	}
+
+	cards, logs, err := claimReviewsInDB(request.Learner, currentUserID(ctx))
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to claim reviews: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"cards": cards, "reviews": logs}})
+}
+
+// claimReviewsInDB chuyển thẻ và lịch sử của khoá learner cũ sang userID, trả về số thẻ và số lần ôn đã chuyển.
+// Các từ được thêm vào từ vựng của người dùng.
+func claimReviewsInDB(learner string, userID int64) (int64, int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	owner := learnerID(userID)
+	res, err := tx.Exec(`INSERT INTO review_card (learner, word_id, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at, created_at)
+		SELECT $2, word_id, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at, created_at FROM review_card WHERE learner = $1
+		ON CONFLICT (learner, word_id) DO NOTHING`, learner, owner)
+	if err != nil {
+		return 0, 0, err
+	}
+	cards, _ := res.RowsAffected()
+	_, err = tx.Exec(`INSERT INTO user_word (user_id, word_id) SELECT $2, word_id FROM review_card WHERE learner = $1
+		ON CONFLICT DO NOTHING`, learner, userID)
+	if err != nil {
+		return 0, 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM review_card WHERE learner = $1", learner); err != nil {
+		return 0, 0, err
+	}
+	res, err = tx.Exec("UPDATE review_log SET learner = $2 WHERE learner = $1", learner, owner)
+	if err != nil {
+		return 0, 0, err
+	}
+	logs, _ := res.RowsAffected()
+	return cards, logs, tx.Commit()
+}
+
+// reviewSchedules tính trước lịch ôn của thẻ với từng điểm 0–5 nếu ôn tại now
+func reviewSchedules(card models.ReviewCard, now time.Time) []reviewSchedule {
+	preview := srs.Preview(srsCard(card), now)
+	schedules := make([]reviewSchedule, 0, len(preview))
+	for g := srs.Grade(0); g <= 5; g++ {
+		schedules = append(schedules, reviewSchedule{Grade: g, Interval: preview[g].Interval, DueAt: preview[g].Due})
+	}
+	return schedules
+}
+
+func srsCard(card models.ReviewCard) srs.Card {
+	return srs.Card{Ease: card.Ease, Interval: card.Interval, Repetitions: card.Repetitions, Lapses: card.Lapses, Due: card.DueAt}
+}
+
+// submitReviewInDB áp dụng điểm lên thẻ (tạo thẻ mới nếu chưa có), lưu thẻ và ghi lịch sử trong một transaction.
+// Từ chưa có trong từ vựng của người dùng được thêm vào.
+func submitReviewInDB(userID, wordID int64, grade srs.Grade, now time.Time) (models.ReviewCard, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return models.ReviewCard{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("INSERT INTO user_word (user_id, word_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, wordID); err != nil {
+		return models.ReviewCard{}, err
+	}
+	learner := learnerID(userID)
+
+	card := models.ReviewCard{Learner: learner, WordID: wordID}
+	err = tx.QueryRow(`SELECT ease, interval_days, repetitions, lapses, due_at FROM review_card
+		WHERE learner = $1 AND word_id = $2 FOR UPDATE`, learner, wordID).
+		Scan(&card.Ease, &card.Interval, &card.Repetitions, &card.Lapses, &card.DueAt)
+	state := srsCard(card)
+	if errors.Is(err, sql.ErrNoRows) {
+		state = srs.NewCard(now)
+	} else if err != nil {
+		return card, err
+	}
+
+	state, err = srs.Review(state, grade, now)
+	if err != nil {
+		return card, err
+	}
+	card.Ease, card.Interval, card.Repetitions, card.Lapses, card.DueAt = state.Ease, state.Interval, state.Repetitions, state.Lapses, state.Due
+	card.LastReviewedAt = &now
+
+	_, err = tx.Exec(`INSERT INTO review_card (learner, word_id, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT (learner, word_id) DO UPDATE SET ease = EXCLUDED.ease, interval_days = EXCLUDED.interval_days,
+			repetitions = EXCLUDED.repetitions, lapses = EXCLUDED.lapses, due_at = EXCLUDED.due_at,
+			last_reviewed_at = EXCLUDED.last_reviewed_at`,
+		learner, wordID, card.Ease, card.Interval, card.Repetitions, card.Lapses, card.DueAt, now)
+	if err != nil {
+		return card, err
+	}
+	_, err = tx.Exec(`INSERT INTO review_log (learner, word_id, grade, ease, interval_days, due_at, reviewed_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`, learner, wordID, int(grade), card.Ease, card.Interval, card.DueAt, now)
+	if err != nil {
+		return card, err
+	}
+	return card, tx.Commit()
+}
+
+func getDueReviewCardsFromDB(learner string, dialogID int64, now time.Time, limit int) ([]models.ReviewCard, error) {
+	rows, err := database.DB.Query(`SELECT word_id, ease, interval_days, repetitions, lapses, due_at, last_reviewed_at
+		FROM review_card c
+		WHERE learner = $1 AND due_at <= $2
+		AND ($3::bigint = 0 OR EXISTS (SELECT 1 FROM word_dialog wd WHERE wd.dialog_id = $3::bigint AND wd.word_id = c.word_id))
+		ORDER BY due_at, word_id LIMIT $4`, learner, now, dialogID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []models.ReviewCard
+	for rows.Next() {
+		card := models.ReviewCard{Learner: learner}
+		var last sql.NullTime
+		if err := rows.Scan(&card.WordID, &card.Ease, &card.Interval, &card.Repetitions, &card.Lapses, &card.DueAt, &last); err != nil {
+			return nil, err
+		}
+		card.LastReviewedAt = nullTime(last)
+		cards = append(cards, card)
+	}
+	return cards, rows.Err()
+}
+
+// getNewReviewCardsFromDB trả về thẻ mới (chưa lưu) cho các từ trong từ vựng của người dùng chưa ôn lần nào
+func getNewReviewCardsFromDB(userID, dialogID int64, now time.Time, limit int) ([]models.ReviewCard, error) {
+	learner := learnerID(userID)
+	rows, err := database.DB.Query(`SELECT uw.word_id FROM user_word uw
+		WHERE uw.user_id = $1
+		AND NOT EXISTS (SELECT 1 FROM review_card c WHERE c.learner = $2 AND c.word_id = uw.word_id)
+		AND ($3::bigint = 0 OR EXISTS (SELECT 1 FROM word_dialog wd WHERE wd.dialog_id = $3::bigint AND wd.word_id = uw.word_id))
+		ORDER BY uw.added_at, uw.word_id LIMIT $4`, userID, learner, dialogID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var cards []models.ReviewCard
+	for rows.Next() {
+		card := models.ReviewCard{Learner: learner}
+		if err := rows.Scan(&card.WordID); err != nil {
+			return nil, err
+		}
+		state := srs.NewCard(now)
+		card.Ease, card.DueAt = state.Ease, state.Due
+		cards = append(cards, card)
+	}
+	return cards, rows.Err()
+}
+
+// getReviewWord trả về từ cùng bản dịch của một nghĩa: nghĩa dùng trong hội thoại dialogID nếu có,
+// ngược lại nghĩa đầu tiên không cần kiểm tra
+func getReviewWord(wordID, dialogID int64) (models.Word, error) {
+	word, senses, err := getWordWithSenses(wordID)
+	if err != nil || len(senses) == 0 {
+		return word, err
+	}
+
+	var senseID int64
+	if dialogID != 0 {
+		var id sql.NullInt64
+		err := database.DB.QueryRow("SELECT sense_id FROM word_dialog WHERE dialog_id = $1 AND word_id = $2", dialogID, wordID).Scan(&id)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) {
+			return word, err
+		}
+		senseID = id.Int64
+	}
+	sense := senses[0]
+	for _, s := range senses {
+		if s.ID == senseID || (senseID == 0 && !s.NeedsReview) {
+			sense = s
+			break
+		}
+	}
+	word.SenseID = sense.ID
+	word.Translations = sense.Translations
+	word.Glosses = sense.Glosses
+	if sense.PartOfSpeech != "" {
+		word.PartOfSpeech = sense.PartOfSpeech
+	}
+	return word, nil
+}
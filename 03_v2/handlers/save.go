@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"vocabulary/database"
+	"vocabulary/models"
+	"vocabulary/textnorm"
+)
+
+// Chế độ lưu từ vựng
+const (
+	saveAtomic     = "atomic"      // lưu tất cả hoặc không lưu gì
+	saveBestEffort = "best_effort" // lưu những từ hợp lệ, bỏ qua từ lỗi
+)
+
+// Kết quả lưu của từng từ
+const (
+	wordCreated = "created" // từ mới được thêm
+	wordReused  = "reused"  // từ đã có, chỉ thêm nghĩa hoặc bản dịch còn thiếu và liên kết
+	wordFailed  = "failed"  // từ không được lưu, xem Error
+)
+
+// wordSaveResult là kết quả lưu của một phần tử trong translatedWords, theo đúng thứ tự gửi lên
+type wordSaveResult struct {
+	Index        int               `json:"index"`
+	Word         string            `json:"word"`
+	Lang         string            `json:"lang"`
+	Translations map[string]string `json:"translations,omitempty"`
+	Metadata     map[string]string `json:"metadata,omitempty"` // pos, example, pronunciation, difficulty, gloss:<mã>
+	WordID       int64             `json:"wordID,omitempty"`
+	SenseID      int64             `json:"senseID,omitempty"`
+	Sense        string            `json:"sense,omitempty"` // matched, created hoặc review
+	Occurrences  int               `json:"occurrences"`     // số lần từ xuất hiện trong hội thoại
+	NotInDialog  bool              `json:"notInDialog,omitempty"`
+	Outcome      string            `json:"outcome"`
+	Error        string            `json:"error,omitempty"`
+}
+
+// wordSaveReport tổng hợp kết quả một lần lưu
+type wordSaveReport struct {
+	Mode       string                   `json:"mode"`
+	Results    []wordSaveResult         `json:"results"`
+	SavedWords []map[string]interface{} `json:"savedWords"`
+	Created    int                      `json:"created"`
+	Reused     int                      `json:"reused"`
+	Failed     int                      `json:"failed"`
+	// NotInDialog là số từ đã lưu nhưng không tìm thấy trong hội thoại
+	NotInDialog int `json:"notInDialog"`
+}
+
+// saveWordsMode kiểm tra chế độ lưu, mặc định là atomic
+func saveWordsMode(mode string) (string, error) {
+	switch mode {
+	case "":
+		return saveAtomic, nil
+	case saveAtomic, saveBestEffort:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unsupported mode %q, expected %s or %s", mode, saveAtomic, saveBestEffort)
+}
+
+// saveWords lưu các từ đã dịch, liên kết với hội thoại, thêm vào từ vựng của người dùng userID
+// (0 nếu không rõ) và tính lại vị trí của từ trong hội thoại trong một transaction.
+// Ở chế độ atomic, một từ lỗi làm huỷ toàn bộ; ở chế độ best_effort, mỗi từ nằm trong
+// một savepoint riêng nên từ lỗi được bỏ qua. Lỗi trả về chỉ là lỗi của transaction,
+// lỗi của từng từ nằm trong báo cáo.
+func saveWords(userID, dialogID int64, source, mode string, translatedWords []map[string]string) (wordSaveReport, error) {
+	report := wordSaveReport{Mode: mode, Results: make([]wordSaveResult, len(translatedWords)), SavedWords: []map[string]interface{}{}}
+
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	for i, translatedWord := range translatedWords {
+		result := &report.Results[i]
+		result.Index = i
+		result.Lang = source
+		result.Word = translatedWord[source]
+
+		word, err := wordFromTranslation(translatedWord, source)
+		if err == nil {
+			result.Word = word.Content
+			result.Translations = word.Translations
+			result.Metadata = wordMetadata(word)
+			if mode == saveBestEffort {
+				err = saveWordInSavepoint(tx, userID, dialogID, word, result)
+			} else {
+				err = saveWordTx(tx, userID, dialogID, word, result)
+			}
+		}
+		if err != nil {
+			log.Printf("Failed to save word %v: %v", translatedWord, err)
+			result.Outcome = wordFailed
+			result.Error = err.Error()
+			report.Failed++
+			if mode == saveAtomic {
+				break
+			}
+		}
+	}
+
+	if mode == saveAtomic && report.Failed > 0 {
+		for i := range report.Results {
+			result := &report.Results[i]
+			if result.Outcome != wordFailed {
+				result.Index = i
+				result.Outcome = wordFailed
+				result.WordID = 0
+				result.Error = "not saved: another word failed and the batch was rolled back"
+				if result.Word == "" {
+					result.Word = translatedWords[i][source]
+					result.Lang = source
+				}
+			}
+		}
+		report.Failed = len(report.Results)
+		return report, nil
+	}
+
+	counts, err := refreshWordOccurrences(tx, dialogID)
+	if err != nil {
+		return report, fmt.Errorf("locate words in dialog: %w", err)
+	}
+	for i := range report.Results {
+		result := &report.Results[i]
+		if result.Outcome != wordFailed {
+			result.Occurrences = counts[result.WordID]
+			result.NotInDialog = result.Occurrences == 0
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return report, err
+	}
+
+	for _, result := range report.Results {
+		switch result.Outcome {
+		case wordCreated:
+			report.Created++
+		case wordReused:
+			report.Reused++
+		default:
+			continue
+		}
+		if result.NotInDialog {
+			report.NotInDialog++
+		}
+		saved := map[string]interface{}{
+			source:        result.Word,
+			"wordID":      result.WordID,
+			"senseID":     result.SenseID,
+			"sense":       result.Sense,
+			"outcome":     result.Outcome,
+			"occurrences": result.Occurrences,
+		}
+		for lang, text := range result.Translations {
+			saved[lang] = text
+		}
+		for key, value := range result.Metadata {
+			saved[key] = value
+		}
+		report.SavedWords = append(report.SavedWords, saved)
+	}
+	return report, nil
+}
+
+// wordMetadata trả về thông tin thêm của từ theo khoá dùng trong từ đã dịch
+func wordMetadata(word models.Word) map[string]string {
+	meta := wordDetails{
+		PartOfSpeech:  word.PartOfSpeech,
+		Example:       word.Example,
+		Pronunciation: word.Pronunciation,
+		Difficulty:    word.Difficulty,
+	}.metadata()
+	for lang, gloss := range word.Glosses {
+		meta[glossKey(lang)] = gloss
+	}
+	return meta
+}
+
+// saveWordInSavepoint lưu một từ trong savepoint; khi lỗi chỉ phần của từ đó bị huỷ
+// và transaction vẫn dùng tiếp được
+func saveWordInSavepoint(tx *sql.Tx, userID, dialogID int64, word models.Word, result *wordSaveResult) error {
+	if _, err := tx.Exec("SAVEPOINT save_word"); err != nil {
+		return err
+	}
+	if err := saveWordTx(tx, userID, dialogID, word, result); err != nil {
+		if _, rbErr := tx.Exec("ROLLBACK TO SAVEPOINT save_word"); rbErr != nil {
+			return fmt.Errorf("%v (rollback to savepoint: %v)", err, rbErr)
+		}
+		result.WordID = 0
+		return err
+	}
+	_, err := tx.Exec("RELEASE SAVEPOINT save_word")
+	return err
+}
+
+// saveWordTx lưu từ, bản dịch, liên kết với hội thoại và với người dùng, ghi kết quả vào result
+func saveWordTx(tx *sql.Tx, userID, dialogID int64, word models.Word, result *wordSaveResult) error {
+	wordID, created, err := saveWordToDB(tx, userID, word)
+	if err != nil {
+		return fmt.Errorf("save word: %w", err)
+	}
+	senseID, how, err := saveWordSense(tx, wordID, word)
+	if err != nil {
+		return fmt.Errorf("save sense: %w", err)
+	}
+	if err := createWordDialogRelation(tx, dialogID, wordID, senseID, word.Example); err != nil {
+		return fmt.Errorf("link to dialog: %w", err)
+	}
+	if userID != 0 {
+		_, err := tx.Exec("INSERT INTO user_word (user_id, word_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, wordID)
+		if err != nil {
+			return fmt.Errorf("add to vocabulary: %w", err)
+		}
+	}
+
+	result.WordID = wordID
+	result.SenseID = senseID
+	result.Sense = how
+	result.Outcome = wordReused
+	if created {
+		result.Outcome = wordCreated
+	}
+	return nil
+}
+
+// saveWordToDB trả về id của từ, thêm mới nếu chưa có; created cho biết từ vừa được thêm.
+// Từ được nhận diện theo khoá chuẩn hoá (NFC, chữ thường, bỏ dấu câu ở hai đầu) nên các cách
+// viết khác nhau của cùng một từ dùng chung một bản ghi, kể cả khi lưu đồng thời.
+// userID chỉ được ghi là người tạo khi từ vừa được thêm.
+func saveWordToDB(tx *sql.Tx, userID int64, word models.Word) (int64, bool, error) {
+	key := textnorm.Normalize(word.Content)
+	if key == "" {
+		return 0, false, fmt.Errorf("word %q has no letters", word.Content)
+	}
+
+	var id int64
+	var created bool
+	// Từ đã có chỉ được bổ sung thông tin còn trống, không ghi đè
+	err := tx.QueryRow(`INSERT INTO word (lang, content, norm_key, pronunciation, part_of_speech, difficulty, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7::bigint, 0))
+		ON CONFLICT (lang, norm_key) WHERE norm_key <> '' DO UPDATE SET
+			pronunciation = CASE WHEN word.pronunciation = '' THEN EXCLUDED.pronunciation ELSE word.pronunciation END,
+			part_of_speech = CASE WHEN word.part_of_speech = '' THEN EXCLUDED.part_of_speech ELSE word.part_of_speech END,
+			difficulty = CASE WHEN word.difficulty = '' THEN EXCLUDED.difficulty ELSE word.difficulty END
+		RETURNING id, xmax = 0`,
+		word.Lang, textnorm.Clean(word.Content), key, word.Pronunciation, word.PartOfSpeech, word.Difficulty, userID).Scan(&id, &created)
+	return id, created, err
+}
+
+// createWordDialogRelation gắn từ với hội thoại và ghi lại nghĩa được dùng trong hội thoại đó
+func createWordDialogRelation(tx *sql.Tx, dialogID, wordID, senseID int64, example string) error {
+	_, err := tx.Exec(`INSERT INTO word_dialog (dialog_id, word_id, sense_id, example) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (dialog_id, word_id) DO UPDATE SET sense_id = EXCLUDED.sense_id,
+			example = CASE WHEN EXCLUDED.example = '' THEN word_dialog.example ELSE EXCLUDED.example END`,
+		dialogID, wordID, senseID, example)
+	return err
+}
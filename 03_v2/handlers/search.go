@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"fmt"
+	"html"
+	"strings"
+	"unicode/utf8"
+
+	"vocabulary/database"
+	"vocabulary/langtag"
+
+	"github.com/kataras/iris/v12"
+)
+
+const maxSearchQueryLen = 200
+
+// Ký tự đánh dấu đoạn khớp do ts_headline chèn vào, thay bằng <mark> sau khi escape HTML.
+// Dùng ký tự vùng riêng (private use) để không trùng với nội dung.
+const (
+	markStart = "\uE000"
+	markStop  = "\uE001"
+)
+
+// searchHeadlineOptions là tuỳ chọn của ts_headline cho đoạn trích
+var searchHeadlineOptions = fmt.Sprintf("StartSel=%s, StopSel=%s, MaxWords=30, MinWords=10, MaxFragments=2, FragmentDelimiter=\" … \"", markStart, markStop)
+
+// SearchResult là một kết quả tìm kiếm. Snippet là HTML đã escape, đoạn khớp nằm trong <mark>.
+type SearchResult struct {
+	Type    string  `json:"type"` // dialog hoặc word
+	ID      int64   `json:"id"`
+	Lang    string  `json:"lang"`
+	Title   string  `json:"title"`
+	Snippet string  `json:"snippet"`
+	Rank    float64 `json:"rank"`
+}
+
+// SearchHandler tìm toàn văn trong nội dung hội thoại, từ vựng và bản dịch, không phân biệt dấu và chữ hoa.
+// q theo cú pháp tìm kiếm web ("cụm từ", OR, -loại trừ); type=dialog|word lọc loại kết quả,
+// lang lọc theo ngôn ngữ của hội thoại hoặc từ. Kết quả xếp theo độ liên quan, phân trang bằng limit/offset.
+func SearchHandler(ctx iris.Context) {
+	q := strings.TrimSpace(ctx.URLParam("q"))
+	if q == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Missing 'q' parameter"})
+		return
+	}
+	if utf8.RuneCountInString(q) > maxSearchQueryLen {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("'q' must be at most %d characters", maxSearchQueryLen)})
+		return
+	}
+	kind := ctx.URLParam("type")
+	if kind != "" && kind != "dialog" && kind != "word" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Unsupported type %q, expected dialog or word", kind)})
+		return
+	}
+	lang := ""
+	if raw := ctx.URLParam("lang"); raw != "" {
+		var err error
+		if lang, err = langtag.Normalize(raw); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+			return
+		}
+	}
+	limit := ctx.URLParamIntDefault("limit", 20)
+	offset := ctx.URLParamIntDefault("offset", 0)
+	if limit < 1 || limit > 100 || offset < 0 {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "'limit' must be between 1 and 100 and 'offset' must not be negative"})
+		return
+	}
+
+	results, total, err := searchInDB(q, kind, lang, limit, offset)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to search: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"query":   q,
+			"results": results,
+			"total":   total,
+			"limit":   limit,
+			"offset":  offset,
+		},
+	})
+}
+
+// highlightSnippet escape HTML trong đoạn trích rồi thay ký tự đánh dấu bằng thẻ <mark>
+func highlightSnippet(s string) string {
+	s = html.EscapeString(s)
+	return strings.NewReplacer(markStart, "<mark>", markStop, "</mark>").Replace(s)
+}
+
+// searchInDB tìm trong hội thoại (chủ đề và nội dung) và từ vựng (từ, bản dịch và giải nghĩa).
+// Các từ khớp được lấy trước qua chỉ mục GIN của word và word_translation, độ liên quan và đoạn trích
+// chỉ được tính cho các từ đó; từ khớp qua bản dịch được xếp theo bản dịch khớp tốt nhất.
+func searchInDB(q, kind, lang string, limit, offset int) ([]SearchResult, int, error) {
+	rows, err := database.DB.Query(`WITH query AS (SELECT websearch_to_tsquery('vocabulary_search', $1) AS q),
+		word_hits AS (
+			SELECT w.id FROM word w CROSS JOIN query
+			WHERE $2::text IN ('', 'word') AND w.search_vector @@ query.q
+			UNION
+			SELECT t.word_id FROM word_translation t CROSS JOIN query
+			WHERE $2::text IN ('', 'word') AND t.search_vector @@ query.q
+		),
+		hits AS (
+			SELECT 'dialog' AS type, d.id, d.lang, COALESCE(NULLIF(d.topic, ''), 'Dialog ' || d.id) AS title,
+				ts_headline('vocabulary_search', d.content, query.q, $6) AS snippet,
+				ts_rank_cd(d.search_vector, query.q) AS rank
+			FROM dialog d CROSS JOIN query
+			WHERE $2::text IN ('', 'dialog') AND ($3::text = '' OR d.lang = $3::text) AND d.search_vector @@ query.q
+			UNION ALL
+			SELECT 'word', w.id, w.lang, w.content,
+				ts_headline('vocabulary_search', w.content || COALESCE(' — ' || tr.texts, ''), query.q, $6),
+				GREATEST(ts_rank_cd(w.search_vector, query.q), COALESCE(tr.rank, 0))
+			FROM word_hits h JOIN word w ON w.id = h.id CROSS JOIN query
+			LEFT JOIN LATERAL (
+				SELECT string_agg(t.text, '; ' ORDER BY t.lang, t.sense_id) AS texts,
+					MAX(ts_rank_cd(t.search_vector, query.q)) FILTER (WHERE t.search_vector @@ query.q) AS rank
+				FROM word_translation t WHERE t.word_id = w.id
+			) tr ON true
+			WHERE $3::text = '' OR w.lang = $3::text
+		)
+		SELECT type, id, lang, title, snippet, rank, COUNT(*) OVER () FROM hits
+		ORDER BY rank DESC, type, id LIMIT $4 OFFSET $5`,
+		q, kind, lang, limit, offset, searchHeadlineOptions)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	total := 0
+	for rows.Next() {
+		var r SearchResult
+		if err := rows.Scan(&r.Type, &r.ID, &r.Lang, &r.Title, &r.Snippet, &r.Rank, &total); err != nil {
+			return nil, 0, err
+		}
+		r.Snippet = highlightSnippet(r.Snippet)
+		results = append(results, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	// Trang nằm sau kết quả cuối cùng không có dòng nào để đọc tổng số
+	if len(results) == 0 && offset > 0 {
+		_, total, err = searchInDB(q, kind, lang, 1, 0)
+		return results, total, err
+	}
+	return results, total, nil
+}
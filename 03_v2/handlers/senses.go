@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"vocabulary/database"
+	"vocabulary/models"
+	"vocabulary/textnorm"
+
+	"github.com/kataras/iris/v12"
+)
+
+// Cách một từ đã lưu được gắn với nghĩa
+const (
+	senseMatched = "matched" // bản dịch khớp một nghĩa đã có
+	senseCreated = "created" // nghĩa mới: từ chưa có nghĩa nào, hoặc khác từ loại với các nghĩa đã có
+	senseReview  = "review"  // nghĩa mới vì bản dịch khác các nghĩa đã có, cần người kiểm tra
+)
+
+// sqlQuerier là phần chung của *sql.DB và *sql.Tx dùng để đọc
+type sqlQuerier interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// chooseSense tìm nghĩa của word trong các nghĩa đã có. Một nghĩa khớp khi không có bản dịch nào
+// khác (so sánh theo textnorm.Normalize) và có ít nhất một bản dịch trùng, hoặc khi nghĩa chưa có bản dịch.
+// Không có nghĩa nào như vậy thì nghĩa đầu tiên không có ngôn ngữ chung với word được dùng
+// (word chỉ bổ sung bản dịch cho ngôn ngữ mới).
+// Không khớp thì trả về 0 cùng cách tạo nghĩa mới: senseCreated nếu từ chưa có nghĩa hoặc từ loại
+// khác hẳn các nghĩa đã có, ngược lại senseReview.
+func chooseSense(senses []models.WordSense, word models.Word) (int64, string) {
+	if len(senses) == 0 {
+		return 0, senseCreated
+	}
+	if len(word.Translations) == 0 {
+		return senses[0].ID, senseMatched
+	}
+
+	var disjoint int64
+	for _, sense := range senses {
+		if len(sense.Translations) == 0 {
+			return sense.ID, senseMatched
+		}
+		same, conflict := 0, false
+		for lang, text := range word.Translations {
+			stored, ok := sense.Translations[lang]
+			if !ok {
+				continue
+			}
+			if textnorm.Normalize(stored) == textnorm.Normalize(text) {
+				same++
+			} else {
+				conflict = true
+			}
+		}
+		if same > 0 && !conflict {
+			return sense.ID, senseMatched
+		}
+		if same == 0 && !conflict && disjoint == 0 {
+			disjoint = sense.ID
+		}
+	}
+	if disjoint != 0 {
+		return disjoint, senseMatched
+	}
+
+	if word.PartOfSpeech == "" {
+		return 0, senseReview
+	}
+	for _, sense := range senses {
+		if sense.PartOfSpeech == "" || sense.PartOfSpeech == word.PartOfSpeech {
+			return 0, senseReview
+		}
+	}
+	return 0, senseCreated
+}
+
+// saveWordSense gắn word (đã lưu với id wordID) vào một nghĩa, tạo nghĩa mới nếu bản dịch khác các nghĩa đã có,
+// và lưu các bản dịch còn thiếu của nghĩa đó. Bản dịch đã có của một nghĩa không bị ghi đè.
+// Dòng word đã bị khoá bởi lệnh upsert trong cùng transaction nên hai lần lưu cùng một từ không chạy song song.
+func saveWordSense(tx *sql.Tx, wordID int64, word models.Word) (int64, string, error) {
+	senses, err := getWordSensesFromDB(tx, wordID)
+	if err != nil {
+		return 0, "", err
+	}
+
+	senseID, how := chooseSense(senses, word)
+	if senseID == 0 {
+		err := tx.QueryRow(`INSERT INTO word_sense (word_id, part_of_speech, needs_review) VALUES ($1, $2, $3) RETURNING id`,
+			wordID, word.PartOfSpeech, how == senseReview).Scan(&senseID)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	for lang, text := range word.Translations {
+		_, err := tx.Exec(`INSERT INTO word_translation (word_id, sense_id, lang, text, gloss) VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (sense_id, lang) DO UPDATE SET
+				gloss = CASE WHEN word_translation.gloss = '' THEN EXCLUDED.gloss ELSE word_translation.gloss END,
+				updated_at = NOW()`, wordID, senseID, lang, text, word.Glosses[lang])
+		if err != nil {
+			return 0, "", err
+		}
+	}
+	return senseID, how, nil
+}
+
+// WordSensesHandler trả về các nghĩa của một từ cùng bản dịch
+func WordSensesHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid word id"})
+		return
+	}
+
+	word, senses, err := getWordWithSenses(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d not found", id)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load senses: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"word": word, "senses": senses}})
+}
+
+// SensesReviewHandler liệt kê các từ có nghĩa cần kiểm tra, kèm tất cả các nghĩa của từ đó để so sánh
+func SensesReviewHandler(ctx iris.Context) {
+	rows, err := database.DB.Query("SELECT DISTINCT word_id FROM word_sense WHERE needs_review ORDER BY word_id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load senses: %v", err)})
+		return
+	}
+	var wordIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load senses: %v", err)})
+			return
+		}
+		wordIDs = append(wordIDs, id)
+	}
+	rows.Close()
+
+	words := []map[string]interface{}{}
+	for _, id := range wordIDs {
+		word, senses, err := getWordWithSenses(id)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load senses of word %d: %v", id, err)})
+			return
+		}
+		words = append(words, map[string]interface{}{"word": word, "senses": senses})
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: words})
+}
+
+// ReviewSenseHandler xử lý một nghĩa cần kiểm tra. Body {"action": "keep"} giữ nghĩa như một nghĩa riêng;
+// {"action": "merge", "into": <id>} gộp nghĩa vào một nghĩa khác của cùng từ (liên kết hội thoại và
+// bản dịch còn thiếu được chuyển sang) rồi xoá nghĩa này.
+func ReviewSenseHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid sense id"})
+		return
+	}
+
+	var request struct {
+		Action string `json:"action"`
+		Into   int64  `json:"into"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+
+	var wordID int64
+	if err := database.DB.QueryRow("SELECT word_id FROM word_sense WHERE id = $1", id).Scan(&wordID); errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Sense %d not found", id)})
+		return
+	} else if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load sense: %v", err)})
+		return
+	}
+
+	switch request.Action {
+	case "keep":
+		_, err = database.DB.Exec("UPDATE word_sense SET needs_review = FALSE WHERE id = $1", id)
+	case "merge":
+		var intoWordID int64
+		err = database.DB.QueryRow("SELECT word_id FROM word_sense WHERE id = $1", request.Into).Scan(&intoWordID)
+		if errors.Is(err, sql.ErrNoRows) || (err == nil && (intoWordID != wordID || request.Into == id)) {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("'into' must be another sense of word %d", wordID)})
+			return
+		}
+		if err == nil {
+			err = mergeSenseInDB(id, request.Into)
+		}
+	default:
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Unsupported action %q, expected keep or merge", request.Action)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to review sense: %v", err)})
+		return
+	}
+
+	word, senses, err := getWordWithSenses(wordID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load senses: %v", err)})
+		return
+	}
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"word": word, "senses": senses}})
+}
+
+// mergeSenseInDB chuyển liên kết hội thoại, thẻ trong bộ thẻ và bản dịch còn thiếu của nghĩa id sang nghĩa into rồi xoá nghĩa id
+func mergeSenseInDB(id, into int64) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE word_dialog SET sense_id = $2 WHERE sense_id = $1", id, into); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE deck_word SET sense_id = $2 WHERE sense_id = $1", id, into); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO word_translation (word_id, sense_id, lang, text, gloss, created_at)
+		SELECT word_id, $2::bigint, lang, text, gloss, created_at FROM word_translation WHERE sense_id = $1
+		ON CONFLICT (sense_id, lang) DO NOTHING`, id, into)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM word_sense WHERE id = $1", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getWordWithSenses trả về từ và các nghĩa của nó
+func getWordWithSenses(id int64) (models.Word, []models.WordSense, error) {
+	word := models.Word{ID: id}
+	err := database.DB.QueryRow("SELECT lang, content, pronunciation, part_of_speech, difficulty FROM word WHERE id = $1", id).
+		Scan(&word.Lang, &word.Content, &word.Pronunciation, &word.PartOfSpeech, &word.Difficulty)
+	if err != nil {
+		return word, nil, err
+	}
+	senses, err := getWordSensesFromDB(database.DB, id)
+	return word, senses, err
+}
+
+// getWordSensesFromDB trả về các nghĩa của từ theo thứ tự tạo
+func getWordSensesFromDB(q sqlQuerier, wordID int64) ([]models.WordSense, error) {
+	rows, err := q.Query(`SELECT s.id, s.part_of_speech, s.needs_review, t.lang, t.text, t.gloss
+		FROM word_sense s LEFT JOIN word_translation t ON t.sense_id = s.id
+		WHERE s.word_id = $1 ORDER BY s.id, t.lang`, wordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	senses := []models.WordSense{}
+	for rows.Next() {
+		s := models.WordSense{WordID: wordID}
+		var lang, text, gloss sql.NullString
+		if err := rows.Scan(&s.ID, &s.PartOfSpeech, &s.NeedsReview, &lang, &text, &gloss); err != nil {
+			return nil, err
+		}
+		if len(senses) == 0 || senses[len(senses)-1].ID != s.ID {
+			s.Translations = make(map[string]string)
+			s.Glosses = make(map[string]string)
+			senses = append(senses, s)
+		}
+		last := &senses[len(senses)-1]
+		if lang.Valid {
+			last.Translations[lang.String] = text.String
+			if gloss.String != "" {
+				last.Glosses[lang.String] = gloss.String
+			}
+		}
+	}
+	return senses, rows.Err()
+}
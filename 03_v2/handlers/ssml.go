@@ -0,0 +1,447 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"vocabulary/config"
+	"vocabulary/database"
+	"vocabulary/dialogue"
+	"vocabulary/models"
+	"vocabulary/ssml"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// DialogSSMLHandler chuyển một hội thoại đã lưu thành SSML.
+// Giọng đọc lấy từ ánh xạ đã lưu của hội thoại (hoặc giọng mặc định của nhân vật trùng tên), có thể ghi đè bằng tham số lặp lại
+// voice=<Người nói>:<Tên giọng>. Người nói chưa được ánh xạ dùng defaultVoice (hoặc giọng
+// mặc định trong cấu hình) và được liệt kê trong unmappedSpeakers; với strict=true sẽ trả lỗi.
+// Cú pháp đánh dấu trong câu thoại được biên dịch, ký hiệu không khớp giữ nguyên như văn bản (tắt bằng markup=false); learner=true
+// làm chậm mọi câu theo tham số rate hoặc SSML_LEARNER_RATE; marks=true chèn <mark> trước mỗi từ.
+// Tài liệu tham chiếu lexicon phát âm chung qua <lexicon> (tắt bằng lexicon=false).
+func DialogSSMLHandler(ctx iris.Context) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	parsed, err := parseDialog(dialog)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog turns: %v", err)})
+		return
+	}
+	voices, err := resolveDialogVoices(dialog.ID, dialogue.Speakers(parsed.Turns))
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load voice mapping: %v", err)})
+		return
+	}
+	for _, mapping := range ctx.URLParamSlice("voice") {
+		speaker, voice, ok := strings.Cut(mapping, ":")
+		if !ok || strings.TrimSpace(speaker) == "" || strings.TrimSpace(voice) == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid voice mapping %q, expected <speaker>:<voice>", mapping)})
+			return
+		}
+		voices[strings.TrimSpace(speaker)] = strings.TrimSpace(voice)
+	}
+
+	unmapped := unmappedSpeakers(dialogue.Speakers(parsed.Turns), voices)
+	if ctx.URLParamBoolDefault("strict", false) && (len(unmapped) > 0 || len(parsed.Unmatched) > 0) {
+		ctx.StatusCode(iris.StatusUnprocessableEntity)
+		ctx.JSON(APIResponse{
+			Status: "error",
+			Data: map[string]interface{}{
+				"unmappedSpeakers": unmapped,
+				"unmatchedLines":   parsed.Unmatched,
+			},
+			Error: "Dialog has unmapped speakers or lines without a speaker",
+		})
+		return
+	}
+
+	// Dòng không có người nói vẫn được đọc bằng giọng mặc định thay vì bị bỏ qua
+	var turns []ssml.Turn
+	unmatched := parsed.Unmatched
+	for i, turn := range parsed.Turns {
+		for len(unmatched) > 0 && unmatched[0].Line < turn.Line {
+			turns = append(turns, ssml.Turn{ID: fmt.Sprintf("n%d", unmatched[0].Line), Line: unmatched[0].Line, Text: unmatched[0].Text})
+			unmatched = unmatched[1:]
+		}
+		turns = append(turns, ssml.Turn{ID: fmt.Sprint(i + 1), Line: turn.Line, Speaker: turn.Speaker, Text: turn.Text})
+	}
+	for _, line := range unmatched {
+		turns = append(turns, ssml.Turn{ID: fmt.Sprintf("n%d", line.Line), Line: line.Line, Text: line.Text})
+	}
+
+	lang := ctx.URLParamDefault("lang", dialog.Lang)
+	doc := ssml.Document{
+		Lang:         lang,
+		Voices:       voices,
+		DefaultVoice: ctx.URLParamDefault("defaultVoice", cfg.DefaultVoice),
+		Markup:       ctx.URLParamBoolDefault("markup", true),
+		Rate:         ctx.URLParam("rate"),
+		Marks:        ctx.URLParamBoolDefault("marks", false),
+		Turns:        turns,
+	}
+	if ctx.URLParamBoolDefault("lexicon", true) {
+		doc.Lexicons = []string{lexiconURI(cfg.PublicURL, lang)}
+	}
+	if doc.Rate == "" && ctx.URLParamBoolDefault("learner", false) {
+		doc.Rate = cfg.LearnerRate
+	}
+
+	out, err := ssml.Build(doc)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to build SSML: %v", err)})
+		return
+	}
+
+	catalog, err := getVoiceNamesFromDB()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load voice catalog: %v", err)})
+		return
+	}
+	if issues := ssml.Validate(out, ssml.ValidateOptions{Voices: catalog}); ssml.HasErrors(issues) {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{
+			Status: "error",
+			Data:   map[string]interface{}{"issues": issues},
+			Error:  "Generated SSML failed validation",
+		})
+		return
+	}
+
+	if ctx.URLParam("format") == "xml" {
+		if len(unmapped) > 0 {
+			ctx.Header("X-Unmapped-Speakers", strings.Join(unmapped, ","))
+		}
+		ctx.ContentType("application/ssml+xml")
+		ctx.WriteString(out)
+		return
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"dialogID":         dialog.ID,
+			"ssml":             out,
+			"unmappedSpeakers": unmapped,
+			"unmatchedLines":   parsed.Unmatched,
+		},
+	})
+}
+
+// ValidateSSMLHandler kiểm tra một tài liệu SSML trước khi gửi đến TTS.
+// Body có thể là SSML thô hoặc JSON dạng {"ssml": "..."}.
+func ValidateSSMLHandler(ctx iris.Context) {
+	catalog, err := getVoiceNamesFromDB()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load voice catalog: %v", err)})
+		return
+	}
+
+	var doc string
+	if strings.HasPrefix(ctx.GetContentTypeRequested(), "application/json") {
+		var request struct {
+			SSML string `json:"ssml"`
+		}
+		if err := ctx.ReadJSON(&request); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+			return
+		}
+		doc = request.SSML
+	} else {
+		body, err := ctx.GetBody()
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to read body: %v", err)})
+			return
+		}
+		doc = string(body)
+	}
+
+	if strings.TrimSpace(doc) == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "No SSML provided"})
+		return
+	}
+
+	issues := ssml.Validate(doc, ssml.ValidateOptions{Voices: catalog})
+	if issues == nil {
+		issues = []ssml.Issue{}
+	}
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"valid":  !ssml.HasErrors(issues),
+			"issues": issues,
+		},
+	})
+}
+
+// CompileMarkupHandler biên dịch một câu thoại có đánh dấu ([pause 500ms], *nhấn mạnh*,
+// {slow: ...}) thành đoạn SSML để xem trước.
+func CompileMarkupHandler(ctx iris.Context) {
+	var request struct {
+		Text string `json:"text"`
+		Rate string `json:"rate"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	if strings.TrimSpace(request.Text) == "" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "No text provided"})
+		return
+	}
+
+	fragment, err := ssml.CompileMarkup(request.Text)
+	var markupErr *ssml.MarkupError
+	if errors.As(err, &markupErr) {
+		ctx.StatusCode(iris.StatusUnprocessableEntity)
+		ctx.JSON(APIResponse{
+			Status: "error",
+			Data:   map[string]interface{}{"column": markupErr.Column},
+			Error:  markupErr.Msg,
+		})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to compile markup: %v", err)})
+		return
+	}
+
+	if request.Rate != "" {
+		if err := ssml.CheckRate(request.Rate); err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid rate: %v", err)})
+			return
+		}
+		fragment = fmt.Sprintf(`<prosody rate="%s">%s</prosody>`, ssml.Escape(request.Rate), fragment)
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"ssml": fragment,
+		},
+	})
+}
+
+// DialogVoicesHandler trả về danh sách người nói trong hội thoại, ánh xạ giọng đọc đã lưu
+// và giọng mặc định của các nhân vật trùng tên người nói
+func DialogVoicesHandler(ctx iris.Context) {
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	voices, err := getDialogVoicesFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load voice mapping: %v", err)})
+		return
+	}
+
+	parsed, err := parseDialog(dialog)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog turns: %v", err)})
+		return
+	}
+	speakers := dialogue.Speakers(parsed.Turns)
+	characterVoices, err := getCharacterVoices(speakers)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load character voices: %v", err)})
+		return
+	}
+	resolved := make(map[string]string)
+	for speaker, voice := range characterVoices {
+		resolved[speaker] = voice
+	}
+	for speaker, voice := range voices {
+		resolved[speaker] = voice
+	}
+
+	ctx.JSON(APIResponse{
+		Status: "success",
+		Data: map[string]interface{}{
+			"dialogID":         dialog.ID,
+			"speakers":         speakers,
+			"voices":           voices,
+			"characterVoices":  characterVoices,
+			"unmappedSpeakers": unmappedSpeakers(speakers, resolved),
+			"unmatchedLines":   parsed.Unmatched,
+		},
+	})
+}
+
+// UpdateDialogVoicesHandler lưu ánh xạ người nói -> giọng đọc cho một hội thoại.
+// Body dạng {"voices": {"James": "en-US-AndrewMultilingualNeural"}}; giọng rỗng sẽ xoá ánh xạ.
+func UpdateDialogVoicesHandler(ctx iris.Context) {
+	names, err := getVoiceNamesFromDB()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load voice catalog: %v", err)})
+		return
+	}
+
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	var request struct {
+		Voices map[string]string `json:"voices"`
+	}
+	if err := ctx.ReadJSON(&request); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return
+	}
+	if len(request.Voices) == 0 {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "No voices provided"})
+		return
+	}
+
+	parsed, err := parseDialog(dialog)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog turns: %v", err)})
+		return
+	}
+	speakers := make(map[string]bool)
+	for _, speaker := range dialogue.Speakers(parsed.Turns) {
+		speakers[speaker] = true
+	}
+	catalog := make(map[string]bool)
+	for _, voice := range names {
+		catalog[voice] = true
+	}
+	for speaker, voice := range request.Voices {
+		if !speakers[speaker] {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Speaker %q does not appear in dialog %d", speaker, dialog.ID)})
+			return
+		}
+		if voice != "" && len(catalog) > 0 && !catalog[voice] {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Voice %q is not in the voice catalog", voice)})
+			return
+		}
+	}
+
+	if err := saveDialogVoicesToDB(dialog.ID, request.Voices); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save voice mapping: %v", err)})
+		return
+	}
+
+	DialogVoicesHandler(ctx)
+}
+
+// unmappedSpeakers trả về những người nói chưa có giọng đọc
+func unmappedSpeakers(speakers []string, voices map[string]string) []string {
+	unmapped := []string{}
+	for _, speaker := range speakers {
+		if voices[speaker] == "" {
+			unmapped = append(unmapped, speaker)
+		}
+	}
+	return unmapped
+}
+
+// loadDialog đọc hội thoại theo tham số {id} của route, tự trả lỗi nếu không tìm thấy
+func loadDialog(ctx iris.Context) (models.Dialog, bool) {
+	dialogID, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid dialog id"})
+		return models.Dialog{}, false
+	}
+
+	dialog, err := getDialogFromDB(dialogID)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Dialog %d not found", dialogID)})
+		return models.Dialog{}, false
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog: %v", err)})
+		return models.Dialog{}, false
+	}
+	return dialog, true
+}
+
+func getDialogFromDB(id int64) (models.Dialog, error) {
+	dialog := models.Dialog{ID: id}
+	var createdBy sql.NullInt64
+	err := database.DB.QueryRow(`SELECT lang, content, raw, topic, setting, characters, turns, level, register, created_by,
+		created_at, updated_at FROM dialog WHERE id = $1`, id).
+		Scan(&dialog.Lang, &dialog.Content, &dialog.Raw, &dialog.Topic, &dialog.Setting, pq.Array(&dialog.Characters), &dialog.Turns,
+			&dialog.Level, &dialog.Register, &createdBy, &dialog.CreatedAt, &dialog.UpdatedAt)
+	dialog.CreatedBy = createdBy.Int64
+	return dialog, err
+}
+
+func getDialogVoicesFromDB(dialogID int64) (map[string]string, error) {
+	rows, err := database.DB.Query("SELECT speaker, voice FROM dialog_voice WHERE dialog_id = $1", dialogID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	voices := make(map[string]string)
+	for rows.Next() {
+		var v models.DialogVoice
+		if err := rows.Scan(&v.Speaker, &v.Voice); err != nil {
+			return nil, err
+		}
+		voices[v.Speaker] = v.Voice
+	}
+	return voices, rows.Err()
+}
+
+func saveDialogVoicesToDB(dialogID int64, voices map[string]string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for speaker, voice := range voices {
+		if voice == "" {
+			_, err = tx.Exec("DELETE FROM dialog_voice WHERE dialog_id = $1 AND speaker = $2", dialogID, speaker)
+		} else {
+			_, err = tx.Exec(`INSERT INTO dialog_voice (dialog_id, speaker, voice) VALUES ($1, $2, $3)
+				ON CONFLICT (dialog_id, speaker) DO UPDATE SET voice = EXCLUDED.voice`, dialogID, speaker, voice)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
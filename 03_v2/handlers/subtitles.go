@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"vocabulary/config"
+	"vocabulary/database"
+	"vocabulary/langtag"
+	"vocabulary/ssml"
+	"vocabulary/subtitle"
+
+	"github.com/kataras/iris/v12"
+)
+
+// DialogSubtitlesHandler xuất phụ đề SRT hoặc WebVTT cho một hội thoại, mỗi lượt nói một cue.
+// Thời lượng lấy từ âm thanh đã tổng hợp nếu có, nếu không thì ước tính theo thời gian đọc.
+// track=translation trả về track thứ hai chứa bản dịch của từng lượt nói sang ngôn ngữ lang (mặc định en).
+func DialogSubtitlesHandler(ctx iris.Context) {
+	cfg, err := config.LoadConfig()
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load config: %v", err)})
+		return
+	}
+
+	format := ctx.URLParamDefault("format", "vtt")
+	if format != "srt" && format != "vtt" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Unsupported format %q, expected srt or vtt", format)})
+		return
+	}
+	track := ctx.URLParamDefault("track", "dialog")
+	if track != "dialog" && track != "translation" {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Unsupported track %q, expected dialog or translation", track)})
+		return
+	}
+
+	translationLang, err := langtag.NormalizeDefault(ctx.URLParam("lang"), langtag.DefaultTarget)
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+		return
+	}
+
+	dialog, ok := loadDialog(ctx)
+	if !ok {
+		return
+	}
+
+	parsed, err := parseDialog(dialog)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load dialog turns: %v", err)})
+		return
+	}
+	if len(parsed.Turns) == 0 {
+		ctx.StatusCode(iris.StatusUnprocessableEntity)
+		ctx.JSON(APIResponse{Status: "error", Error: "Dialog has no lines with a speaker"})
+		return
+	}
+
+	audio, err := getDialogAudioFromDB(dialog.ID)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load audio status: %v", err)})
+		return
+	}
+	durations := make(map[int]time.Duration)
+	for _, line := range audio {
+		if line.Status == audioReady && line.DurationMs > 0 {
+			durations[line.Ordinal] = time.Duration(line.DurationMs) * time.Millisecond
+		}
+	}
+
+	texts := make([]string, len(parsed.Turns))
+	for i, turn := range parsed.Turns {
+		text, err := ssml.StripMarkup(turn.Text)
+		if err != nil {
+			text = turn.Text
+		}
+		texts[i] = text
+	}
+
+	var translations map[int]string
+	if track == "translation" {
+		translations, err = getDialogLineTranslations(cfg.GroqAPIKey, dialog.ID, texts, translationLang)
+		if err != nil {
+			ctx.StatusCode(iris.StatusInternalServerError)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to translate dialog lines: %v", err)})
+			return
+		}
+	}
+
+	var cues []subtitle.Cue
+	var offset time.Duration
+	for i, turn := range parsed.Turns {
+		ordinal := i + 1
+		d, ok := durations[ordinal]
+		if !ok {
+			d = subtitle.ReadingTime(texts[i])
+		}
+		text := texts[i]
+		// Câu chưa có bản dịch giữ nguyên câu gốc để không sinh cue rỗng
+		if track == "translation" && translations[ordinal] != "" {
+			text = translations[ordinal]
+		}
+		cues = append(cues, subtitle.Cue{Start: offset, End: offset + d, Speaker: turn.Speaker, Text: text})
+		offset += d
+	}
+
+	var buf bytes.Buffer
+	contentType := "text/vtt; charset=utf-8"
+	if format == "srt" {
+		contentType = "application/x-subrip; charset=utf-8"
+		err = subtitle.WriteSRT(&buf, cues)
+	} else {
+		err = subtitle.WriteVTT(&buf, cues)
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to write subtitles: %v", err)})
+		return
+	}
+
+	filename := fmt.Sprintf("dialog-%d.%s", dialog.ID, format)
+	if track == "translation" {
+		filename = fmt.Sprintf("dialog-%d.%s.%s", dialog.ID, translationLang, format)
+	}
+	ctx.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	ctx.ContentType(contentType)
+	ctx.Write(buf.Bytes())
+}
+
+// getDialogLineTranslations trả về bản dịch của từng câu thoại (theo số thứ tự),
+// gọi Groq API để dịch và lưu lại nếu chưa có bản dịch đầy đủ
+func getDialogLineTranslations(apiKey string, dialogID int64, texts []string, lang string) (map[int]string, error) {
+	stored, err := getDialogLineTranslationsFromDB(dialogID, lang)
+	if err != nil {
+		return nil, err
+	}
+	complete := true
+	for i := range texts {
+		if stored[i+1] == "" {
+			complete = false
+			break
+		}
+	}
+	if complete {
+		return stored, nil
+	}
+
+	type line struct {
+		Ordinal int    `json:"ordinal"`
+		Text    string `json:"text"`
+	}
+	var lines []line
+	for i, text := range texts {
+		lines = append(lines, line{Ordinal: i + 1, Text: text})
+	}
+	linesJSON, err := json.Marshal(lines)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal dialog lines: %w", err)
+	}
+
+	translatePrompt := fmt.Sprintf(`Dịch từng câu thoại trong danh sách dưới sang %s, giữ nguyên số thứ tự, trả về JSON với cấu trúc {"translations": [{"ordinal": 1, "text": "translation"}, ...]}.
+%s`, langtag.Name(lang), linesJSON)
+	translatedRaw, err := callGroqAPI(apiKey, translatePrompt, map[string]string{"type": "json_object"})
+	if err != nil {
+		return nil, err
+	}
+
+	var translatedData struct {
+		Translations []line `json:"translations"`
+	}
+	if err := json.Unmarshal([]byte(translatedRaw), &translatedData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal translated JSON: %v (raw data: %s)", err, translatedRaw)
+	}
+
+	translations := make(map[int]string)
+	for _, t := range translatedData.Translations {
+		if t.Ordinal >= 1 && t.Ordinal <= len(texts) && strings.TrimSpace(t.Text) != "" {
+			translations[t.Ordinal] = strings.TrimSpace(t.Text)
+		}
+	}
+	if err := saveDialogLineTranslationsToDB(dialogID, lang, translations); err != nil {
+		return nil, err
+	}
+	return translations, nil
+}
+
+func getDialogLineTranslationsFromDB(dialogID int64, lang string) (map[int]string, error) {
+	rows, err := database.DB.Query("SELECT ordinal, text FROM dialog_line_translation WHERE dialog_id = $1 AND lang = $2", dialogID, lang)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	translations := make(map[int]string)
+	for rows.Next() {
+		var ordinal int
+		var text string
+		if err := rows.Scan(&ordinal, &text); err != nil {
+			return nil, err
+		}
+		translations[ordinal] = text
+	}
+	return translations, rows.Err()
+}
+
+func saveDialogLineTranslationsToDB(dialogID int64, lang string, translations map[int]string) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for ordinal, text := range translations {
+		_, err := tx.Exec(`INSERT INTO dialog_line_translation (dialog_id, ordinal, lang, text) VALUES ($1, $2, $3, $4)
+			ON CONFLICT (dialog_id, ordinal, lang) DO UPDATE SET text = EXCLUDED.text`, dialogID, ordinal, lang, text)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"vocabulary/langtag"
+	"vocabulary/models"
+)
+
+// maxTranslationTargets giới hạn số ngôn ngữ đích trong một lần dịch
+const maxTranslationTargets = 5
+
+// translationLangs chuẩn hoá ngôn ngữ nguồn và danh sách ngôn ngữ đích (bỏ trùng, bỏ trùng với nguồn)
+func translationLangs(source string, targets []string) (string, []string, error) {
+	source, err := langtag.NormalizeDefault(source, langtag.DefaultSource)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var normalized []string
+	seen := map[string]bool{source: true}
+	for _, target := range targets {
+		if strings.TrimSpace(target) == "" {
+			continue
+		}
+		tag, err := langtag.Normalize(target)
+		if err != nil {
+			return "", nil, err
+		}
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+	if len(normalized) == 0 && source != langtag.DefaultTarget {
+		normalized = []string{langtag.DefaultTarget}
+	}
+	if len(normalized) == 0 {
+		return "", nil, fmt.Errorf("no target language different from source %q", source)
+	}
+	if len(normalized) > maxTranslationTargets {
+		return "", nil, fmt.Errorf("at most %d target languages are allowed", maxTranslationTargets)
+	}
+	return source, normalized, nil
+}
+
+// translateWords dịch các từ qua Groq API, mỗi kết quả là một object theo mã ngôn ngữ
+// kèm giải nghĩa ngắn theo từng ngôn ngữ đích và thông tin từ bước lọc từ
+func translateWords(apiKey string, words []wordDetails, source string, targets []string) ([]map[string]string, error) {
+	items := make([]map[string]string, len(words))
+	for i, word := range words {
+		items[i] = map[string]string{source: word.Word}
+		if word.PartOfSpeech != "" {
+			items[i][metaPartOfSpeech] = word.PartOfSpeech
+		}
+	}
+	itemsJSON, err := json.Marshal(items)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal words: %w", err)
+	}
+
+	example := map[string]string{source: "word"}
+	var names []string
+	for _, target := range targets {
+		example[target] = "translation"
+		example[glossKey(target)] = "short explanation"
+		names = append(names, fmt.Sprintf("%s (%q)", langtag.Name(target), target))
+	}
+	exampleJSON, err := json.Marshal(example)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal example: %w", err)
+	}
+
+	translatePrompt := fmt.Sprintf(`Dịch từng từ hoặc cụm từ %s trong danh sách dưới sang %s, trả về JSON với cấu trúc {"translated_words": [%s, ...]}.
+Khoá "gloss:<mã ngôn ngữ>" là giải nghĩa ngắn (không quá một câu) bằng ngôn ngữ đó; bỏ trống nếu không cần. "pos" là từ loại, chỉ dùng để hiểu đúng nghĩa.
+%s`, langtag.Name(source), strings.Join(names, ", "), exampleJSON, itemsJSON)
+	translatedRaw, err := callGroqAPI(apiKey, translatePrompt, map[string]string{"type": "json_object"})
+	if err != nil {
+		return nil, err
+	}
+
+	var translatedData struct {
+		TranslatedWords []map[string]string `json:"translated_words"`
+	}
+	if err := json.Unmarshal([]byte(translatedRaw), &translatedData); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal translated JSON: %v (raw data: %s)", err, translatedRaw)
+	}
+	mergeWordDetails(translatedData.TranslatedWords, words, source)
+	return translatedData.TranslatedWords, nil
+}
+
+// wordFromTranslation tạo từ vựng từ một object theo mã ngôn ngữ; khoá source là chính từ đó,
+// các khoá thông tin thêm (pos, example, pronunciation, difficulty, gloss:<mã>) được kiểm tra lại
+func wordFromTranslation(translated map[string]string, source string) (models.Word, error) {
+	word := models.Word{Lang: source, Translations: make(map[string]string), Glosses: make(map[string]string)}
+	details := wordDetails{
+		PartOfSpeech:  translated[metaPartOfSpeech],
+		Example:       translated[metaExample],
+		Pronunciation: translated[metaPronunciation],
+		Difficulty:    translated[metaDifficulty],
+	}.clean("")
+	word.PartOfSpeech = details.PartOfSpeech
+	word.Example = details.Example
+	word.Pronunciation = details.Pronunciation
+	word.Difficulty = details.Difficulty
+
+	for key, text := range translated {
+		text = strings.TrimSpace(text)
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(key, metaGlossPrefix) {
+			tag, err := langtag.Normalize(strings.TrimPrefix(key, metaGlossPrefix))
+			if err != nil {
+				return word, err
+			}
+			if gloss := cleanMeta(text, maxGlossLen); gloss != "" && tag != source {
+				word.Glosses[tag] = gloss
+			}
+			continue
+		}
+		if isMetaKey(key) {
+			continue
+		}
+		tag, err := langtag.Normalize(key)
+		if err != nil {
+			return word, err
+		}
+		if tag == source {
+			word.Content = text
+		} else {
+			word.Translations[tag] = text
+		}
+	}
+	if word.Content == "" {
+		return word, fmt.Errorf("missing %q text", source)
+	}
+	return word, nil
+}
@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"fmt"
+	"time"
+
+	"vocabulary/database"
+	"vocabulary/models"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// vocabularyWord là một từ trong từ vựng của người dùng
+type vocabularyWord struct {
+	models.Word
+	AddedAt time.Time `json:"addedAt"`
+}
+
+// MyWordsHandler trả về từ vựng của người dùng đang đăng nhập, từ thêm gần nhất trước, kèm bản dịch
+// của nghĩa đầu tiên. 'limit' mặc định 50 (tối đa 500), 'offset' để phân trang.
+func MyWordsHandler(ctx iris.Context) {
+	limit := ctx.URLParamIntDefault("limit", 50)
+	offset := ctx.URLParamIntDefault("offset", 0)
+	if limit < 1 || limit > 500 || offset < 0 {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "'limit' must be between 1 and 500 and 'offset' must not be negative"})
+		return
+	}
+
+	words, total, err := getUserWordsFromDB(currentUserID(ctx), limit, offset)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load vocabulary: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"words": words, "total": total}})
+}
+
+// RemoveMyWordHandler bỏ một từ khỏi từ vựng của người dùng cùng thẻ ôn tập của từ đó.
+// Từ vẫn được giữ trong bảng word vì có thể thuộc hội thoại hoặc từ vựng của người khác.
+func RemoveMyWordHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid word id"})
+		return
+	}
+
+	removed, err := removeUserWordFromDB(currentUserID(ctx), id)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to remove word: %v", err)})
+		return
+	}
+	if !removed {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d is not in your vocabulary", id)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success"})
+}
+
+func getUserWordsFromDB(userID int64, limit, offset int) ([]vocabularyWord, int, error) {
+	var total int
+	if err := database.DB.QueryRow("SELECT COUNT(*) FROM user_word WHERE user_id = $1", userID).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := database.DB.Query(`SELECT w.id, w.lang, w.content, w.pronunciation, w.part_of_speech, w.difficulty, uw.added_at
+		FROM user_word uw JOIN word w ON w.id = uw.word_id
+		WHERE uw.user_id = $1 ORDER BY uw.added_at DESC, w.id DESC LIMIT $2 OFFSET $3`, userID, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	words := []vocabularyWord{}
+	index := make(map[int64]int)
+	var ids []int64
+	for rows.Next() {
+		var w vocabularyWord
+		if err := rows.Scan(&w.ID, &w.Lang, &w.Content, &w.Pronunciation, &w.PartOfSpeech, &w.Difficulty, &w.AddedAt); err != nil {
+			return nil, 0, err
+		}
+		w.Translations = make(map[string]string)
+		index[w.ID] = len(words)
+		ids = append(ids, w.ID)
+		words = append(words, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	if len(ids) == 0 {
+		return words, total, nil
+	}
+
+	// Bản dịch của nghĩa đầu tiên (id nhỏ nhất) theo từng ngôn ngữ
+	rows, err = database.DB.Query(`SELECT DISTINCT ON (word_id, lang) word_id, lang, text FROM word_translation
+		WHERE word_id = ANY($1) ORDER BY word_id, lang, sense_id`, pq.Array(ids))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var wordID int64
+		var lang, text string
+		if err := rows.Scan(&wordID, &lang, &text); err != nil {
+			return nil, 0, err
+		}
+		words[index[wordID]].Translations[lang] = text
+	}
+	return words, total, rows.Err()
+}
+
+func removeUserWordFromDB(userID, wordID int64) (bool, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM user_word WHERE user_id = $1 AND word_id = $2", userID, wordID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	// Lịch sử ôn (review_log) được giữ lại
+	if _, err := tx.Exec("DELETE FROM review_card WHERE learner = $1 AND word_id = $2", learnerID(userID), wordID); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
@@ -0,0 +1,614 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"vocabulary/database"
+	"vocabulary/langtag"
+	"vocabulary/models"
+	"vocabulary/textnorm"
+
+	"github.com/kataras/iris/v12"
+	"github.com/lib/pq"
+)
+
+// Độ dài tối đa (ký tự) của từ và bản dịch nhập tay
+const (
+	maxWordLen        = 100
+	maxTranslationLen = 200
+)
+
+// wordSortColumns là các cách sắp xếp của GET /words
+var wordSortColumns = map[string]sortColumn{
+	"id":        {Expr: "w.id"},
+	"createdAt": {Expr: "w.created_at", Cast: "timestamptz"},
+	"updatedAt": {Expr: "w.updated_at", Cast: "timestamptz"},
+	"content":   {Expr: "w.content", Cast: "text"},
+}
+
+// wordItem là một từ trong danh sách, kèm bản dịch của nghĩa đầu tiên
+type wordItem struct {
+	models.Word
+	CreatedBy int64     `json:"createdBy"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// wordInput là body của POST /words và PUT /words/{id}. Khi sửa, translations và glosses ghi đè
+// bản dịch của nghĩa senseID (mặc định nghĩa đầu tiên); bản dịch rỗng xoá bản dịch của ngôn ngữ đó.
+type wordInput struct {
+	Lang          string            `json:"lang"`
+	Content       string            `json:"content"`
+	Pronunciation string            `json:"pronunciation"`
+	PartOfSpeech  string            `json:"pos"`
+	Difficulty    string            `json:"difficulty"`
+	SenseID       int64             `json:"senseID"`
+	Translations  map[string]string `json:"translations"`
+	Glosses       map[string]string `json:"glosses"`
+}
+
+// AuthWhenParam chỉ chạy middleware auth khi request có tham số query param,
+// dùng cho GET /words: lọc từ khỏi hội thoại gọi Groq nên cần đăng nhập, liệt kê từ thì không
+func AuthWhenParam(param string, auth iris.Handler) iris.Handler {
+	return func(ctx iris.Context) {
+		if ctx.URLParamExists(param) {
+			auth(ctx)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// AuthWhenParamIs chỉ chạy middleware auth khi tham số query param bằng value, dùng cho
+// GET /dialogs/{id}/subtitles: track=translation có thể gọi Groq và ghi bản dịch câu vào DB
+func AuthWhenParamIs(param, value string, auth iris.Handler) iris.Handler {
+	return func(ctx iris.Context) {
+		if ctx.URLParam(param) == value {
+			auth(ctx)
+			return
+		}
+		ctx.Next()
+	}
+}
+
+// WordsHandler lọc từ khỏi hội thoại khi có tham số dialog (ExtractWordsHandler),
+// ngược lại liệt kê các từ đã lưu (ListWordsHandler)
+func WordsHandler(ctx iris.Context) {
+	if ctx.URLParamExists("dialog") {
+		ExtractWordsHandler(ctx)
+		return
+	}
+	ListWordsHandler(ctx)
+}
+
+// ListWordsHandler liệt kê từ đã lưu, phân trang bằng cursor (nextCursor của trang trước).
+// Lọc theo lang, q (chứa chuỗi, so sánh sau khi chuẩn hoá), pos, difficulty, createdBy và
+// from/to (ngày tạo); sort là id, createdAt (mặc định -createdAt), updatedAt hoặc content.
+func ListWordsHandler(ctx iris.Context) {
+	page, ok := readPageParams(ctx, wordSortColumns, "-createdAt")
+	if !ok {
+		return
+	}
+
+	var where sqlWhere
+	if raw := ctx.URLParam("lang"); raw != "" {
+		lang, err := langtag.Normalize(raw)
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: err.Error()})
+			return
+		}
+		where.add("w.lang = %s", lang)
+	}
+	if q := textnorm.Normalize(ctx.URLParam("q")); q != "" {
+		where.add("w.norm_key LIKE %s", likePattern(q))
+	}
+	if raw := ctx.URLParam("pos"); raw != "" {
+		pos := cleanPartOfSpeech(raw)
+		if pos == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid 'pos' %q", raw)})
+			return
+		}
+		where.add("w.part_of_speech = %s", pos)
+	}
+	if raw := ctx.URLParam("difficulty"); raw != "" {
+		level := cleanDifficulty(raw)
+		if level == "" {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid 'difficulty' %q, expected A1–C2", raw)})
+			return
+		}
+		where.add("w.difficulty = %s", level)
+	}
+	if ctx.URLParamExists("createdBy") {
+		createdBy, err := ctx.URLParamInt64("createdBy")
+		if err != nil {
+			ctx.StatusCode(iris.StatusBadRequest)
+			ctx.JSON(APIResponse{Status: "error", Error: "Invalid 'createdBy'"})
+			return
+		}
+		where.add("w.created_by = %s", createdBy)
+	}
+	if !readDateRange(ctx, &where, "w.created_at") {
+		return
+	}
+	page.keyset(&where, "w.id")
+
+	words, err := getWordItemsFromDB(&where, page)
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load words: %v", err)})
+		return
+	}
+
+	next := ""
+	if len(words) > page.Limit {
+		words = words[:page.Limit]
+		last := words[len(words)-1]
+		next = page.nextCursor(wordCursorValue(page.Sort, last), last.ID)
+	}
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"words": words, "nextCursor": next}})
+}
+
+// GetWordHandler trả về một từ cùng các nghĩa và id của các hội thoại có từ đó
+func GetWordHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid word id"})
+		return
+	}
+	respondWord(ctx, id)
+}
+
+// CreateWordHandler thêm một từ nhập tay cùng bản dịch; từ đã có (cùng khoá chuẩn hoá) trả về 409
+func CreateWordHandler(ctx iris.Context) {
+	word, ok := readWordInput(ctx)
+	if !ok {
+		return
+	}
+
+	id, err := createWordInDB(currentUserID(ctx), word)
+	if isUniqueViolation(err) {
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %q already exists in %s", word.Content, word.Lang)})
+		return
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to save word: %v", err)})
+		return
+	}
+
+	ctx.StatusCode(iris.StatusCreated)
+	respondWord(ctx, id)
+}
+
+// UpdateWordHandler sửa từ và bản dịch của một nghĩa, ví dụ để sửa bản dịch sai.
+// Từ dùng chung giữa các hội thoại nên chỉ người tạo được sửa, giống khi xoá.
+func UpdateWordHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid word id"})
+		return
+	}
+	word, ok := readWordInput(ctx)
+	if !ok {
+		return
+	}
+	word.ID = id
+	if !checkWordOwner(ctx, id) {
+		return
+	}
+
+	err = updateWordInDB(word)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d not found", id)})
+		return
+	case errors.Is(err, errUnknownSense):
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Sense %d is not a sense of word %d", word.SenseID, id)})
+		return
+	case isUniqueViolation(err):
+		ctx.StatusCode(iris.StatusConflict)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %q already exists in %s", word.Content, word.Lang)})
+		return
+	case err != nil:
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to update word: %v", err)})
+		return
+	}
+
+	respondWord(ctx, id)
+}
+
+// DeleteWordHandler xoá một từ khỏi mọi hội thoại, từ vựng và bộ thẻ. Chỉ người tạo được xoá;
+// từ không rõ người tạo thì người dùng đã đăng nhập nào cũng xoá được.
+func DeleteWordHandler(ctx iris.Context) {
+	id, err := ctx.Params().GetInt64("id")
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: "Invalid word id"})
+		return
+	}
+
+	if !checkWordOwner(ctx, id) {
+		return
+	}
+
+	if _, err := database.DB.Exec("DELETE FROM word WHERE id = $1", id); err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to delete word: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"id": id}})
+}
+
+// checkWordOwner trả 404 nếu không có từ id và 403 nếu từ thuộc người dùng khác;
+// từ không rõ người tạo thì người dùng đã đăng nhập nào cũng được sửa và xoá
+func checkWordOwner(ctx iris.Context, id int64) bool {
+	var createdBy sql.NullInt64
+	err := database.DB.QueryRow("SELECT created_by FROM word WHERE id = $1", id).Scan(&createdBy)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d not found", id)})
+		return false
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load word: %v", err)})
+		return false
+	}
+	if createdBy.Valid && createdBy.Int64 != currentUserID(ctx) {
+		ctx.StatusCode(iris.StatusForbidden)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d belongs to another user", id)})
+		return false
+	}
+	return true
+}
+
+// errUnknownSense được trả về khi senseID không thuộc từ đang sửa
+var errUnknownSense = errors.New("unknown sense")
+
+// readWordInput đọc và kiểm tra body của từ, tự trả 400 nếu không hợp lệ
+func readWordInput(ctx iris.Context) (models.Word, bool) {
+	var input wordInput
+	if err := ctx.ReadJSON(&input); err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid JSON body: %v", err)})
+		return models.Word{}, false
+	}
+
+	word, err := input.word()
+	if err != nil {
+		ctx.StatusCode(iris.StatusBadRequest)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Invalid word: %v", err)})
+		return word, false
+	}
+	return word, true
+}
+
+// word chuẩn hoá và kiểm tra các trường. Bản dịch rỗng được giữ lại (nghĩa là xoá khi sửa).
+func (in wordInput) word() (models.Word, error) {
+	lang, err := langtag.NormalizeDefault(in.Lang, langtag.DefaultSource)
+	if err != nil {
+		return models.Word{}, err
+	}
+	word := models.Word{
+		Lang:          lang,
+		Content:       textnorm.Clean(in.Content),
+		SenseID:       in.SenseID,
+		Pronunciation: textnorm.Clean(in.Pronunciation),
+		PartOfSpeech:  cleanPartOfSpeech(in.PartOfSpeech),
+		Difficulty:    cleanDifficulty(in.Difficulty),
+		Translations:  make(map[string]string),
+		Glosses:       make(map[string]string),
+	}
+
+	switch {
+	case textnorm.Normalize(word.Content) == "":
+		return word, fmt.Errorf("missing 'content'")
+	case utf8.RuneCountInString(word.Content) > maxWordLen:
+		return word, fmt.Errorf("'content' must be at most %d characters", maxWordLen)
+	case utf8.RuneCountInString(word.Pronunciation) > maxPronunciationLen:
+		return word, fmt.Errorf("'pronunciation' must be at most %d characters", maxPronunciationLen)
+	case word.PartOfSpeech == "" && strings.TrimSpace(in.PartOfSpeech) != "":
+		return word, fmt.Errorf("unsupported pos %q", in.PartOfSpeech)
+	case word.Difficulty == "" && strings.TrimSpace(in.Difficulty) != "":
+		return word, fmt.Errorf("unsupported difficulty %q, expected A1–C2", in.Difficulty)
+	}
+
+	for key, text := range in.Translations {
+		tag, err := langtag.Normalize(key)
+		if err != nil {
+			return word, err
+		}
+		text = textnorm.Clean(text)
+		if utf8.RuneCountInString(text) > maxTranslationLen {
+			return word, fmt.Errorf("translation %q must be at most %d characters", tag, maxTranslationLen)
+		}
+		if tag != lang {
+			word.Translations[tag] = text
+		}
+	}
+	for key, gloss := range in.Glosses {
+		tag, err := langtag.Normalize(key)
+		if err != nil {
+			return word, err
+		}
+		gloss = textnorm.Clean(gloss)
+		if utf8.RuneCountInString(gloss) > maxGlossLen {
+			return word, fmt.Errorf("gloss %q must be at most %d characters", tag, maxGlossLen)
+		}
+		word.Glosses[tag] = gloss
+	}
+	return word, nil
+}
+
+// respondWord đọc từ và trả về cùng các nghĩa và các hội thoại có từ đó
+func respondWord(ctx iris.Context, id int64) {
+	word, err := getWordItemFromDB(id)
+	if errors.Is(err, sql.ErrNoRows) {
+		ctx.StatusCode(iris.StatusNotFound)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Word %d not found", id)})
+		return
+	}
+	var senses []models.WordSense
+	var dialogIDs []int64
+	if err == nil {
+		senses, err = getWordSensesFromDB(database.DB, id)
+	}
+	if err == nil {
+		dialogIDs, err = getWordDialogIDsFromDB(id)
+	}
+	if err != nil {
+		ctx.StatusCode(iris.StatusInternalServerError)
+		ctx.JSON(APIResponse{Status: "error", Error: fmt.Sprintf("Failed to load word: %v", err)})
+		return
+	}
+
+	ctx.JSON(APIResponse{Status: "success", Data: map[string]interface{}{"word": word, "senses": senses, "dialogIDs": dialogIDs}})
+}
+
+// wordCursorValue trả về giá trị của cột sắp xếp dùng cho cursor
+func wordCursorValue(sort string, w wordItem) string {
+	switch strings.TrimPrefix(sort, "-") {
+	case "createdAt":
+		return cursorTime(w.CreatedAt)
+	case "updatedAt":
+		return cursorTime(w.UpdatedAt)
+	case "content":
+		return w.Content
+	}
+	return ""
+}
+
+func getWordItemsFromDB(where *sqlWhere, page pageParams) ([]wordItem, error) {
+	rows, err := database.DB.Query(`SELECT w.id, w.lang, w.content, w.pronunciation, w.part_of_speech, w.difficulty,
+			COALESCE(w.created_by, 0), w.created_at, w.updated_at
+		FROM word w `+where.String()+" "+page.orderBy("w.id"), where.args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	words := []wordItem{}
+	var ids []int64
+	for rows.Next() {
+		var w wordItem
+		if err := rows.Scan(&w.ID, &w.Lang, &w.Content, &w.Pronunciation, &w.PartOfSpeech, &w.Difficulty,
+			&w.CreatedBy, &w.CreatedAt, &w.UpdatedAt); err != nil {
+			return nil, err
+		}
+		ids = append(ids, w.ID)
+		words = append(words, w)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	translations, err := getFirstSenseTranslationsFromDB(ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range words {
+		words[i].Translations = translations[words[i].ID]
+	}
+	return words, nil
+}
+
+func getWordItemFromDB(id int64) (wordItem, error) {
+	w := wordItem{}
+	err := database.DB.QueryRow(`SELECT id, lang, content, pronunciation, part_of_speech, difficulty,
+			COALESCE(created_by, 0), created_at, updated_at FROM word WHERE id = $1`, id).
+		Scan(&w.ID, &w.Lang, &w.Content, &w.Pronunciation, &w.PartOfSpeech, &w.Difficulty, &w.CreatedBy, &w.CreatedAt, &w.UpdatedAt)
+	if err != nil {
+		return w, err
+	}
+	translations, err := getFirstSenseTranslationsFromDB([]int64{id})
+	w.Translations = translations[id]
+	return w, err
+}
+
+// getFirstSenseTranslationsFromDB trả về bản dịch của nghĩa đầu tiên (id nhỏ nhất) của từng từ
+// theo từng ngôn ngữ; từ không có bản dịch nhận map rỗng
+func getFirstSenseTranslationsFromDB(ids []int64) (map[int64]map[string]string, error) {
+	translations := make(map[int64]map[string]string, len(ids))
+	for _, id := range ids {
+		translations[id] = make(map[string]string)
+	}
+	if len(ids) == 0 {
+		return translations, nil
+	}
+
+	rows, err := database.DB.Query(`SELECT DISTINCT ON (word_id, lang) word_id, lang, text FROM word_translation
+		WHERE word_id = ANY($1) ORDER BY word_id, lang, sense_id`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var wordID int64
+		var lang, text string
+		if err := rows.Scan(&wordID, &lang, &text); err != nil {
+			return nil, err
+		}
+		translations[wordID][lang] = text
+	}
+	return translations, rows.Err()
+}
+
+func getWordDialogIDsFromDB(wordID int64) ([]int64, error) {
+	rows, err := database.DB.Query("SELECT dialog_id FROM word_dialog WHERE word_id = $1 ORDER BY dialog_id", wordID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []int64{}
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// createWordInDB thêm từ mới cùng nghĩa đầu tiên và bản dịch, thêm vào từ vựng của người tạo.
+// Từ đã có (cùng ngôn ngữ và khoá chuẩn hoá) trả về lỗi unique violation.
+func createWordInDB(userID int64, word models.Word) (int64, error) {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var id int64
+	err = tx.QueryRow(`INSERT INTO word (lang, content, norm_key, pronunciation, part_of_speech, difficulty, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7::bigint, 0)) RETURNING id`,
+		word.Lang, word.Content, textnorm.Normalize(word.Content), word.Pronunciation, word.PartOfSpeech, word.Difficulty, userID).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	for lang, text := range word.Translations {
+		if text == "" {
+			delete(word.Translations, lang)
+		}
+	}
+	if _, _, err := saveWordSense(tx, id, word); err != nil {
+		return 0, err
+	}
+	if userID != 0 {
+		if _, err := tx.Exec("INSERT INTO user_word (user_id, word_id) VALUES ($1, $2) ON CONFLICT DO NOTHING", userID, id); err != nil {
+			return 0, err
+		}
+	}
+	return id, tx.Commit()
+}
+
+// updateWordInDB ghi đè thông tin của từ và bản dịch của một nghĩa. Đổi cách viết thì khoá chuẩn hoá
+// được tính lại và vị trí của từ trong các hội thoại được tìm lại (chỉ khi cách viết đổi); trùng với từ khác trả về lỗi unique violation.
+func updateWordInDB(word models.Word) error {
+	tx, err := database.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldContent string
+	if err := tx.QueryRow("SELECT content FROM word WHERE id = $1 FOR UPDATE", word.ID).Scan(&oldContent); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE word SET lang = $2, content = $3, norm_key = $4, pronunciation = $5, part_of_speech = $6,
+		difficulty = $7, updated_at = NOW() WHERE id = $1`,
+		word.ID, word.Lang, word.Content, textnorm.Normalize(word.Content), word.Pronunciation, word.PartOfSpeech, word.Difficulty)
+	if err != nil {
+		return err
+	}
+	if word.Content != oldContent {
+		if err := refreshWordDialogs(tx, word.ID); err != nil {
+			return fmt.Errorf("locate word in dialogs: %w", err)
+		}
+	}
+	if len(word.Translations) == 0 && len(word.Glosses) == 0 {
+		return tx.Commit()
+	}
+
+	senseID := word.SenseID
+	if senseID == 0 {
+		err = tx.QueryRow("SELECT COALESCE(MIN(id), 0) FROM word_sense WHERE word_id = $1", word.ID).Scan(&senseID)
+		if err == nil && senseID == 0 {
+			err = tx.QueryRow(`INSERT INTO word_sense (word_id, part_of_speech) VALUES ($1, $2) RETURNING id`,
+				word.ID, word.PartOfSpeech).Scan(&senseID)
+		}
+	} else {
+		err = tx.QueryRow("SELECT id FROM word_sense WHERE id = $1 AND word_id = $2", senseID, word.ID).Scan(&senseID)
+		if errors.Is(err, sql.ErrNoRows) {
+			err = errUnknownSense
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	for lang, text := range word.Translations {
+		if text == "" {
+			_, err = tx.Exec("DELETE FROM word_translation WHERE sense_id = $1 AND lang = $2", senseID, lang)
+		} else {
+			_, err = tx.Exec(`INSERT INTO word_translation (word_id, sense_id, lang, text) VALUES ($1, $2, $3, $4)
+				ON CONFLICT (sense_id, lang) DO UPDATE SET text = EXCLUDED.text, updated_at = NOW()`,
+				word.ID, senseID, lang, text)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	for lang, gloss := range word.Glosses {
+		if _, err := tx.Exec("UPDATE word_translation SET gloss = $3, updated_at = NOW() WHERE sense_id = $1 AND lang = $2",
+			senseID, lang, gloss); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// refreshWordDialogs tính lại vị trí từ vựng trong mọi hội thoại có từ wordID, vì cách viết của từ có thể đã đổi
+func refreshWordDialogs(tx *sql.Tx, wordID int64) error {
+	rows, err := tx.Query("SELECT dialog_id FROM word_dialog WHERE word_id = $1 ORDER BY dialog_id", wordID)
+	if err != nil {
+		return err
+	}
+	var dialogIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		dialogIDs = append(dialogIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range dialogIDs {
+		if _, err := refreshWordOccurrences(tx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
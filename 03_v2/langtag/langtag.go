@@ -0,0 +1,67 @@
+package langtag
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/text/language"
+	"golang.org/x/text/language/display"
+)
+
+// Ngôn ngữ mặc định của hội thoại và của bản dịch
+const (
+	DefaultSource = "vi"
+	DefaultTarget = "en"
+)
+
+// MaxLen là độ dài tối đa của một mã ngôn ngữ lưu trong cơ sở dữ liệu
+const MaxLen = 35
+
+var vietnameseNames = display.Tags(language.Vietnamese)
+
+// Normalize chuẩn hoá một mã ngôn ngữ BCP-47 ("EN_us" -> "en-US"), trả lỗi nếu không hợp lệ
+func Normalize(tag string) (string, error) {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return "", fmt.Errorf("empty language tag")
+	}
+	t, err := language.Parse(strings.ReplaceAll(tag, "_", "-"))
+	if err != nil {
+		return "", fmt.Errorf("invalid language tag %q: %w", tag, err)
+	}
+	s := t.String()
+	if len(s) > MaxLen {
+		return "", fmt.Errorf("language tag %q is longer than %d characters", tag, MaxLen)
+	}
+	return s, nil
+}
+
+// NormalizeDefault giống Normalize nhưng trả về def khi tag rỗng
+func NormalizeDefault(tag, def string) (string, error) {
+	if strings.TrimSpace(tag) == "" {
+		return def, nil
+	}
+	return Normalize(tag)
+}
+
+// Base trả về phần ngôn ngữ chính của mã ("vi-VN" -> "vi")
+func Base(tag string) string {
+	base, _, _ := strings.Cut(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"), "-")
+	return strings.ToLower(base)
+}
+
+// Name trả về tên ngôn ngữ bằng tiếng Việt để dùng trong prompt ("en" -> "tiếng Anh"),
+// dùng tên tiếng Anh nếu không có tên tiếng Việt
+func Name(tag string) string {
+	t, err := language.Parse(tag)
+	if err != nil {
+		return tag
+	}
+	if name := vietnameseNames.Name(t); name != "" {
+		return strings.Replace(name, "Tiếng ", "tiếng ", 1)
+	}
+	if name := display.English.Tags().Name(t); name != "" {
+		return name
+	}
+	return tag
+}
@@ -16,6 +16,7 @@ func main() {
 	// Enable CORS with default settings or custom options
 	crs := cors.New(cors.Options{
 		AllowedOrigins:   []string{"*"},
+		AllowedHeaders:   []string{"Origin", "Accept", "Content-Type", "X-Requested-With", "Authorization"},
 		AllowCredentials: true,
 	})
 
@@ -34,12 +35,92 @@ func main() {
 	}
 	defer database.CloseDB()
 
-	// Register routes
+	// Khởi tạo danh mục giọng đọc và nhân vật mặc định
+	if err := database.SeedCatalog(cfg.Voices, cfg.Characters); err != nil {
+		log.Fatalf("Failed to seed catalog: %v", err)
+	}
+
+	// Chạy các worker xử lý pipeline nền
+	if err := handlers.StartPipelineWorkers(cfg); err != nil {
+		log.Fatalf("Failed to start pipeline workers: %v", err)
+	}
+
+	// Register routes. Các route ghi dữ liệu hoặc gọi Groq cần access token (handlers.RequireAuth)
+	auth := handlers.RequireAuth(cfg)
+	streamAuth := handlers.RequireStreamAuth(cfg)
 	app.Get("/", handlers.IndexHandler)
-	app.Get("/dialog", handlers.GenerateDialogHandler)
-	app.Get("/words", handlers.ExtractWordsHandler)
-	app.Post("/translate", handlers.TranslateWordsHandler)
-	app.Post("/save-words", handlers.SaveWordsHandler)
+	app.Post("/auth/register", handlers.RegisterHandler)
+	app.Post("/auth/login", handlers.LoginHandler)
+	app.Post("/auth/refresh", handlers.RefreshTokenHandler)
+	app.Post("/auth/logout", handlers.LogoutHandler)
+	app.Get("/me", auth, handlers.MeHandler)
+	app.Get("/me/words", auth, handlers.MyWordsHandler)
+	app.Delete("/me/words/{id:int64}", auth, handlers.RemoveMyWordHandler)
+	app.Get("/dialog", auth, handlers.GenerateDialogHandler)
+	app.Post("/dialog", auth, handlers.GenerateDialogHandler)
+	app.Get("/words", handlers.AuthWhenParam("dialog", auth), handlers.WordsHandler)
+	app.Post("/words", auth, handlers.CreateWordHandler)
+	app.Get("/words/{id:int64}", handlers.GetWordHandler)
+	app.Put("/words/{id:int64}", auth, handlers.UpdateWordHandler)
+	app.Delete("/words/{id:int64}", auth, handlers.DeleteWordHandler)
+	app.Post("/translate", auth, handlers.TranslateWordsHandler)
+	app.Post("/save-words", auth, handlers.SaveWordsHandler)
+	app.Get("/words/{id:int64}/senses", handlers.WordSensesHandler)
+	app.Get("/senses/review", handlers.SensesReviewHandler)
+	app.Post("/senses/{id:int64}/review", auth, handlers.ReviewSenseHandler)
+	app.Get("/decks", auth, handlers.ListDecksHandler)
+	app.Post("/decks", auth, handlers.CreateDeckHandler)
+	app.Get("/decks/{id:int64}", auth, handlers.GetDeckHandler)
+	app.Put("/decks/{id:int64}", auth, handlers.UpdateDeckHandler)
+	app.Delete("/decks/{id:int64}", auth, handlers.DeleteDeckHandler)
+	app.Post("/decks/{id:int64}/words", auth, handlers.AddDeckWordsHandler)
+	app.Delete("/decks/{id:int64}/words/{wordID:int64}", auth, handlers.RemoveDeckWordHandler)
+	app.Get("/decks/{id:int64}/export", auth, handlers.ExportDeckHandler)
+	app.Post("/dialogs/{id:int64}/deck", auth, handlers.CreateDialogDeckHandler)
+	app.Post("/dialogs/{id:int64}/exercises", auth, handlers.CreateExercisesHandler)
+	app.Get("/exercises/{id:int64}", handlers.GetExercisesHandler)
+	app.Post("/exercises/{id:int64}/grade", handlers.GradeExercisesHandler)
+	app.Get("/reviews/due", auth, handlers.DueReviewsHandler)
+	app.Post("/reviews", auth, handlers.SubmitReviewHandler)
+	app.Get("/reviews/history", auth, handlers.ReviewHistoryHandler)
+	app.Post("/reviews/claim", auth, handlers.ClaimReviewsHandler)
+	app.Post("/pipelines", auth, handlers.CreatePipelineHandler)
+	app.Get("/pipelines/{id:int64}", auth, handlers.GetPipelineHandler)
+	app.Get("/pipelines/{id:int64}/events", streamAuth, handlers.PipelineEventsHandler)
+	app.Get("/search", handlers.SearchHandler)
+	app.Get("/dialogs", handlers.ListDialogsHandler)
+	app.Post("/dialogs", auth, handlers.CreateDialogHandler)
+	app.Get("/dialogs/{id:int64}", handlers.GetDialogHandler)
+	app.Put("/dialogs/{id:int64}", auth, handlers.UpdateDialogHandler)
+	app.Delete("/dialogs/{id:int64}", auth, handlers.DeleteDialogHandler)
+	app.Get("/dialogs/{id:int64}/words", handlers.DialogWordsHandler)
+	app.Post("/dialogs/{id:int64}/words", auth, handlers.AddDialogWordsHandler)
+	app.Delete("/dialogs/{id:int64}/words/{wordID:int64}", auth, handlers.RemoveDialogWordHandler)
+	app.Get("/dialogs/{id:int64}/annotations", handlers.DialogAnnotationsHandler)
+	app.Get("/dialogs/{id:int64}/ssml", handlers.DialogSSMLHandler)
+	app.Get("/dialogs/{id:int64}/voices", handlers.DialogVoicesHandler)
+	app.Put("/dialogs/{id:int64}/voices", auth, handlers.UpdateDialogVoicesHandler)
+	app.Post("/dialogs/{id:int64}/audio", auth, handlers.SynthesizeDialogAudioHandler)
+	app.Get("/dialogs/{id:int64}/audio", handlers.DialogAudioStatusHandler)
+	app.Get("/dialogs/{id:int64}/audio/{line:int}", handlers.DialogAudioStreamHandler)
+	app.Get("/dialogs/{id:int64}/timings", handlers.DialogTimingsHandler)
+	app.Get("/dialogs/{id:int64}/subtitles", handlers.AuthWhenParamIs("track", "translation", auth), handlers.DialogSubtitlesHandler)
+	app.Get("/voices", handlers.ListVoicesHandler)
+	app.Post("/voices", auth, handlers.CreateVoiceHandler)
+	app.Put("/voices/{name:string}", auth, handlers.UpdateVoiceHandler)
+	app.Delete("/voices/{name:string}", auth, handlers.DeleteVoiceHandler)
+	app.Get("/characters", handlers.ListCharactersHandler)
+	app.Post("/characters", auth, handlers.CreateCharacterHandler)
+	app.Get("/characters/{id:int64}", handlers.GetCharacterHandler)
+	app.Put("/characters/{id:int64}", auth, handlers.UpdateCharacterHandler)
+	app.Delete("/characters/{id:int64}", auth, handlers.DeleteCharacterHandler)
+	app.Post("/ssml/validate", handlers.ValidateSSMLHandler)
+	app.Post("/ssml/compile", handlers.CompileMarkupHandler)
+	app.Get("/lexicon.pls", handlers.LexiconHandler)
+	app.Get("/lexicon/overrides", handlers.ListLexiconOverridesHandler)
+	app.Post("/lexicon/overrides", auth, handlers.CreateLexiconOverrideHandler)
+	app.Put("/lexicon/overrides/{id:int64}", auth, handlers.UpdateLexiconOverrideHandler)
+	app.Delete("/lexicon/overrides/{id:int64}", auth, handlers.DeleteLexiconOverrideHandler)
 
 	// Start server
 	err = app.Listen(":8080")
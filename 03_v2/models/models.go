@@ -1,22 +1,192 @@
 package models
 
+import "time"
+
 // Dialog struct represents the 'dialog' table
 type Dialog struct {
-	ID      int64
-	Lang    string
-	Content string
+	ID         int64
+	Lang       string
+	Content    string
+	Topic      string
+	Setting    string
+	Characters []string
+	Turns      int
+	Level      string // trình độ CEFR (A1–C2)
+	Register   string // formal, neutral hoặc informal
+	Raw        string // phản hồi gốc của mô hình, giữ lại để đối chiếu
+	CreatedBy  int64  // id người dùng đã tạo, 0 nếu không rõ
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// User struct represents the 'app_user' table
+type User struct {
+	ID           int64     `json:"id"`
+	Email        string    `json:"email"`
+	PasswordHash string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
+
+// DialogTurn struct represents the 'dialog_turn' table (one spoken turn of a dialog)
+type DialogTurn struct {
+	DialogID int64  `json:"dialogID"`
+	Ordinal  int    `json:"ordinal"`
+	Speaker  string `json:"speaker"`
+	Text     string `json:"text"`
+	Line     int    `json:"line"` // số dòng trong nội dung gốc
 }
 
 // Word struct represents the 'word' table
 type Word struct {
-	ID        int64
-	Lang      string
-	Content   string
-	Translate string
+	ID            int64             `json:"id"`
+	Lang          string            `json:"lang"`
+	Content       string            `json:"content"`
+	SenseID       int64             `json:"senseID,omitempty"`       // nghĩa được dùng, khi từ gắn với một hội thoại
+	Translations  map[string]string `json:"translations"`            // bản dịch theo mã ngôn ngữ, lưu trong bảng word_translation
+	Glosses       map[string]string `json:"glosses,omitempty"`       // giải nghĩa ngắn theo mã ngôn ngữ, cột word_translation.gloss
+	Pronunciation string            `json:"pronunciation,omitempty"` // phiên âm IPA, dùng cho lexicon PLS
+	PartOfSpeech  string            `json:"pos,omitempty"`
+	Difficulty    string            `json:"difficulty,omitempty"` // cấp độ CEFR (A1–C2)
+	Example       string            `json:"example,omitempty"`    // câu ví dụ trong hội thoại, cột word_dialog.example
+}
+
+// WordSense struct represents the 'word_sense' table (one meaning of a word with its translations)
+type WordSense struct {
+	ID           int64             `json:"id"`
+	WordID       int64             `json:"wordID"`
+	PartOfSpeech string            `json:"pos,omitempty"`
+	NeedsReview  bool              `json:"needsReview"` // nghĩa được tạo vì bản dịch khác các nghĩa đã có, cần người kiểm tra
+	Translations map[string]string `json:"translations"`
+	Glosses      map[string]string `json:"glosses,omitempty"` // giải nghĩa (định nghĩa ngắn) theo mã ngôn ngữ
+}
+
+// WordTranslation struct represents the 'word_translation' table
+type WordTranslation struct {
+	WordID  int64
+	SenseID int64
+	Lang    string
+	Text    string
+	Gloss   string
 }
 
-// WordDialog struct represents the 'word_dialog' table (no explicit fields needed as it's a join table)
+// WordDialog struct represents the 'word_dialog' table
 type WordDialog struct {
 	DialogID int64
 	WordID   int64
+	SenseID  int64 // nghĩa của từ trong hội thoại này
+	Example  string
+}
+
+// WordOccurrence struct represents the 'word_occurrence' table (one place a word occurs in a dialog turn).
+// Start and End are code point offsets into the turn text, End exclusive.
+type WordOccurrence struct {
+	DialogID int64  `json:"dialogID"`
+	Ordinal  int    `json:"ordinal"` // số thứ tự của lượt nói, bắt đầu từ 1
+	WordID   int64  `json:"wordID"`
+	Start    int    `json:"start"`
+	End      int    `json:"end"`
+	Surface  string `json:"surface"` // dạng viết trong câu thoại
+}
+
+// ReviewCard struct represents the 'review_card' table (SM-2 state of one word for one learner)
+type ReviewCard struct {
+	Learner        string     `json:"learner"`
+	WordID         int64      `json:"wordID"`
+	Ease           float64    `json:"ease"`
+	Interval       int        `json:"intervalDays"`
+	Repetitions    int        `json:"repetitions"`
+	Lapses         int        `json:"lapses"`
+	DueAt          time.Time  `json:"dueAt"`
+	LastReviewedAt *time.Time `json:"lastReviewedAt"`
+}
+
+// ReviewLog struct represents the 'review_log' table (one submitted grade and the schedule it produced)
+type ReviewLog struct {
+	ID         int64     `json:"id"`
+	Learner    string    `json:"learner"`
+	WordID     int64     `json:"wordID"`
+	Grade      int       `json:"grade"`
+	Ease       float64   `json:"ease"`
+	Interval   int       `json:"intervalDays"`
+	DueAt      time.Time `json:"dueAt"`
+	ReviewedAt time.Time `json:"reviewedAt"`
+}
+
+// Deck struct represents the 'deck' table (a named collection of words owned by one user)
+type Deck struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	DialogID    int64     `json:"dialogID,omitempty"` // hội thoại nguồn khi bộ thẻ được tạo từ hội thoại
+	WordCount   int       `json:"wordCount"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// DialogVoice struct represents the 'dialog_voice' table (speaker -> voice mapping of a dialog)
+type DialogVoice struct {
+	DialogID int64
+	Speaker  string
+	Voice    string
+}
+
+// DialogAudio struct represents the 'dialog_audio' table (synthesised audio of one dialog line)
+type DialogAudio struct {
+	DialogID    int64  `json:"dialogID"`
+	Ordinal     int    `json:"ordinal"`
+	Speaker     string `json:"speaker"`
+	Text        string `json:"text"`
+	Voice       string `json:"voice"`
+	Provider    string `json:"provider"`
+	Status      string `json:"status"`
+	BlobKey     string `json:"-"`
+	ContentType string `json:"contentType"`
+	DurationMs  int64  `json:"durationMs"`
+	Error       string `json:"error,omitempty"`
+}
+
+// AudioMark struct represents the 'dialog_audio_mark' table (timing of one <mark> in a line's audio)
+type AudioMark struct {
+	DialogID  int64  `json:"-"`
+	Ordinal   int    `json:"-"`
+	MarkIndex int    `json:"index"`
+	Name      string `json:"mark"`
+	Token     string `json:"token"`
+	OffsetMs  int64  `json:"offsetMs"`
+}
+
+// DialogLineTranslation struct represents the 'dialog_line_translation' table
+type DialogLineTranslation struct {
+	DialogID int64
+	Ordinal  int
+	Lang     string
+	Text     string
+}
+
+// LexiconOverride struct represents the 'lexicon_override' table (manual pronunciation fix)
+type LexiconOverride struct {
+	ID       int64  `json:"id"`
+	Lang     string `json:"lang"`
+	Grapheme string `json:"grapheme"`
+	Alias    string `json:"alias"`
+	Phoneme  string `json:"phoneme"`
+}
+
+// Voice struct represents the 'voice' table (voice catalog entry)
+type Voice struct {
+	Name        string `json:"name"`
+	Lang        string `json:"lang"`
+	Gender      string `json:"gender"`
+	Style       string `json:"style"`
+	DisplayName string `json:"displayName"`
+}
+
+// Character struct represents the 'character_profile' table (a recurring dialog character)
+type Character struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Nationality  string `json:"nationality"`
+	Gender       string `json:"gender"`
+	Persona      string `json:"persona"`
+	DefaultVoice string `json:"defaultVoice"`
 }
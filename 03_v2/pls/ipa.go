@@ -0,0 +1,40 @@
+package pls
+
+import (
+	"strings"
+	"unicode"
+)
+
+// ipaSymbols là các ký tự IPA nằm ngoài các khối Unicode dành riêng cho phiên âm
+const ipaSymbols = "æçðøħŋœβθχⁿ .|‖‿"
+
+// CleanIPA bỏ cặp /.../ hoặc [...] bao ngoài phiên âm và kiểm tra mọi ký tự thuộc bảng chữ cái IPA.
+// ok là false khi phiên âm rỗng hoặc có ký tự khác như chữ hoa, chữ số, dấu ' hay chữ có dấu của
+// chính tả thông thường, để giá trị đó không được ghi vào <phoneme alphabet="ipa">.
+func CleanIPA(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '/' && s[len(s)-1] == '/' || s[0] == '[' && s[len(s)-1] == ']') {
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	if strings.IndexFunc(s, func(r rune) bool { return !isIPA(r) }) >= 0 {
+		return "", false
+	}
+	if strings.IndexFunc(s, unicode.IsLetter) < 0 {
+		return "", false
+	}
+	return s, true
+}
+
+func isIPA(r rune) bool {
+	switch {
+	case r >= 'a' && r <= 'z':
+		return true
+	case r >= 0x0250 && r <= 0x02FF: // IPA Extensions, Spacing Modifier Letters (ˈ ˌ ː ʰ, chữ thanh điệu)
+		return true
+	case r >= 0x0300 && r <= 0x036F: // dấu phụ kết hợp
+		return true
+	case r >= 0x1D00 && r <= 0x1DBF: // Phonetic Extensions
+		return true
+	}
+	return strings.ContainsRune(ipaSymbols, r)
+}
@@ -0,0 +1,78 @@
+package pls
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Namespace là namespace của W3C Pronunciation Lexicon Specification 1.0
+const Namespace = "http://www.w3.org/2005/01/pronunciation-lexicon"
+
+// ContentType là kiểu MIME của file PLS
+const ContentType = "application/pls+xml"
+
+// Lexeme là một mục phát âm: một hoặc nhiều cách viết cùng với phiên âm hoặc cách đọc thay thế
+type Lexeme struct {
+	Graphemes []string
+	Phoneme   string // phiên âm theo bảng chữ cái của lexicon (ví dụ IPA)
+	Alias     string // cách đọc thay thế bằng chữ thường
+}
+
+// Lexicon là một từ điển phát âm PLS
+type Lexicon struct {
+	Lang     string
+	Alphabet string
+	Lexemes  []Lexeme
+}
+
+type xmlLexicon struct {
+	XMLName  xml.Name    `xml:"lexicon"`
+	Version  string      `xml:"version,attr"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Alphabet string      `xml:"alphabet,attr"`
+	Lang     string      `xml:"xml:lang,attr"`
+	Lexemes  []xmlLexeme `xml:"lexeme"`
+}
+
+type xmlLexeme struct {
+	Graphemes []string `xml:"grapheme"`
+	Phoneme   string   `xml:"phoneme,omitempty"`
+	Alias     string   `xml:"alias,omitempty"`
+}
+
+// Write ghi lexicon ra w theo định dạng PLS 1.0, các mục được sắp xếp theo cách viết
+func (l Lexicon) Write(w io.Writer) error {
+	alphabet := l.Alphabet
+	if alphabet == "" {
+		alphabet = "ipa"
+	}
+	doc := xmlLexicon{Version: "1.0", Xmlns: Namespace, Alphabet: alphabet, Lang: l.Lang}
+
+	lexemes := make([]Lexeme, 0, len(l.Lexemes))
+	for _, lexeme := range l.Lexemes {
+		if len(lexeme.Graphemes) == 0 {
+			continue
+		}
+		if lexeme.Phoneme == "" && lexeme.Alias == "" {
+			return fmt.Errorf("lexeme %q has neither phoneme nor alias", lexeme.Graphemes[0])
+		}
+		lexemes = append(lexemes, lexeme)
+	}
+	sort.SliceStable(lexemes, func(i, j int) bool { return lexemes[i].Graphemes[0] < lexemes[j].Graphemes[0] })
+	for _, lexeme := range lexemes {
+		doc.Lexemes = append(doc.Lexemes, xmlLexeme{Graphemes: lexeme.Graphemes, Phoneme: lexeme.Phoneme, Alias: lexeme.Alias})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("failed to encode lexicon: %w", err)
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
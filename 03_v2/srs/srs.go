@@ -0,0 +1,97 @@
+package srs
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// Tham số của thuật toán SM-2. Các hàm trong gói không đọc đồng hồ hay cơ sở dữ liệu:
+// cùng thẻ, cùng điểm và cùng thời điểm luôn cho cùng kết quả.
+const (
+	DefaultEase = 2.5 // hệ số dễ của thẻ mới
+	MinEase     = 1.3 // hệ số dễ nhỏ nhất
+	PassGrade   = 3   // điểm thấp nhất được tính là nhớ
+
+	firstInterval  = 1 // ngày, sau lần nhớ đầu tiên
+	secondInterval = 6 // ngày, sau lần nhớ thứ hai liên tiếp
+)
+
+// Day là độ dài một khoảng ôn tập
+const Day = 24 * time.Hour
+
+// Grade là điểm tự đánh giá sau khi ôn một thẻ, từ 0 đến 5:
+// 0 quên hẳn, 1 sai nhưng nhận ra khi xem đáp án, 2 sai nhưng thấy quen,
+// 3 đúng nhưng rất khó nhớ, 4 đúng sau khi do dự, 5 đúng ngay
+type Grade int
+
+// Valid cho biết điểm nằm trong khoảng 0–5
+func (g Grade) Valid() bool {
+	return g >= 0 && g <= 5
+}
+
+// Card là trạng thái ôn tập của một từ với một người học
+type Card struct {
+	Ease        float64   // hệ số dễ, nhân với khoảng cách để ra khoảng cách tiếp theo
+	Interval    int       // khoảng cách hiện tại, tính theo ngày
+	Repetitions int       // số lần nhớ liên tiếp
+	Lapses      int       // số lần quên sau khi đã nhớ
+	Due         time.Time // thời điểm cần ôn lại
+}
+
+// NewCard tạo thẻ mới, đến hạn ôn ngay tại now
+func NewCard(now time.Time) Card {
+	return Card{Ease: DefaultEase, Due: now}
+}
+
+// IsDue cho biết thẻ đã đến hạn ôn tại now
+func (c Card) IsDue(now time.Time) bool {
+	return !c.Due.After(now)
+}
+
+// Review áp dụng một lần ôn với điểm grade tại thời điểm now và trả về trạng thái mới.
+// Nhớ (grade >= 3): khoảng cách là 1 ngày, rồi 6 ngày, rồi khoảng cách trước nhân hệ số dễ.
+// Quên: ôn lại lượt đầu với khoảng cách 1 ngày. Hệ số dễ luôn được cập nhật và không nhỏ hơn MinEase.
+func Review(c Card, grade Grade, now time.Time) (Card, error) {
+	if !grade.Valid() {
+		return c, fmt.Errorf("grade %d out of range 0-5", grade)
+	}
+	if c.Ease < MinEase {
+		c.Ease = DefaultEase
+	}
+
+	if grade >= PassGrade {
+		switch c.Repetitions {
+		case 0:
+			c.Interval = firstInterval
+		case 1:
+			c.Interval = secondInterval
+		default:
+			c.Interval = int(math.Round(float64(c.Interval) * c.Ease))
+		}
+		c.Repetitions++
+	} else {
+		if c.Repetitions > 0 {
+			c.Lapses++
+		}
+		c.Repetitions = 0
+		c.Interval = firstInterval
+	}
+
+	q := float64(5 - grade)
+	c.Ease = math.Max(MinEase, c.Ease+0.1-q*(0.08+q*0.02))
+	// Làm tròn để trạng thái lưu trong cơ sở dữ liệu không phụ thuộc sai số dấu phẩy động
+	c.Ease = math.Round(c.Ease*1000) / 1000
+
+	c.Due = now.Add(time.Duration(c.Interval) * Day)
+	return c, nil
+}
+
+// Preview trả về trạng thái thẻ sau khi ôn với từng điểm, để client hiển thị lịch của mỗi lựa chọn
+func Preview(c Card, now time.Time) map[Grade]Card {
+	next := make(map[Grade]Card, 6)
+	for g := Grade(0); g <= 5; g++ {
+		next[g], _ = Review(c, g, now)
+	}
+	return next
+}
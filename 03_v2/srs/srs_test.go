@@ -0,0 +1,110 @@
+package srs
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReview(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		card  Card
+		grade Grade
+		want  Card
+	}{
+		{
+			name:  "first pass is one day",
+			card:  NewCard(now),
+			grade: 5,
+			want:  Card{Ease: 2.6, Interval: 1, Repetitions: 1},
+		},
+		{
+			name:  "second pass is six days",
+			card:  Card{Ease: 2.6, Interval: 1, Repetitions: 1},
+			grade: 5,
+			want:  Card{Ease: 2.7, Interval: 6, Repetitions: 2},
+		},
+		{
+			name:  "later passes multiply by the previous ease",
+			card:  Card{Ease: 2.7, Interval: 6, Repetitions: 2},
+			grade: 4,
+			want:  Card{Ease: 2.7, Interval: 16, Repetitions: 3},
+		},
+		{
+			name:  "hard pass keeps the ease at the floor",
+			card:  Card{Ease: MinEase, Interval: 10, Repetitions: 3},
+			grade: 3,
+			want:  Card{Ease: MinEase, Interval: 13, Repetitions: 4},
+		},
+		{
+			name:  "blackout drops the ease to the floor",
+			card:  Card{Ease: 1.4, Interval: 6, Repetitions: 2},
+			grade: 0,
+			want:  Card{Ease: MinEase, Interval: 1, Lapses: 1},
+		},
+		{
+			name:  "lapse resets repetitions and counts the lapse",
+			card:  Card{Ease: 2.7, Interval: 16, Repetitions: 3, Lapses: 1},
+			grade: 2,
+			want:  Card{Ease: 2.38, Interval: 1, Lapses: 2},
+		},
+		{
+			name:  "failing a new card is not a lapse",
+			card:  NewCard(now),
+			grade: 1,
+			want:  Card{Ease: 1.96, Interval: 1},
+		},
+		{
+			name:  "invalid stored ease starts from the default",
+			card:  Card{Ease: 0, Interval: 6, Repetitions: 2},
+			grade: 5,
+			want:  Card{Ease: 2.6, Interval: 15, Repetitions: 3},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Review(tt.card, tt.grade, now)
+			if err != nil {
+				t.Fatalf("Review: %v", err)
+			}
+			tt.want.Due = now.Add(time.Duration(tt.want.Interval) * Day)
+			if got != tt.want {
+				t.Errorf("Review(%+v, %d) = %+v, want %+v", tt.card, tt.grade, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReviewInvalidGrade(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	card := Card{Ease: 2.5, Interval: 6, Repetitions: 2, Due: now}
+
+	for _, grade := range []Grade{-1, 6} {
+		got, err := Review(card, grade, now)
+		if err == nil {
+			t.Errorf("Review with grade %d: expected an error", grade)
+		}
+		if got != card {
+			t.Errorf("Review with grade %d changed the card to %+v", grade, got)
+		}
+	}
+}
+
+func TestPreview(t *testing.T) {
+	now := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	card := Card{Ease: 2.5, Interval: 6, Repetitions: 2, Due: now}
+
+	preview := Preview(card, now)
+	if len(preview) != 6 {
+		t.Fatalf("Preview returned %d grades, want 6", len(preview))
+	}
+	for grade, got := range preview {
+		want, _ := Review(card, grade, now)
+		if got != want {
+			t.Errorf("Preview[%d] = %+v, want %+v", grade, got, want)
+		}
+	}
+}
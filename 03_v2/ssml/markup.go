@@ -0,0 +1,300 @@
+package ssml
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Cú pháp đánh dấu trong câu thoại:
+//
+//	[pause 500ms], [pause 1s], [pause]  -> <break time="..."/> hoặc <break strength="medium"/>
+//	*nhấn mạnh*                         -> <emphasis level="moderate">
+//	**rất nhấn mạnh**                   -> <emphasis level="strong">
+//	{slow: Hồ Hoàn Kiếm}, {80%: ...}    -> <prosody rate="...">
+//
+// Dùng dấu \ để viết các ký tự [ ] * { } \ như văn bản thường. Khi biên dịch câu thoại, ký hiệu
+// không khớp hoặc không hợp lệ được giữ nguyên như văn bản; chỉ CompileMarkup báo lỗi cú pháp.
+
+// MarkupError là lỗi cú pháp đánh dấu, Column tính theo ký tự và bắt đầu từ 1
+type MarkupError struct {
+	Column int
+	Msg    string
+}
+
+func (e *MarkupError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Msg)
+}
+
+// CompileMarkup biên dịch một câu thoại có đánh dấu thành đoạn SSML (đã escape XML)
+func CompileMarkup(text string) (string, error) {
+	p := &markupParser{src: []rune(text)}
+	out, err := p.parseSeq("", 0)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// Token là một từ được đánh dấu bằng <mark> trong câu thoại
+type Token struct {
+	Index int    `json:"index"`
+	Mark  string `json:"mark"`
+	Text  string `json:"text"`
+}
+
+// compileTurn biên dịch một câu thoại, tuỳ chọn xử lý cú pháp đánh dấu và chèn <mark> trước mỗi từ
+func compileTurn(text string, markup, marks bool, prefix string) (string, []Token, error) {
+	p := &markupParser{src: []rune(text), lenient: true, marks: marks, prefix: prefix}
+	if !markup {
+		var b strings.Builder
+		p.writeText(&b, text)
+		return b.String(), p.tokens, nil
+	}
+	out, err := p.parseSeq("", 0)
+	if err != nil {
+		return "", nil, err
+	}
+	return out, p.tokens, nil
+}
+
+// StripMarkup bỏ các ký hiệu đánh dấu và trả về văn bản thuần, dùng cho phụ đề hoặc hiển thị
+func StripMarkup(text string) (string, error) {
+	p := &markupParser{src: []rune(text), lenient: true, plain: true}
+	out, err := p.parseSeq("", 0)
+	if err != nil {
+		return "", err
+	}
+	return strings.Join(strings.Fields(out), " "), nil
+}
+
+type markupParser struct {
+	src     []rune
+	pos     int
+	lenient bool   // giữ ký hiệu không hợp lệ như văn bản thay vì báo lỗi
+	plain   bool   // chỉ xuất văn bản, không xuất thẻ SSML
+	marks   bool   // chèn <mark> trước mỗi từ
+	prefix  string // tiền tố tên mark
+	tokens  []Token
+}
+
+// writeText ghi một đoạn văn bản thường, chèn <mark> trước mỗi từ nếu được yêu cầu
+func (p *markupParser) writeText(b *strings.Builder, text string) {
+	if !p.marks {
+		if p.plain {
+			b.WriteString(text)
+		} else {
+			b.WriteString(Escape(text))
+		}
+		return
+	}
+
+	rest := text
+	for rest != "" {
+		start := strings.IndexFunc(rest, func(r rune) bool { return !unicode.IsSpace(r) })
+		if start == -1 {
+			b.WriteString(rest)
+			return
+		}
+		b.WriteString(rest[:start])
+		rest = rest[start:]
+
+		end := strings.IndexFunc(rest, unicode.IsSpace)
+		if end == -1 {
+			end = len(rest)
+		}
+		word := rest[:end]
+		rest = rest[end:]
+
+		token := Token{Index: len(p.tokens) + 1, Text: word}
+		token.Mark = fmt.Sprintf("%sw%d", p.prefix, token.Index)
+		p.tokens = append(p.tokens, token)
+		if p.plain {
+			b.WriteString(word)
+		} else {
+			fmt.Fprintf(b, `<mark name="%s"/>%s`, Escape(token.Mark), Escape(word))
+		}
+	}
+}
+
+func (p *markupParser) errorf(pos int, format string, args ...interface{}) error {
+	return &MarkupError{Column: pos + 1, Msg: fmt.Sprintf(format, args...)}
+}
+
+func (p *markupParser) hasPrefix(s string) bool {
+	r := []rune(s)
+	if p.pos+len(r) > len(p.src) {
+		return false
+	}
+	return string(p.src[p.pos:p.pos+len(r)]) == s
+}
+
+// parseSeq đọc cho đến khi gặp chuỗi kết thúc stop (hoặc hết văn bản nếu stop rỗng).
+// openedAt là vị trí mở của cấu trúc đang đọc, dùng để báo lỗi khi thiếu phần đóng.
+func (p *markupParser) parseSeq(stop string, openedAt int) (string, error) {
+	var b strings.Builder
+	var text strings.Builder
+	flush := func() {
+		p.writeText(&b, text.String())
+		text.Reset()
+	}
+
+	for p.pos < len(p.src) {
+		if stop != "" && p.hasPrefix(stop) {
+			p.pos += len([]rune(stop))
+			flush()
+			return b.String(), nil
+		}
+
+		r := p.src[p.pos]
+		switch r {
+		case '\\':
+			if p.pos+1 >= len(p.src) {
+				if p.lenient {
+					text.WriteRune(r)
+					p.pos++
+					continue
+				}
+				return "", p.errorf(p.pos, "dangling escape character")
+			}
+			text.WriteRune(p.src[p.pos+1])
+			p.pos += 2
+		case '[', '*', '{':
+			flush()
+			start, tokens := p.pos, len(p.tokens)
+			var out string
+			var err error
+			switch r {
+			case '[':
+				out, err = p.parseDirective()
+			case '*':
+				out, err = p.parseEmphasis()
+			default:
+				out, err = p.parseProsody()
+			}
+			if err != nil && p.lenient {
+				// Ký hiệu mở không tạo thành cấu trúc hợp lệ: đọc lại từ ký tự sau nó như văn bản
+				p.pos, p.tokens = start+1, p.tokens[:tokens]
+				text.WriteRune(r)
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(out)
+		case ']', '}':
+			if p.lenient {
+				text.WriteRune(r)
+				p.pos++
+				continue
+			}
+			return "", p.errorf(p.pos, "unexpected %q without matching opening bracket", r)
+		default:
+			text.WriteRune(r)
+			p.pos++
+		}
+	}
+
+	if stop != "" {
+		return "", p.errorf(openedAt, "missing closing %q", stop)
+	}
+	flush()
+	return b.String(), nil
+}
+
+func (p *markupParser) parseDirective() (string, error) {
+	start := p.pos
+	end := -1
+	for i := p.pos + 1; i < len(p.src); i++ {
+		if p.src[i] == ']' {
+			end = i
+			break
+		}
+	}
+	if end == -1 {
+		return "", p.errorf(start, "missing closing \"]\"")
+	}
+	fields := strings.Fields(string(p.src[start+1 : end]))
+	p.pos = end + 1
+
+	if len(fields) == 0 || strings.ToLower(fields[0]) != "pause" {
+		return "", p.errorf(start, "unknown directive %q, expected [pause] or [pause <time>]", string(p.src[start:end+1]))
+	}
+	var out string
+	switch len(fields) {
+	case 1:
+		out = `<break strength="medium"/>`
+	case 2:
+		ms, err := parseTime(fields[1])
+		if err != nil {
+			return "", p.errorf(start, "invalid pause %q: %v", fields[1], err)
+		}
+		if ms > maxBreakMillis {
+			return "", p.errorf(start, "pause %q exceeds the maximum of %dms", fields[1], maxBreakMillis)
+		}
+		out = fmt.Sprintf(`<break time="%s"/>`, fields[1])
+	default:
+		return "", p.errorf(start, "invalid pause directive %q", string(p.src[start:end+1]))
+	}
+	if p.plain {
+		return " ", nil
+	}
+	return out, nil
+}
+
+func (p *markupParser) parseEmphasis() (string, error) {
+	start := p.pos
+	marker, level := "*", "moderate"
+	if p.hasPrefix("**") {
+		marker, level = "**", "strong"
+	}
+	p.pos += len(marker)
+
+	inner, err := p.parseSeq(marker, start)
+	if err != nil {
+		return "", err
+	}
+	if strings.TrimSpace(inner) == "" {
+		return "", p.errorf(start, "empty emphasis")
+	}
+	if p.plain {
+		return inner, nil
+	}
+	return fmt.Sprintf(`<emphasis level="%s">%s</emphasis>`, level, inner), nil
+}
+
+func (p *markupParser) parseProsody() (string, error) {
+	start := p.pos
+	colon := -1
+	for i := p.pos + 1; i < len(p.src) && p.src[i] != '}'; i++ {
+		if p.src[i] == ':' {
+			colon = i
+			break
+		}
+	}
+	if colon == -1 {
+		return "", p.errorf(start, "expected {<rate>: text}")
+	}
+
+	rate := strings.ToLower(strings.TrimSpace(string(p.src[start+1 : colon])))
+	if strings.IndexFunc(rate, unicode.IsSpace) >= 0 {
+		return "", p.errorf(start, "invalid rate %q", rate)
+	}
+	if err := CheckRate(rate); err != nil {
+		return "", p.errorf(start, "invalid rate %q: %v", rate, err)
+	}
+	p.pos = colon + 1
+
+	inner, err := p.parseSeq("}", start)
+	if err != nil {
+		return "", err
+	}
+	inner = strings.TrimSpace(inner)
+	if inner == "" {
+		return "", p.errorf(start, "empty prosody block")
+	}
+	if p.plain {
+		return inner, nil
+	}
+	return fmt.Sprintf(`<prosody rate="%s">%s</prosody>`, rate, inner), nil
+}
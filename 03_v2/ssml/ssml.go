@@ -0,0 +1,143 @@
+package ssml
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"golang.org/x/text/language"
+)
+
+// DefaultLang là ngôn ngữ mặc định của tài liệu SSML
+const DefaultLang = "vi-VN"
+
+// Turn là một lượt nói trong hội thoại
+type Turn struct {
+	ID      string // định danh dùng làm tiền tố tên mark, mặc định là số thứ tự của lượt nói
+	Line    int    // số dòng trong hội thoại gốc, dùng khi báo lỗi
+	Speaker string
+	Text    string
+}
+
+// Document mô tả một tài liệu SSML cần tạo
+type Document struct {
+	Lang         string            // giá trị xml:lang của thẻ <speak>
+	Voices       map[string]string // ánh xạ người nói -> tên giọng đọc
+	DefaultVoice string            // giọng dùng khi người nói chưa được ánh xạ
+	Markup       bool              // biên dịch cú pháp đánh dấu trong câu thoại (xem CompileMarkup)
+	Rate         string            // tốc độ đọc cho mọi câu (chế độ người học), ví dụ "80%"
+	Marks        bool              // chèn <mark name="t<ID>w<n>"/> trước mỗi từ để lấy mốc thời gian
+	Lexicons     []string          // URI của các lexicon PLS được tham chiếu bằng <lexicon>
+	Turns        []Turn
+}
+
+var escaper = strings.NewReplacer(
+	"&", "&amp;",
+	"<", "&lt;",
+	">", "&gt;",
+	`"`, "&quot;",
+	"'", "&apos;",
+)
+
+// Escape thay các ký tự đặc biệt của XML trong văn bản
+func Escape(s string) string {
+	return escaper.Replace(s)
+}
+
+// NormalizeLang chuẩn hoá một mã ngôn ngữ thành dạng BCP-47 (ví dụ "vi_VN" -> "vi-VN")
+func NormalizeLang(lang string) (string, error) {
+	lang = strings.TrimSpace(lang)
+	if lang == "" {
+		return DefaultLang, nil
+	}
+	tag, err := language.Parse(strings.ReplaceAll(lang, "_", "-"))
+	if err != nil {
+		return "", fmt.Errorf("invalid xml:lang %q: %w", lang, err)
+	}
+	return tag.String(), nil
+}
+
+// VoiceFor trả về giọng đọc của một người nói, hoặc chuỗi rỗng nếu không có
+func (d Document) VoiceFor(speaker string) string {
+	if voice, ok := d.Voices[speaker]; ok && voice != "" {
+		return voice
+	}
+	return d.DefaultVoice
+}
+
+// Build tạo chuỗi SSML từ tài liệu, mỗi lượt nói nằm trong một thẻ <voice>
+func Build(doc Document) (string, error) {
+	lang, err := NormalizeLang(doc.Lang)
+	if err != nil {
+		return "", err
+	}
+
+	var missing []string
+	seen := make(map[string]bool)
+	for _, turn := range doc.Turns {
+		if doc.VoiceFor(turn.Speaker) == "" && !seen[turn.Speaker] {
+			seen[turn.Speaker] = true
+			missing = append(missing, turn.Speaker)
+		}
+	}
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", fmt.Errorf("no voice configured for speakers: %s", strings.Join(missing, ", "))
+	}
+
+	if doc.Rate != "" {
+		if err := CheckRate(doc.Rate); err != nil {
+			return "", fmt.Errorf("invalid rate %q: %w", doc.Rate, err)
+		}
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<speak version="1.0" xmlns="http://www.w3.org/2001/10/synthesis" xml:lang="%s">`+"\n", Escape(lang))
+	for _, uri := range doc.Lexicons {
+		fmt.Fprintf(&b, `  <lexicon uri="%s"/>`+"\n", Escape(uri))
+	}
+	for i, turn := range doc.Turns {
+		text := strings.TrimSpace(turn.Text)
+		if text == "" {
+			continue
+		}
+
+		body, _, err := doc.compile(turn, i)
+		if err != nil {
+			return "", err
+		}
+		if doc.Rate != "" {
+			body = fmt.Sprintf(`<prosody rate="%s">%s</prosody>`, Escape(doc.Rate), body)
+		}
+
+		fmt.Fprintf(&b, `  <voice name="%s">%s</voice>`+"\n", Escape(doc.VoiceFor(turn.Speaker)), body)
+	}
+	b.WriteString("</speak>")
+
+	return b.String(), nil
+}
+
+// TurnTokens trả về các từ được đánh dấu của lượt nói thứ index (bắt đầu từ 0),
+// với tên mark giống hệt tài liệu do Build tạo ra
+func (d Document) TurnTokens(index int) ([]Token, error) {
+	if index < 0 || index >= len(d.Turns) {
+		return nil, fmt.Errorf("turn %d out of range", index+1)
+	}
+	_, tokens, err := d.compile(d.Turns[index], index)
+	return tokens, err
+}
+
+func (d Document) compile(turn Turn, index int) (string, []Token, error) {
+	id := turn.ID
+	if id == "" {
+		id = fmt.Sprint(index + 1)
+	}
+	body, tokens, err := compileTurn(strings.TrimSpace(turn.Text), d.Markup, d.Marks, "t"+id)
+	if err != nil {
+		if turn.Line > 0 {
+			return "", nil, fmt.Errorf("line %d: %w", turn.Line, err)
+		}
+		return "", nil, fmt.Errorf("turn %d: %w", index+1, err)
+	}
+	return body, tokens, nil
+}
@@ -0,0 +1,370 @@
+package ssml
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Mức độ nghiêm trọng của một vấn đề
+const (
+	SeverityError   = "error"
+	SeverityWarning = "warning"
+)
+
+// Issue là một lỗi hoặc cảnh báo tìm thấy trong tài liệu SSML
+type Issue struct {
+	Line     int    `json:"line"`
+	Column   int    `json:"column"`
+	Severity string `json:"severity"`
+	Message  string `json:"message"`
+}
+
+// ValidateOptions cấu hình quá trình kiểm tra
+type ValidateOptions struct {
+	// Voices là danh mục giọng đọc hợp lệ; nếu rỗng thì không kiểm tra tên giọng
+	Voices []string
+}
+
+// HasErrors cho biết danh sách có chứa lỗi (không chỉ cảnh báo) hay không
+func HasErrors(issues []Issue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+type elementRule struct {
+	attrs    map[string]bool
+	required []string
+	empty    bool // không được chứa văn bản hay phần tử con
+	textOnly bool // chỉ được chứa văn bản
+}
+
+var elementRules = map[string]elementRule{
+	"speak":    {attrs: set("version", "xml:lang")},
+	"voice":    {attrs: set("name", "gender", "age", "variant", "languages")},
+	"prosody":  {attrs: set("rate", "pitch", "volume", "range", "contour", "duration")},
+	"break":    {attrs: set("time", "strength"), empty: true},
+	"emphasis": {attrs: set("level")},
+	"say-as":   {attrs: set("interpret-as", "format", "detail"), required: []string{"interpret-as"}, textOnly: true},
+	"mark":     {attrs: set("name"), required: []string{"name"}, empty: true},
+	"sub":      {attrs: set("alias"), required: []string{"alias"}, textOnly: true},
+	"phoneme":  {attrs: set("alphabet", "ph"), required: []string{"ph"}, textOnly: true},
+	"lexicon":  {attrs: set("uri", "type"), required: []string{"uri"}, empty: true},
+}
+
+var (
+	breakStrengths  = set("none", "x-weak", "weak", "medium", "strong", "x-strong")
+	emphasisLevels  = set("strong", "moderate", "none", "reduced")
+	rateKeywords    = set("x-slow", "slow", "medium", "fast", "x-fast", "default")
+	pitchKeywords   = set("x-low", "low", "medium", "high", "x-high", "default")
+	volumeKeywords  = set("silent", "x-soft", "soft", "medium", "loud", "x-loud", "default")
+	voiceGenders    = set("male", "female", "neutral")
+	phonemeAlphabet = set("ipa", "x-sampa", "sapi", "ups")
+
+	timeRe      = regexp.MustCompile(`^(\d+(?:\.\d+)?)(ms|s)$`)
+	percentRe   = regexp.MustCompile(`^([+-]?)(\d+(?:\.\d+)?)%$`)
+	numberRe    = regexp.MustCompile(`^\d+(?:\.\d+)?$`)
+	relPitchRe  = regexp.MustCompile(`^[+-]\d+(?:\.\d+)?(Hz|st|%)$`)
+	absPitchRe  = regexp.MustCompile(`^\d+(?:\.\d+)?Hz$`)
+	relVolumeRe = regexp.MustCompile(`^[+-]\d+(?:\.\d+)?dB$`)
+)
+
+// Giới hạn giá trị được chấp nhận
+const (
+	maxBreakMillis = 10000
+	minRate        = 0.5
+	maxRate        = 2.0
+)
+
+// Validate kiểm tra một tài liệu SSML: tính hợp lệ XML, các phần tử và thuộc tính được phép,
+// miền giá trị của thuộc tính và tên giọng đọc theo danh mục đã cấu hình.
+func Validate(doc string, opts ValidateOptions) []Issue {
+	v := &validator{src: doc}
+	if len(opts.Voices) > 0 {
+		v.voices = set(opts.Voices...)
+	}
+	v.run()
+	return v.issues
+}
+
+type validator struct {
+	src    string
+	voices map[string]bool
+	issues []Issue
+}
+
+type openElement struct {
+	name string
+	rule elementRule
+}
+
+func (v *validator) addf(offset int64, severity, format string, args ...interface{}) {
+	line, col := v.position(offset)
+	v.issues = append(v.issues, Issue{Line: line, Column: col, Severity: severity, Message: fmt.Sprintf(format, args...)})
+}
+
+// position đổi vị trí byte thành dòng và cột (tính theo ký tự, bắt đầu từ 1)
+func (v *validator) position(offset int64) (int, int) {
+	if offset > int64(len(v.src)) {
+		offset = int64(len(v.src))
+	}
+	prefix := v.src[:offset]
+	line := strings.Count(prefix, "\n") + 1
+	lineStart := strings.LastIndex(prefix, "\n") + 1
+	return line, utf8.RuneCountInString(prefix[lineStart:]) + 1
+}
+
+func (v *validator) run() {
+	dec := xml.NewDecoder(strings.NewReader(v.src))
+	dec.Strict = true
+
+	var stack []openElement
+	sawRoot := false
+	for {
+		offset := dec.InputOffset()
+		tok, err := dec.Token()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			var syntaxErr *xml.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				v.addf(dec.InputOffset(), SeverityError, "malformed XML: %s", syntaxErr.Msg)
+			} else {
+				v.addf(dec.InputOffset(), SeverityError, "malformed XML: %v", err)
+			}
+			return
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			name := t.Name.Local
+			if len(stack) > 0 && stack[len(stack)-1].rule.empty {
+				v.addf(offset, SeverityError, "<%s> must be empty but contains <%s>", stack[len(stack)-1].name, name)
+			}
+			if len(stack) > 0 && stack[len(stack)-1].rule.textOnly {
+				v.addf(offset, SeverityError, "<%s> may only contain text but contains <%s>", stack[len(stack)-1].name, name)
+			}
+			if len(stack) == 0 {
+				if sawRoot {
+					v.addf(offset, SeverityError, "document has more than one root element")
+				} else if name != "speak" {
+					v.addf(offset, SeverityError, "root element must be <speak>, found <%s>", name)
+				}
+				sawRoot = true
+			} else if name == "speak" {
+				v.addf(offset, SeverityError, "<speak> cannot be nested")
+			} else if name == "lexicon" && stack[len(stack)-1].name != "speak" {
+				v.addf(offset, SeverityError, "<lexicon> must be a direct child of <speak>")
+			}
+
+			rule, ok := elementRules[name]
+			if !ok {
+				v.addf(offset, SeverityError, "element <%s> is not allowed", name)
+			} else {
+				v.checkAttrs(offset, name, rule, t.Attr)
+			}
+			stack = append(stack, openElement{name: name, rule: rule})
+
+		case xml.EndElement:
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+
+		case xml.CharData:
+			if strings.TrimSpace(string(t)) == "" {
+				continue
+			}
+			if len(stack) == 0 {
+				v.addf(offset, SeverityError, "text outside of <speak>")
+			} else if stack[len(stack)-1].rule.empty {
+				v.addf(offset, SeverityError, "<%s> must be empty but contains text", stack[len(stack)-1].name)
+			}
+
+		case xml.Directive:
+			v.addf(offset, SeverityError, "directives such as DOCTYPE are not allowed")
+		}
+	}
+
+	if !sawRoot {
+		v.addf(int64(len(v.src)), SeverityError, "document is empty, expected <speak>")
+	}
+}
+
+func (v *validator) checkAttrs(offset int64, element string, rule elementRule, attrs []xml.Attr) {
+	values := make(map[string]string)
+	for _, attr := range attrs {
+		name := attrName(attr.Name)
+		if name == "" {
+			continue // khai báo namespace
+		}
+		if !rule.attrs[name] {
+			v.addf(offset, SeverityError, "attribute %q is not allowed on <%s>", name, element)
+			continue
+		}
+		values[name] = attr.Value
+	}
+	for _, name := range rule.required {
+		if _, ok := values[name]; !ok {
+			v.addf(offset, SeverityError, "<%s> is missing required attribute %q", element, name)
+		}
+	}
+
+	switch element {
+	case "speak":
+		if _, ok := values["version"]; !ok {
+			v.addf(offset, SeverityWarning, "<speak> should declare version=\"1.0\"")
+		}
+		if lang, ok := values["xml:lang"]; !ok {
+			v.addf(offset, SeverityWarning, "<speak> should declare xml:lang")
+		} else if _, err := NormalizeLang(lang); err != nil || strings.TrimSpace(lang) == "" {
+			v.addf(offset, SeverityError, "invalid xml:lang %q", lang)
+		}
+	case "voice":
+		name, hasName := values["name"]
+		if !hasName && values["gender"] == "" && values["languages"] == "" {
+			v.addf(offset, SeverityWarning, "<voice> selects no voice: set name, gender or languages")
+		}
+		if hasName && v.voices != nil && !v.voices[name] {
+			v.addf(offset, SeverityError, "voice %q is not in the voice catalog", name)
+		}
+		if gender, ok := values["gender"]; ok && !voiceGenders[gender] {
+			v.addf(offset, SeverityError, "invalid voice gender %q", gender)
+		}
+	case "prosody":
+		if len(values) == 0 {
+			v.addf(offset, SeverityWarning, "<prosody> has no attributes and has no effect")
+		}
+		if rate, ok := values["rate"]; ok {
+			if err := CheckRate(rate); err != nil {
+				v.addf(offset, SeverityError, "invalid prosody rate %q: %v", rate, err)
+			}
+		}
+		if pitch, ok := values["pitch"]; ok && !pitchKeywords[pitch] && !relPitchRe.MatchString(pitch) && !absPitchRe.MatchString(pitch) {
+			v.addf(offset, SeverityError, "invalid prosody pitch %q", pitch)
+		}
+		if volume, ok := values["volume"]; ok {
+			if err := checkVolume(volume); err != nil {
+				v.addf(offset, SeverityError, "invalid prosody volume %q: %v", volume, err)
+			}
+		}
+		if duration, ok := values["duration"]; ok {
+			if _, err := parseTime(duration); err != nil {
+				v.addf(offset, SeverityError, "invalid prosody duration %q: %v", duration, err)
+			}
+		}
+	case "break":
+		if t, ok := values["time"]; ok {
+			ms, err := parseTime(t)
+			if err != nil {
+				v.addf(offset, SeverityError, "invalid break time %q: %v", t, err)
+			} else if ms > maxBreakMillis {
+				v.addf(offset, SeverityError, "break time %q exceeds the maximum of %dms", t, maxBreakMillis)
+			}
+		}
+		if strength, ok := values["strength"]; ok && !breakStrengths[strength] {
+			v.addf(offset, SeverityError, "invalid break strength %q", strength)
+		}
+	case "emphasis":
+		if level, ok := values["level"]; ok && !emphasisLevels[level] {
+			v.addf(offset, SeverityError, "invalid emphasis level %q", level)
+		}
+	case "mark":
+		if strings.TrimSpace(values["name"]) == "" {
+			v.addf(offset, SeverityError, "<mark> name must not be empty")
+		}
+	case "phoneme":
+		if alphabet, ok := values["alphabet"]; ok && !phonemeAlphabet[alphabet] {
+			v.addf(offset, SeverityError, "unsupported phoneme alphabet %q", alphabet)
+		}
+	}
+}
+
+// attrName trả về tên thuộc tính dạng "prefix:local", hoặc chuỗi rỗng cho khai báo xmlns
+func attrName(name xml.Name) string {
+	switch {
+	case name.Space == "xmlns" || (name.Space == "" && name.Local == "xmlns"):
+		return ""
+	case name.Space == "http://www.w3.org/XML/1998/namespace" || name.Space == "xml":
+		return "xml:" + name.Local
+	default:
+		return name.Local
+	}
+}
+
+// parseTime đọc giá trị thời gian SSML ("500ms", "1.5s") và trả về số mili giây
+func parseTime(value string) (float64, error) {
+	m := timeRe.FindStringSubmatch(strings.TrimSpace(value))
+	if m == nil {
+		return 0, fmt.Errorf("expected a duration such as 500ms or 1.5s")
+	}
+	n, err := strconv.ParseFloat(m[1], 64)
+	if err != nil {
+		return 0, err
+	}
+	if m[2] == "s" {
+		n *= 1000
+	}
+	return n, nil
+}
+
+// CheckRate kiểm tra tốc độ đọc: chấp nhận từ khoá, số nhân (0.5-2.0), phần trăm tuyệt đối (50%-200%)
+// hoặc phần trăm tương đối (-50% đến +100%)
+func CheckRate(rate string) error {
+	if rateKeywords[rate] {
+		return nil
+	}
+	if numberRe.MatchString(rate) {
+		n, _ := strconv.ParseFloat(rate, 64)
+		if n < minRate || n > maxRate {
+			return fmt.Errorf("multiplier must be between %.1f and %.1f", minRate, maxRate)
+		}
+		return nil
+	}
+	m := percentRe.FindStringSubmatch(rate)
+	if m == nil {
+		return fmt.Errorf("expected a keyword, a multiplier or a percentage")
+	}
+	n, _ := strconv.ParseFloat(m[2], 64)
+	switch m[1] {
+	case "+":
+		n = 100 + n
+	case "-":
+		n = 100 - n
+	}
+	if n < minRate*100 || n > maxRate*100 {
+		return fmt.Errorf("resulting rate must be between %.0f%% and %.0f%%", minRate*100, maxRate*100)
+	}
+	return nil
+}
+
+func checkVolume(volume string) error {
+	if volumeKeywords[volume] || relVolumeRe.MatchString(volume) {
+		return nil
+	}
+	if numberRe.MatchString(volume) {
+		n, _ := strconv.ParseFloat(volume, 64)
+		if n > 100 {
+			return fmt.Errorf("volume must be between 0 and 100")
+		}
+		return nil
+	}
+	return fmt.Errorf("expected a keyword, a number between 0 and 100 or a dB change")
+}
+
+func set(values ...string) map[string]bool {
+	m := make(map[string]bool, len(values))
+	for _, value := range values {
+		m[value] = true
+	}
+	return m
+}
@@ -0,0 +1,81 @@
+package subtitle
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Tốc độ đọc phụ đề dùng để ước tính thời lượng khi chưa có âm thanh
+const (
+	charsPerSecond = 15
+	minCueDuration = 1500 * time.Millisecond
+)
+
+// Cue là một dòng phụ đề
+type Cue struct {
+	Start   time.Duration
+	End     time.Duration
+	Speaker string
+	Text    string
+}
+
+// ReadingTime ước tính thời gian cần để đọc một dòng phụ đề
+func ReadingTime(text string) time.Duration {
+	d := time.Duration(utf8.RuneCountInString(text)) * time.Second / charsPerSecond
+	if d < minCueDuration {
+		d = minCueDuration
+	}
+	return d
+}
+
+// WriteSRT ghi các cue theo định dạng SubRip, tên người nói được đặt trước câu thoại
+func WriteSRT(w io.Writer, cues []Cue) error {
+	for i, cue := range cues {
+		text := cue.Text
+		if cue.Speaker != "" {
+			text = cue.Speaker + ": " + text
+		}
+		_, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(cue.Start, ","), formatTimestamp(cue.End, ","), singleLine(text))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteVTT ghi các cue theo định dạng WebVTT, tên người nói dùng thẻ <v>
+func WriteVTT(w io.Writer, cues []Cue) error {
+	if _, err := io.WriteString(w, "WEBVTT\n\n"); err != nil {
+		return err
+	}
+	for i, cue := range cues {
+		text := escapeVTT(singleLine(cue.Text))
+		if cue.Speaker != "" {
+			text = fmt.Sprintf("<v %s>%s", escapeVTT(cue.Speaker), text)
+		}
+		_, err := fmt.Fprintf(w, "%d\n%s --> %s\n%s\n\n", i+1, formatTimestamp(cue.Start, "."), formatTimestamp(cue.End, "."), text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func formatTimestamp(d time.Duration, sep string) string {
+	ms := d.Milliseconds()
+	return fmt.Sprintf("%02d:%02d:%02d%s%03d", ms/3600000, ms/60000%60, ms/1000%60, sep, ms%1000)
+}
+
+// singleLine bỏ dòng trống trong câu vì dòng trống kết thúc một cue
+func singleLine(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+var vttEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+
+func escapeVTT(text string) string {
+	return vttEscaper.Replace(text)
+}
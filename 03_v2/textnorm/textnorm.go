@@ -0,0 +1,77 @@
+package textnorm
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Normalize chuẩn hoá một từ hoặc cụm từ để so sánh: Unicode NFC, chữ thường,
+// bỏ dấu câu ở hai đầu và gộp các khoảng trắng liên tiếp
+func Normalize(s string) string {
+	s = norm.NFC.String(s)
+	s = strings.ToLower(s)
+	fields := strings.Fields(s)
+	for i, field := range fields {
+		fields[i] = strings.TrimFunc(field, isEdgePunct)
+	}
+	return strings.Join(strings.Fields(strings.Join(fields, " ")), " ")
+}
+
+// Tokens tách văn bản thành các từ đã chuẩn hoá, bỏ qua token chỉ gồm dấu câu
+func Tokens(s string) []string {
+	var tokens []string
+	for _, field := range strings.Fields(Normalize(s)) {
+		if field != "" {
+			tokens = append(tokens, field)
+		}
+	}
+	return tokens
+}
+
+// Token là một từ trong văn bản gốc: vị trí [Start, End) tính theo ký tự Unicode (code point),
+// dạng viết như trong văn bản (không gồm dấu câu ở hai đầu) và dạng đã chuẩn hoá
+type Token struct {
+	Start   int
+	End     int
+	Surface string
+	Norm    string
+}
+
+// Locate tách văn bản thành các từ giống Tokens nhưng giữ lại vị trí của từng từ trong s
+func Locate(s string) []Token {
+	var tokens []Token
+	runes := []rune(s)
+	for i := 0; i < len(runes); {
+		for i < len(runes) && unicode.IsSpace(runes[i]) {
+			i++
+		}
+		start := i
+		for i < len(runes) && !unicode.IsSpace(runes[i]) {
+			i++
+		}
+		end := i
+		for start < end && isEdgePunct(runes[start]) {
+			start++
+		}
+		for end > start && isEdgePunct(runes[end-1]) {
+			end--
+		}
+		if start < end {
+			surface := string(runes[start:end])
+			tokens = append(tokens, Token{Start: start, End: end, Surface: surface, Norm: Normalize(surface)})
+		}
+	}
+	return tokens
+}
+
+func isEdgePunct(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
+
+// Clean chuẩn hoá cách viết để lưu trữ mà vẫn giữ nguyên chữ hoa và dấu câu:
+// Unicode NFC, bỏ khoảng trắng ở hai đầu và gộp các khoảng trắng liên tiếp
+func Clean(s string) string {
+	return strings.Join(strings.Fields(norm.NFC.String(s)), " ")
+}
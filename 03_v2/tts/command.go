@@ -0,0 +1,65 @@
+package tts
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// CommandProvider gọi một chương trình tổng hợp giọng nói cục bộ tương thích espeak-ng
+type CommandProvider struct {
+	Command string
+}
+
+// NewCommandProvider tạo provider dùng lệnh command (mặc định "espeak-ng")
+func NewCommandProvider(command string) *CommandProvider {
+	if command == "" {
+		command = "espeak-ng"
+	}
+	return &CommandProvider{Command: command}
+}
+
+// Name trả về tên provider
+func (p *CommandProvider) Name() string {
+	return "espeak"
+}
+
+// Synthesize chạy lệnh và đọc file WAV từ stdout
+func (p *CommandProvider) Synthesize(ctx context.Context, req Request) (*Result, error) {
+	// Tên giọng trong SSML là của danh mục đám mây nên chỉ gửi văn bản thuần cho espeak-ng
+	cmd := exec.CommandContext(ctx, p.Command, "--stdout", "-v", espeakVoice(req))
+	cmd.Stdin = strings.NewReader(req.Text)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s failed: %w (%s)", p.Command, err, strings.TrimSpace(stderr.String()))
+	}
+
+	audio := stdout.Bytes()
+	d, err := WAVDuration(audio)
+	if err != nil {
+		return nil, fmt.Errorf("%s returned invalid audio: %w", p.Command, err)
+	}
+	// espeak-ng không báo sự kiện mark qua dòng lệnh nên thời điểm được ước tính theo độ dài thực tế
+	return &Result{Audio: audio, ContentType: "audio/wav", Duration: d, Marks: EstimateMarks(req.Marks, d)}, nil
+}
+
+// espeakVoice chọn giọng espeak theo ngôn ngữ, vì tên giọng trong danh mục (ví dụ
+// vi-VN-HoaiMyNeural) là của dịch vụ đám mây; espeak-ng chỉ cần mã ngôn ngữ như "vi" hay "en-us".
+func espeakVoice(req Request) string {
+	lang := req.Lang
+	if parts := strings.Split(req.Voice, "-"); len(parts) >= 2 {
+		lang = parts[0] + "-" + parts[1]
+	}
+	lang = strings.ToLower(lang)
+	if lang == "" {
+		return "vi"
+	}
+	if strings.HasPrefix(lang, "vi") {
+		return "vi"
+	}
+	return lang
+}
@@ -0,0 +1,45 @@
+package tts
+
+import (
+	"context"
+	"strings"
+	"time"
+)
+
+// Tốc độ đọc ước tính dùng cho FakeProvider
+const (
+	wordsPerMinute = 150
+	minDuration    = 500 * time.Millisecond
+)
+
+// FakeProvider tạo file WAV im lặng có độ dài ước tính theo số từ, dùng khi phát triển và kiểm thử
+type FakeProvider struct{}
+
+// NewFakeProvider tạo một FakeProvider
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{}
+}
+
+// Name trả về tên provider
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+// Synthesize tạo âm thanh im lặng có độ dài ước tính cho văn bản
+func (p *FakeProvider) Synthesize(ctx context.Context, req Request) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	d := EstimateDuration(req.Text)
+	return &Result{Audio: SilentWAV(d), ContentType: "audio/wav", Duration: d, Marks: EstimateMarks(req.Marks, d)}, nil
+}
+
+// EstimateDuration ước tính thời gian đọc một câu theo tốc độ đọc trung bình
+func EstimateDuration(text string) time.Duration {
+	words := len(strings.Fields(text))
+	d := time.Duration(words) * time.Minute / wordsPerMinute
+	if d < minDuration {
+		d = minDuration
+	}
+	return d
+}
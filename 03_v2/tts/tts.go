@@ -0,0 +1,79 @@
+package tts
+
+import (
+	"context"
+	"fmt"
+	"time"
+	"unicode/utf8"
+)
+
+// Request là yêu cầu tổng hợp giọng nói cho một câu thoại
+type Request struct {
+	Text  string // văn bản thuần (đã bỏ cú pháp đánh dấu)
+	SSML  string // tài liệu SSML tương ứng, dành cho các engine hỗ trợ SSML
+	Voice string // tên giọng trong danh mục (ví dụ vi-VN-HoaiMyNeural)
+	Lang  string // mã ngôn ngữ BCP-47
+	Marks []Mark // các <mark> trong SSML theo thứ tự, kèm từ đứng sau mỗi mark
+}
+
+// Mark là một mốc <mark> trong SSML
+type Mark struct {
+	Name string
+	Text string
+}
+
+// MarkTiming là thời điểm (tính từ đầu câu) mà engine đọc tới một mark
+type MarkTiming struct {
+	Name   string
+	Text   string
+	Offset time.Duration
+}
+
+// Result là âm thanh đã tổng hợp
+type Result struct {
+	Audio       []byte
+	ContentType string
+	Duration    time.Duration
+	Marks       []MarkTiming
+}
+
+// EstimateMarks ước tính thời điểm của các mark bằng cách chia tổng thời lượng
+// theo độ dài (số ký tự) của từng từ, dùng cho engine không trả về sự kiện mark
+func EstimateMarks(marks []Mark, total time.Duration) []MarkTiming {
+	weights := make([]int, len(marks))
+	sum := 0
+	for i, mark := range marks {
+		weights[i] = utf8.RuneCountInString(mark.Text) + 1
+		sum += weights[i]
+	}
+
+	timings := make([]MarkTiming, len(marks))
+	elapsed := 0
+	for i, mark := range marks {
+		offset := time.Duration(0)
+		if sum > 0 {
+			offset = total * time.Duration(elapsed) / time.Duration(sum)
+		}
+		timings[i] = MarkTiming{Name: mark.Name, Text: mark.Text, Offset: offset}
+		elapsed += weights[i]
+	}
+	return timings
+}
+
+// TTSProvider là một backend chuyển văn bản thành giọng nói
+type TTSProvider interface {
+	Name() string
+	Synthesize(ctx context.Context, req Request) (*Result, error)
+}
+
+// NewProvider tạo provider theo tên cấu hình: "fake" hoặc "espeak"
+func NewProvider(name, command string) (TTSProvider, error) {
+	switch name {
+	case "", "fake":
+		return NewFakeProvider(), nil
+	case "espeak":
+		return NewCommandProvider(command), nil
+	default:
+		return nil, fmt.Errorf("unknown TTS provider %q", name)
+	}
+}
@@ -0,0 +1,72 @@
+package tts
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+// Thông số của file WAV do FakeProvider tạo ra: PCM 16-bit, mono
+const (
+	sampleRate    = 16000
+	bitsPerSample = 16
+	numChannels   = 1
+)
+
+// SilentWAV tạo một file WAV im lặng có độ dài d
+func SilentWAV(d time.Duration) []byte {
+	blockAlign := numChannels * bitsPerSample / 8
+	samples := int(d.Seconds() * sampleRate)
+	dataSize := samples * blockAlign
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(numChannels))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate))
+	binary.Write(&buf, binary.LittleEndian, uint32(sampleRate*blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(blockAlign))
+	binary.Write(&buf, binary.LittleEndian, uint16(bitsPerSample))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	buf.Write(make([]byte, dataSize))
+	return buf.Bytes()
+}
+
+// WAVDuration đọc header của file WAV và tính độ dài âm thanh
+func WAVDuration(data []byte) (time.Duration, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return 0, errors.New("not a WAV file")
+	}
+
+	var byteRate uint32
+	for pos := 12; pos+8 <= len(data); {
+		chunkID := string(data[pos : pos+4])
+		chunkSize := binary.LittleEndian.Uint32(data[pos+4 : pos+8])
+		body := pos + 8
+		switch chunkID {
+		case "fmt ":
+			if body+12 > len(data) {
+				return 0, errors.New("truncated fmt chunk")
+			}
+			byteRate = binary.LittleEndian.Uint32(data[body+8 : body+12])
+		case "data":
+			if byteRate == 0 {
+				return 0, errors.New("data chunk before fmt chunk")
+			}
+			size := int64(chunkSize)
+			// espeak-ng ghi ra stdout nên kích thước chunk có thể không chính xác
+			if remaining := int64(len(data) - body); size == 0 || size == 0xFFFFFFFF || size > remaining {
+				size = remaining
+			}
+			return time.Duration(size * int64(time.Second) / int64(byteRate)), nil
+		}
+		pos = body + int(chunkSize) + int(chunkSize%2)
+	}
+	return 0, errors.New("missing data chunk")
+}